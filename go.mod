@@ -1,11 +1,10 @@
 module github.com/fluxninja/datasketches-go
 
-go 1.17
+go 1.18
 
 require (
 	github.com/onsi/ginkgo v1.16.5
 	github.com/onsi/gomega v1.17.0
-	github.com/rs/zerolog v1.26.1
 )
 
 require (
@@ -0,0 +1,146 @@
+package sketches
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// warmSketch returns a sketch whose next levels are already allocated, so that
+// the following updates run in steady state.
+func warmSketch(k int) *HeapDoublesSketch {
+	sketch, err := NewDoublesSketchBuilder().SetK(k).SetRandomSeed(1).Build()
+	Expect(err).ToNot(HaveOccurred())
+	for i := 0; i < 2*k*1024+1; i++ {
+		Expect(sketch.Update(float64(i))).To(Succeed())
+	}
+	return sketch
+}
+
+var _ = Describe("Allocations", func() {
+	It("Does not allocate while updating in steady state", func() {
+		sketch := warmSketch(defaultK)
+		value := 0.0
+		allocs := testing.AllocsPerRun(10, func() {
+			for i := 0; i < 16*defaultK; i++ {
+				_ = sketch.Update(value)
+				value++
+			}
+		})
+		Expect(allocs).To(BeZero())
+
+		items := make([]float64, 16*defaultK)
+		allocs = testing.AllocsPerRun(10, func() {
+			_ = sketch.UpdateBatch(items)
+		})
+		Expect(allocs).To(BeZero())
+	})
+
+	It("Does not allocate while updating a direct sketch in steady state", func() {
+		bytes, err := warmSketch(defaultK).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		sketch, err := WrapDirectUpdateDoublesSketch(bytes, nil)
+		Expect(err).ToNot(HaveOccurred())
+		value := 0.0
+		allocs := testing.AllocsPerRun(10, func() {
+			for i := 0; i < 16*defaultK; i++ {
+				_ = sketch.Update(value)
+				value++
+			}
+		})
+		Expect(allocs).To(BeZero())
+	})
+})
+
+func benchmarkSketch(b *testing.B, k int, n int) *HeapDoublesSketch {
+	sketch, err := NewDoublesSketchBuilder().SetK(k).SetRandomSeed(1).Build()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		_ = sketch.Update(float64(i))
+	}
+	return sketch
+}
+
+func BenchmarkHeapDoublesSketchUpdate(b *testing.B) {
+	sketch := benchmarkSketch(b, 128, 0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = sketch.Update(float64(i))
+	}
+}
+
+func BenchmarkHeapDoublesSketchUpdateBatch(b *testing.B) {
+	sketch := benchmarkSketch(b, 128, 0)
+	items := make([]float64, 10000)
+	for i := range items {
+		items[i] = float64(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = sketch.UpdateBatch(items)
+	}
+}
+
+func BenchmarkDirectUpdateDoublesSketchUpdate(b *testing.B) {
+	sketch, err := NewDirectUpdateDoublesSketch(128, make([]byte, 8), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = sketch.Update(float64(i))
+	}
+}
+
+func BenchmarkDoublesSketchSerialize(b *testing.B) {
+	sketch := benchmarkSketch(b, 128, 1000000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sketch.Serialize(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDoublesSketchSerializeCompact(b *testing.B) {
+	sketch := benchmarkSketch(b, 128, 1000000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sketch.SerializeCustom(true); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDoublesSketchSerializeInto(b *testing.B) {
+	sketch := benchmarkSketch(b, 128, 1000000)
+	buf := make([]byte, sketch.GetSerializedSizeBytes(false))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sketch.SerializeInto(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDoublesSketchAppendSerialize(b *testing.B) {
+	sketch := benchmarkSketch(b, 128, 1000000).Compact()
+	var buf []byte
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = sketch.AppendSerialize(buf[:0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package sketches
+
+import (
+	"encoding/binary"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Byte order", func() {
+	for _, compact := range []bool{false, true} {
+		compact := compact
+
+		It("Round-trips both byte orders", func() {
+			sketch := newSketchWithRange(defaultK, 0, 5000)
+			little, err := sketch.SerializeWithByteOrder(compact, binary.LittleEndian)
+			Expect(err).ToNot(HaveOccurred())
+			big, err := sketch.SerializeWithByteOrder(compact, binary.BigEndian)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(little[FLAGS_BYTE] & BIG_ENDIAN_FLAG_MASK).To(BeZero())
+			Expect(big[FLAGS_BYTE] & BIG_ENDIAN_FLAG_MASK).ToNot(BeZero())
+			Expect(binary.LittleEndian.Uint16(little[K_SHORT:])).To(Equal(uint16(defaultK)))
+			Expect(binary.BigEndian.Uint16(big[K_SHORT:])).To(Equal(uint16(defaultK)))
+			Expect(binary.BigEndian.Uint64(big[N_LONG:])).To(Equal(uint64(5000)))
+
+			fromLittle, err := HeapifyDoublesSketch(little)
+			Expect(err).ToNot(HaveOccurred())
+			fromBig, err := HeapifyDoublesSketch(big)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fromBig.GetN()).To(Equal(int64(5000)))
+			Expect(fromBig.GetMinValue()).To(Equal(0.0))
+			Expect(fromBig.GetMaxValue()).To(Equal(4999.0))
+
+			expected, err := fromLittle.SerializeWithByteOrder(compact, binary.LittleEndian)
+			Expect(err).ToNot(HaveOccurred())
+			actual, err := fromBig.SerializeWithByteOrder(compact, binary.LittleEndian)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(Equal(expected))
+			Expect(actual).To(Equal(little))
+
+			upgraded, err := UpgradeDoublesSketchBytes(big)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(upgraded).To(Equal(big))
+		})
+	}
+
+	It("Wraps big-endian bytes", func() {
+		sketch := newSketchWithRange(defaultK, 0, 5000)
+		big, err := sketch.SerializeWithByteOrder(true, binary.BigEndian)
+		Expect(err).ToNot(HaveOccurred())
+		wrapped, err := WrapDoublesSketch(big)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(wrapped.GetMaxValue()).To(Equal(4999.0))
+		expectRanksWithin(wrapped, 5000, 0.02)
+
+		big, err = sketch.SerializeWithByteOrder(false, binary.BigEndian)
+		Expect(err).ToNot(HaveOccurred())
+		direct, err := WrapDirectUpdateDoublesSketch(big, nil)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 5000; i < 10000; i++ {
+			Expect(direct.Update(float64(i))).To(Succeed())
+		}
+		Expect(direct.GetMemory()[FLAGS_BYTE] & BIG_ENDIAN_FLAG_MASK).ToNot(BeZero())
+		expectRanksWithin(direct, 10000, 0.02)
+	})
+
+	It("Writes little-endian by default", func() {
+		sketch := newSketchWithRange(defaultK, 0, 5000)
+		for _, compact := range []bool{false, true} {
+			expected, err := sketch.SerializeWithByteOrder(compact, binary.LittleEndian)
+			Expect(err).ToNot(HaveOccurred())
+			actual, err := sketch.SerializeCustom(compact)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(Equal(expected))
+		}
+		serializedBytes, err := sketch.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(binary.LittleEndian.Uint64(serializedBytes[N_LONG:])).To(Equal(uint64(5000)))
+
+		direct, err := NewDirectUpdateDoublesSketch(defaultK, make([]byte, 8), nil)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < 5000; i++ {
+			Expect(direct.Update(float64(i))).To(Succeed())
+		}
+		Expect(direct.GetMemory()[FLAGS_BYTE] & BIG_ENDIAN_FLAG_MASK).To(BeZero())
+		Expect(binary.LittleEndian.Uint64(direct.GetMemory()[N_LONG:])).To(Equal(uint64(5000)))
+	})
+
+	It("Rejects an unknown byte order", func() {
+		sketch := newSketchWithRange(defaultK, 0, 10)
+		_, err := sketch.SerializeWithByteOrder(false, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,239 @@
+package sketches
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ConcurrentDoublesSketch is a quantiles sketch of float64 items that can be
+// updated and queried from many goroutines. It does not implement the
+// DoublesSketch interface: it offers the updates and queries of a
+// DoublesSketch, and Snapshot returns a DoublesSketch for everything else.
+// Like the concurrent sketches of the Java library, it gives writers local
+// buffers that propagate into a shared sketch in batches: each update goes to
+// one of several shards, chosen round-robin, and a shard merges its buffer
+// into the shared sketch once it holds 2k items. Writers on different shards
+// only contend while a buffer is propagated.
+//
+// Queries see every update that completed before they started. Every query,
+// including GetN, takes a Snapshot, which holds all shard locks and so blocks
+// all writers while the buffers are propagated and the base buffer is
+// copied. To run several queries against the same state, take a Snapshot
+// once and query it instead.
+type ConcurrentDoublesSketch struct {
+	k      int32
+	items  itemPolicies
+	shards []*concurrentDoublesShard
+	next   uint32
+
+	// mu guards shared; it is always acquired after any shard lock
+	mu     sync.Mutex
+	shared *HeapDoublesSketch
+}
+
+type concurrentDoublesShard struct {
+	mu  sync.Mutex
+	buf []float64
+}
+
+// NewConcurrentDoublesSketch returns an empty concurrent sketch with the given
+// k and number of shards. If numShards is not positive, GOMAXPROCS shards are
+// used.
+func NewConcurrentDoublesSketch(k int, numShards int) (*ConcurrentDoublesSketch, error) {
+	return NewDoublesSketchBuilder().SetK(k).BuildConcurrent(numShards)
+}
+
+func newConcurrentDoublesSketch(shared *HeapDoublesSketch, numShards int) *ConcurrentDoublesSketch {
+	if numShards <= 0 {
+		numShards = runtime.GOMAXPROCS(0)
+	}
+	shards := make([]*concurrentDoublesShard, numShards)
+	for i := range shards {
+		shards[i] = &concurrentDoublesShard{
+			buf: make([]float64, 0, 2*shared.GetK()),
+		}
+	}
+	return &ConcurrentDoublesSketch{
+		k:      shared.GetK(),
+		items:  shared.items,
+		shards: shards,
+		shared: shared,
+	}
+}
+
+func (s *ConcurrentDoublesSketch) GetK() int32 {
+	return s.k
+}
+
+// Update updates the sketch with the given item. By default NaNs are ignored;
+// see DoublesSketchBuilder.SetNaNPolicy and SetInfinityPolicy.
+func (s *ConcurrentDoublesSketch) Update(dataItem float64) error {
+	if keep, err := s.items.check(dataItem); !keep {
+		return err
+	}
+	shard := s.shards[atomic.AddUint32(&s.next, 1)%uint32(len(s.shards))]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.buf = append(shard.buf, dataItem)
+	if len(shard.buf) == cap(shard.buf) {
+		return s.propagate(shard)
+	}
+	return nil
+}
+
+// UpdateBatch updates the sketch with all the given items through a single
+// shard. If any item is rejected, none of them are added.
+func (s *ConcurrentDoublesSketch) UpdateBatch(dataItems []float64) error {
+	if err := s.items.checkAll(dataItems); err != nil {
+		return err
+	}
+	shard := s.shards[atomic.AddUint32(&s.next, 1)%uint32(len(s.shards))]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	for len(dataItems) > 0 {
+		numItems := copy(shard.buf[len(shard.buf):cap(shard.buf)], dataItems)
+		shard.buf = shard.buf[:len(shard.buf)+numItems]
+		dataItems = dataItems[numItems:]
+		if len(shard.buf) == cap(shard.buf) {
+			if err := s.propagate(shard); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// propagate merges the buffer of the shard into the shared sketch. The caller
+// must hold the shard lock.
+func (s *ConcurrentDoublesSketch) propagate(shard *concurrentDoublesShard) error {
+	s.mu.Lock()
+	err := s.shared.UpdateBatch(shard.buf)
+	s.mu.Unlock()
+	shard.buf = shard.buf[:0]
+	return err
+}
+
+// lockAll propagates every shard into the shared sketch and returns with all
+// locks held, so that the shared sketch reflects all completed updates.
+func (s *ConcurrentDoublesSketch) lockAll() error {
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+	}
+	s.mu.Lock()
+	for _, shard := range s.shards {
+		if err := s.shared.UpdateBatch(shard.buf); err != nil {
+			return err
+		}
+		shard.buf = shard.buf[:0]
+	}
+	return nil
+}
+
+func (s *ConcurrentDoublesSketch) unlockAll() {
+	s.mu.Unlock()
+	for _, shard := range s.shards {
+		shard.mu.Unlock()
+	}
+}
+
+// Snapshot returns an immutable compact copy of the current state of the
+// sketch. It blocks all writers, but only while the buffers are propagated
+// and the base buffer is copied; see HeapDoublesSketch.Snapshot.
+func (s *ConcurrentDoublesSketch) Snapshot() (*HeapCompactDoublesSketch, error) {
+	err := s.lockAll()
+	defer s.unlockAll()
+	if err != nil {
+		return nil, err
+	}
+	return s.shared.Snapshot(), nil
+}
+
+// Reset discards all items.
+func (s *ConcurrentDoublesSketch) Reset() {
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+	}
+	s.mu.Lock()
+	for _, shard := range s.shards {
+		shard.buf = shard.buf[:0]
+	}
+	shared := newHeapDoublesSketch(s.k)
+	shared.rand = s.shared.rand
+	s.shared = shared
+	s.unlockAll()
+}
+
+// GetN returns the number of items. Like the queries, it blocks all writers
+// while it propagates the buffers.
+func (s *ConcurrentDoublesSketch) GetN() int64 {
+	err := s.lockAll()
+	defer s.unlockAll()
+	if err != nil {
+		return 0
+	}
+	return s.shared.GetN()
+}
+
+func (s *ConcurrentDoublesSketch) IsEmpty() bool {
+	return s.GetN() == 0
+}
+
+// GetQuantile returns the approximate quantile of the given normalized rank.
+// See DoublesSketch.GetQuantile.
+func (s *ConcurrentDoublesSketch) GetQuantile(rank float64) (float64, error) {
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		return 0, err
+	}
+	return snapshot.GetQuantile(rank)
+}
+
+// GetQuantiles returns the approximate quantiles of the given normalized
+// ranks. See DoublesSketch.GetQuantiles.
+func (s *ConcurrentDoublesSketch) GetQuantiles(ranks []float64) ([]float64, error) {
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.GetQuantiles(ranks)
+}
+
+// GetRank returns the approximate normalized rank of the given value. See
+// DoublesSketch.GetRank.
+func (s *ConcurrentDoublesSketch) GetRank(value float64, searchCrit QuantileSearchCriteria) (float64, error) {
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		return 0, err
+	}
+	return snapshot.GetRank(value, searchCrit)
+}
+
+// GetCDF returns the approximate cumulative distribution function. See
+// DoublesSketch.GetCDF.
+func (s *ConcurrentDoublesSketch) GetCDF(splitPoints []float64, searchCrit QuantileSearchCriteria) ([]float64, error) {
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.GetCDF(splitPoints, searchCrit)
+}
+
+// GetPMF returns the approximate probability mass function. See
+// DoublesSketch.GetPMF.
+func (s *ConcurrentDoublesSketch) GetPMF(splitPoints []float64, searchCrit QuantileSearchCriteria) ([]float64, error) {
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.GetPMF(splitPoints, searchCrit)
+}
+
+// Serialize serializes a snapshot of the sketch in the compact format.
+func (s *ConcurrentDoublesSketch) Serialize() ([]byte, error) {
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.Serialize()
+}
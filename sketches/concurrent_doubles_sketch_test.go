@@ -0,0 +1,98 @@
+package sketches
+
+import (
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ConcurrentDoublesSketch", func() {
+	It("Rejects an invalid k", func() {
+		_, err := NewConcurrentDoublesSketch(100, 4)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Returns all buffered items in a snapshot", func() {
+		sketch, err := NewConcurrentDoublesSketch(defaultK, 4)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sketch.IsEmpty()).To(BeTrue())
+		for i := 0; i < 10; i++ {
+			Expect(sketch.Update(float64(i))).To(Succeed())
+		}
+		Expect(sketch.GetN()).To(Equal(int64(10)))
+		quantile, err := sketch.GetQuantile(1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quantile).To(Equal(9.0))
+
+		sketch.Reset()
+		Expect(sketch.IsEmpty()).To(BeTrue())
+	})
+
+	It("Accepts dozens of concurrent writers and readers", func() {
+		sketch, err := NewConcurrentDoublesSketch(defaultK, 0)
+		Expect(err).ToNot(HaveOccurred())
+		numWriters := 48
+		perWriter := 5000
+
+		var writers sync.WaitGroup
+		for w := 0; w < numWriters; w++ {
+			writers.Add(1)
+			go func(w int) {
+				defer GinkgoRecover()
+				defer writers.Done()
+				batch := make([]float64, 0, 100)
+				for i := 0; i < perWriter; i++ {
+					value := float64(w*perWriter + i)
+					if w%2 == 0 {
+						Expect(sketch.Update(value)).To(Succeed())
+						continue
+					}
+					batch = append(batch, value)
+					if len(batch) == cap(batch) {
+						Expect(sketch.UpdateBatch(batch)).To(Succeed())
+						batch = batch[:0]
+					}
+				}
+				Expect(sketch.UpdateBatch(batch)).To(Succeed())
+			}(w)
+		}
+
+		done := make(chan struct{})
+		var readers sync.WaitGroup
+		readers.Add(1)
+		go func() {
+			defer GinkgoRecover()
+			defer readers.Done()
+			var lastN int64
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				snapshot, err := sketch.Snapshot()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(snapshot.GetN()).To(BeNumerically(">=", lastN))
+				lastN = snapshot.GetN()
+				_, err = sketch.GetQuantile(0.5)
+				Expect(err).ToNot(HaveOccurred())
+			}
+		}()
+
+		writers.Wait()
+		close(done)
+		readers.Wait()
+
+		n := numWriters * perWriter
+		snapshot, err := sketch.Snapshot()
+		Expect(err).ToNot(HaveOccurred())
+		expectRanksWithin(snapshot, n, 0.02)
+
+		serializedBytes, err := sketch.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		heapified, err := HeapifyDoublesSketch(serializedBytes)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(heapified.GetN()).To(Equal(int64(n)))
+	})
+})
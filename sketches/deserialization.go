@@ -0,0 +1,331 @@
+package sketches
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// Serialization versions 1 and 2 were written by older versions of the
+// library and are converted into the current representation on heapify.
+const MIN_HEAP_DOUBLES_SER_VER int32 = 1
+
+// HeapifyDoublesSketch deserializes a sketch serialized by Serialize or
+// SerializeCustom. It returns a *HeapCompactDoublesSketch if the bytes are in
+// compact format, and a *HeapDoublesSketch otherwise.
+func HeapifyDoublesSketch(srcBytes []byte) (DoublesSketch, error) {
+	if checkIsCompactMemory(srcBytes) {
+		return HeapifyCompactDoublesSketch(srcBytes)
+	}
+	return HeapifyUpdatableDoublesSketch(srcBytes)
+}
+
+// HeapifyUpdatableDoublesSketch deserializes bytes of either format into an
+// updatable heap sketch.
+func HeapifyUpdatableDoublesSketch(srcBytes []byte) (*HeapDoublesSketch, error) {
+	pre, err := extractPreamble(srcBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	hds := newHeapDoublesSketch(pre.k)
+	if pre.empty {
+		return hds, nil
+	}
+
+	// serialization version 2 is always stored as compact
+	srcIsCompact := pre.serVer == 2 || pre.flags&(COMPACT_FLAG_MASK|READ_ONLY_FLAG_MASK) > 0
+	if err := checkStorageBytes(pre.k, pre.n, srcIsCompact, pre.serVer, len(srcBytes)); err != nil {
+		return nil, err
+	}
+
+	hds.n = pre.n
+	hds.baseBufferCount = util.ComputeBaseBufferItems(pre.k, pre.n)
+	hds.bitPattern = util.ComputeBitPattern(pre.k, pre.n)
+	hds.minValue = util.BinaryGetFloat64(srcBytes[MIN_DOUBLE:], pre.byteOrder)
+	hds.maxValue = util.BinaryGetFloat64(srcBytes[MAX_DOUBLE:], pre.byteOrder)
+
+	preBytes := computePreambleBytes(pre.serVer)
+	combinedBuffer := make([]float64, computeCombinedBufferItemCapacity(pre.k, pre.n))
+	if srcIsCompact {
+		offset := preBytes
+		util.BinaryGetFloat64Slice(combinedBuffer[:hds.baseBufferCount], srcBytes[offset:], pre.byteOrder)
+		offset += int(hds.baseBufferCount) << 3
+
+		var combBufOffset int32 = 2 * pre.k
+		for ubitPattern := uint64(hds.bitPattern); ubitPattern > 0; ubitPattern >>= 1 {
+			if ubitPattern&1 > 0 {
+				util.BinaryGetFloat64Slice(combinedBuffer[combBufOffset:combBufOffset+pre.k], srcBytes[offset:], pre.byteOrder)
+				offset += int(pre.k) << 3
+			}
+			combBufOffset += pre.k
+		}
+	} else {
+		var totItems int32 = hds.baseBufferCount
+		if levels := util.ComputeNumLevelsNeeded(pre.k, pre.n); levels > 0 {
+			totItems = (2 + levels) * pre.k
+		}
+		util.BinaryGetFloat64Slice(combinedBuffer[:totItems], srcBytes[preBytes:], pre.byteOrder)
+	}
+	hds.combinedBuffer = combinedBuffer
+
+	if err := checkDoublesItems(hds, srcIsCompact && pre.flags&ORDERED_FLAG_MASK > 0); err != nil {
+		return nil, err
+	}
+	return hds, nil
+}
+
+// HeapifyCompactDoublesSketch deserializes bytes of either format into a
+// compact heap sketch.
+func HeapifyCompactDoublesSketch(srcBytes []byte) (*HeapCompactDoublesSketch, error) {
+	pre, err := extractPreamble(srcBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	hcds := newHeapCompactDoublesSketch(pre.k)
+	if pre.empty {
+		return hcds, nil
+	}
+
+	// serialization version 2 is always stored as compact
+	srcIsCompact := pre.serVer == 2 || pre.flags&COMPACT_FLAG_MASK > 0
+	if err := checkStorageBytes(pre.k, pre.n, srcIsCompact, pre.serVer, len(srcBytes)); err != nil {
+		return nil, err
+	}
+
+	hcds.n = pre.n
+	hcds.baseBufferCount = util.ComputeBaseBufferItems(pre.k, pre.n)
+	hcds.bitPattern = util.ComputeBitPattern(pre.k, pre.n)
+	hcds.minValue = util.BinaryGetFloat64(srcBytes[MIN_DOUBLE:], pre.byteOrder)
+	hcds.maxValue = util.BinaryGetFloat64(srcBytes[MAX_DOUBLE:], pre.byteOrder)
+
+	preBytes := computePreambleBytes(pre.serVer)
+	combinedBuffer := make([]float64, util.ComputeRetainedItems(pre.k, pre.n))
+	if srcIsCompact {
+		util.BinaryGetFloat64Slice(combinedBuffer, srcBytes[preBytes:], pre.byteOrder)
+		// the base buffer of serialization version 2 is not necessarily sorted
+		if pre.serVer == 2 || pre.flags&ORDERED_FLAG_MASK == 0 {
+			sort.Float64s(combinedBuffer[:hcds.baseBufferCount])
+		}
+	} else {
+		// load the base buffer and ensure it is sorted
+		util.BinaryGetFloat64Slice(combinedBuffer[:hcds.baseBufferCount], srcBytes[preBytes:], pre.byteOrder)
+		sort.Float64s(combinedBuffer[:hcds.baseBufferCount])
+
+		srcOffset := preBytes + (int(pre.k) << 4)
+		var dstOffset int32 = hcds.baseBufferCount
+		for ubitPattern := uint64(hcds.bitPattern); ubitPattern > 0; ubitPattern >>= 1 {
+			if ubitPattern&1 > 0 {
+				util.BinaryGetFloat64Slice(combinedBuffer[dstOffset:dstOffset+pre.k], srcBytes[srcOffset:], pre.byteOrder)
+				dstOffset += pre.k
+			}
+			srcOffset += int(pre.k) << 3
+		}
+	}
+	hcds.combinedBuffer = combinedBuffer
+
+	if err := checkDoublesItems(hcds, true); err != nil {
+		return nil, err
+	}
+	return hcds, nil
+}
+
+type doublesPreamble struct {
+	preLongs  int32
+	serVer    int32
+	familyID  int32
+	flags     int32
+	k         int32
+	n         int64
+	empty     bool
+	byteOrder binary.ByteOrder
+}
+
+func extractPreamble(srcBytes []byte) (*doublesPreamble, error) {
+	if len(srcBytes) < 8 {
+		return nil, newCorruptSketchError("source bytes too small: %v < 8", len(srcBytes))
+	}
+	flags := int32(srcBytes[FLAGS_BYTE] & 0xFF)
+	byteOrder := flagByteOrder(flags)
+	pre := &doublesPreamble{
+		preLongs:  int32(srcBytes[PREAMBLE_LONGS_BYTE] & 0xFF),
+		serVer:    int32(srcBytes[SER_VER_BYTE] & 0xFF),
+		familyID:  int32(srcBytes[FAMILY_BYTE] & 0xFF),
+		flags:     flags,
+		k:         int32(byteOrder.Uint16(srcBytes[K_SHORT:])),
+		byteOrder: byteOrder,
+	}
+	pre.empty = pre.flags&EMPTY_FLAG_MASK > 0
+
+	if pre.familyID != QUANTILES_FAMILY_ID {
+		return nil, fmt.Errorf("%w: must be %v (got %v)", ErrFamilyMismatch, QUANTILES_FAMILY_ID, pre.familyID)
+	}
+	if pre.serVer < MIN_HEAP_DOUBLES_SER_VER || pre.serVer > DOUBLES_SER_VER {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedSerVer, pre.serVer)
+	}
+	if err := checkHeapFlags(pre.flags); err != nil {
+		return nil, err
+	}
+	if err := checkPreLongsFlagsSerVer(pre.flags, pre.serVer, pre.preLongs); err != nil {
+		return nil, err
+	}
+	// the current version always sets both flags on compact sketches
+	if pre.serVer == DOUBLES_SER_VER && (pre.flags&COMPACT_FLAG_MASK > 0) != (pre.flags&READ_ONLY_FLAG_MASK > 0) {
+		return nil, newCorruptSketchError("compact and read-only flags must be set together (flags %b)", pre.flags)
+	}
+	if !validK(pre.k) {
+		return nil, newCorruptSketchError("k must be a power of 2, not lower than %v and not higher than %v (got %v)", MIN_K, MAX_K, pre.k)
+	}
+
+	if !pre.empty {
+		if preBytes := computePreambleBytes(pre.serVer); len(srcBytes) < preBytes {
+			return nil, newCorruptSketchError("source bytes too small: %v < %v", len(srcBytes), preBytes)
+		}
+		pre.n = int64(byteOrder.Uint64(srcBytes[N_LONG:]))
+		if pre.n <= 0 {
+			return nil, newCorruptSketchError("n must be positive for a non-empty sketch (got %v)", pre.n)
+		}
+	}
+	return pre, nil
+}
+
+// checkDoublesItems checks that min <= max, that all retained items are within
+// [min, max] and that every level is sorted. If bbOrdered is true the base
+// buffer must be sorted as well.
+func checkDoublesItems(sketch DoublesSketch, bbOrdered bool) error {
+	minValue := sketch.GetMinValue()
+	maxValue := sketch.GetMaxValue()
+	if !(minValue <= maxValue) {
+		return newCorruptSketchError("min must be <= max (got %v and %v)", minValue, maxValue)
+	}
+
+	accessor := NewDoublesSketchAccessor(sketch, false)
+	if err := checkDoublesBufferItems(accessor, bbOrdered, minValue, maxValue); err != nil {
+		return err
+	}
+	totalLevels := util.ComputeTotalLevels(sketch.GetBitPattern())
+	for level := int32(0); level < totalLevels; level++ {
+		accessor.SetLevel(level)
+		if err := checkDoublesBufferItems(accessor, true, minValue, maxValue); err != nil {
+			return fmt.Errorf("%w at level %v", err, level)
+		}
+	}
+	return nil
+}
+
+func checkDoublesBufferItems(buf DoublesBufferAccessor, ordered bool, minValue, maxValue float64) error {
+	for i := int32(0); i < buf.NumItems(); i++ {
+		item := buf.Get(i)
+		if !(item >= minValue && item <= maxValue) {
+			return newCorruptSketchError("item %v is not within [%v, %v]", item, minValue, maxValue)
+		}
+		if ordered && i > 0 && item < buf.Get(i-1) {
+			return newCorruptSketchError("items are not sorted")
+		}
+	}
+	return nil
+}
+
+func checkIsCompactMemory(srcBytes []byte) bool {
+	if len(srcBytes) <= FLAGS_BYTE {
+		return false
+	}
+	// serialization version 2 is always stored as compact
+	if srcBytes[SER_VER_BYTE] == 2 {
+		return true
+	}
+	var compactFlags byte = READ_ONLY_FLAG_MASK | COMPACT_FLAG_MASK
+	return srcBytes[FLAGS_BYTE]&compactFlags > 0
+}
+
+func checkHeapFlags(flags int32) error {
+	var allowedFlags int32 = BIG_ENDIAN_FLAG_MASK | READ_ONLY_FLAG_MASK | EMPTY_FLAG_MASK | COMPACT_FLAG_MASK | ORDERED_FLAG_MASK
+	if flags&^allowedFlags > 0 {
+		return newCorruptSketchError("invalid flags field: %b", flags)
+	}
+	return nil
+}
+
+func checkPreLongsFlagsSerVer(flags, serVer, preLongs int32) error {
+	empty := flags&EMPTY_FLAG_MASK > 0
+	compact := flags&COMPACT_FLAG_MASK > 0
+
+	var sw int32 = (serVer & 0xF) << 2
+	sw += (preLongs & 0x3F) << 5
+	if compact {
+		sw += 1
+	}
+	if empty {
+		sw += 2
+	}
+
+	switch sw {
+	case 38: // !compact, empty, serVer = 1, preLongs = 1; always stored as not compact
+	case 164: // !compact, !empty, serVer = 1, preLongs = 5; always stored as not compact
+	case 42: // !compact, empty, serVer = 2, preLongs = 1; always stored as compact
+	case 72: // !compact, !empty, serVer = 2, preLongs = 2; always stored as compact
+	case 47: // compact, empty, serVer = 3, preLongs = 1
+	case 46: // !compact, empty, serVer = 3, preLongs = 1
+	case 79: // compact, empty, serVer = 3, preLongs = 2
+	case 78: // !compact, empty, serVer = 3, preLongs = 2
+	case 77: // compact, !empty, serVer = 3, preLongs = 2
+	case 76: // !compact, !empty, serVer = 3, preLongs = 2
+	default:
+		return newCorruptSketchError("inconsistent state: preamble longs = %v, empty = %v, serialization version = %v, compact = %v",
+			preLongs, empty, serVer, compact)
+	}
+	return nil
+}
+
+func checkStorageBytes(k int32, n int64, compact bool, serVer int32, memCapBytes int) error {
+	var reqBufBytes int64
+	if serVer == DOUBLES_SER_VER {
+		if compact {
+			reqBufBytes = int64(computeCompactStorageBytes(k, n))
+		} else {
+			reqBufBytes = int64(computeUpdateableStorageBytes(k, n))
+		}
+	} else {
+		var metaPre int32 = int32(computePreambleBytes(serVer) >> 3)
+		var retainedItems int32 = util.ComputeRetainedItems(k, n)
+		totLevels := util.ComputeNumLevelsNeeded(k, n)
+		if compact || totLevels == 0 {
+			reqBufBytes = int64(metaPre+retainedItems) << 3
+		} else {
+			reqBufBytes = int64(metaPre+(2+totLevels)*k) << 3
+		}
+	}
+	if int64(memCapBytes) < reqBufBytes {
+		return newCorruptSketchError("source bytes too small: %v < %v", memCapBytes, reqBufBytes)
+	}
+	return nil
+}
+
+// computePreambleBytes returns the number of bytes before the first item,
+// i.e. the preamble plus min and max values. Serialization version 1 stored
+// an additional long with the buffer allocation.
+func computePreambleBytes(serVer int32) int {
+	var extra int = 2
+	if serVer == 1 {
+		extra = 3
+	}
+	return (int(MAX_PRELONGS) + extra) << 3
+}
+
+// UpgradeDoublesSketchBytes deserializes a sketch written in any supported
+// serialization version and serializes it again in the current version,
+// keeping its compact or updatable format and its byte order.
+func UpgradeDoublesSketchBytes(srcBytes []byte) ([]byte, error) {
+	pre, err := extractPreamble(srcBytes)
+	if err != nil {
+		return nil, err
+	}
+	sketch, err := HeapifyDoublesSketch(srcBytes)
+	if err != nil {
+		return nil, err
+	}
+	return sketch.SerializeWithByteOrder(sketch.IsCompact(), pre.byteOrder)
+}
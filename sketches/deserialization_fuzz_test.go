@@ -0,0 +1,100 @@
+package sketches
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func addDoublesSketchSeeds(f *testing.F) {
+	for _, n := range []int{0, 1, 10, 1000, 5000} {
+		sketch, err := NewDoublesSketch(16)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			_ = sketch.Update(float64(i))
+		}
+		for _, compact := range []bool{false, true} {
+			for _, byteOrder := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+				serializedBytes, err := sketch.SerializeWithByteOrder(compact, byteOrder)
+				if err != nil {
+					f.Fatal(err)
+				}
+				f.Add(serializedBytes)
+			}
+		}
+	}
+}
+
+// checkDeserializeError fails unless err is one of the typed errors.
+func checkDeserializeError(t *testing.T, err error) {
+	if !errors.Is(err, ErrCorruptSketch) && !errors.Is(err, ErrFamilyMismatch) && !errors.Is(err, ErrUnsupportedSerVer) {
+		t.Fatalf("untyped error: %v", err)
+	}
+}
+
+// exerciseDoublesSketch runs the read paths of a deserialized sketch, which
+// must neither panic nor fail.
+func exerciseDoublesSketch(t *testing.T, sketch DoublesSketch) {
+	if _, err := sketch.GetQuantiles([]float64{0, 0.5, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sketch.GetCDF([]float64{0, 1}, INCLUSIVE); err != nil {
+		t.Fatal(err)
+	}
+	var totalWeight int64
+	for it := sketch.Iterator(); it.Next(); {
+		totalWeight += it.GetWeight()
+	}
+	if totalWeight != sketch.GetN() {
+		t.Fatalf("total weight %v != n %v", totalWeight, sketch.GetN())
+	}
+	for _, compact := range []bool{false, true} {
+		serializedBytes, err := sketch.SerializeCustom(compact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := HeapifyDoublesSketch(serializedBytes); err != nil {
+			t.Fatalf("cannot heapify re-serialized sketch: %v", err)
+		}
+	}
+}
+
+func FuzzHeapifyDoublesSketch(f *testing.F) {
+	addDoublesSketchSeeds(f)
+	f.Fuzz(func(t *testing.T, srcBytes []byte) {
+		sketch, err := HeapifyDoublesSketch(srcBytes)
+		if err != nil {
+			checkDeserializeError(t, err)
+			return
+		}
+		exerciseDoublesSketch(t, sketch)
+
+		updatable, err := HeapifyUpdatableDoublesSketch(srcBytes)
+		if err != nil {
+			t.Fatalf("cannot heapify as updatable: %v", err)
+		}
+		for i := 0; i < 100; i++ {
+			_ = updatable.Update(float64(i))
+		}
+	})
+}
+
+func FuzzWrapDoublesSketch(f *testing.F) {
+	addDoublesSketchSeeds(f)
+	f.Fuzz(func(t *testing.T, srcBytes []byte) {
+		sketch, err := WrapDoublesSketch(srcBytes)
+		if err != nil {
+			checkDeserializeError(t, err)
+			return
+		}
+		// wrapping does not validate the items, so the wrapped sketch is only
+		// queried once heapifying has checked them
+		if _, err := HeapifyDoublesSketch(srcBytes); err != nil {
+			checkDeserializeError(t, err)
+			return
+		}
+		exerciseDoublesSketch(t, sketch)
+	})
+}
@@ -0,0 +1,204 @@
+package sketches
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HeapifyDoublesSketch", func() {
+	for _, n := range []int{0, 1, 100, 1000, 100000} {
+		n := n
+
+		It("Round-trips an updatable sketch", func() {
+			sketch := newSketchWithRange(defaultK, 0, n)
+			serializedBytes, err := sketch.Serialize()
+			Expect(err).ToNot(HaveOccurred())
+
+			heapified, err := HeapifyDoublesSketch(serializedBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(heapified).To(BeAssignableToTypeOf(&HeapDoublesSketch{}))
+			Expect(heapified.GetN()).To(Equal(int64(n)))
+			Expect(heapified.GetK()).To(Equal(int32(defaultK)))
+
+			reserializedBytes, err := heapified.Serialize()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reserializedBytes).To(Equal(serializedBytes))
+		})
+
+		It("Round-trips a compact sketch", func() {
+			sketch := newSketchWithRange(defaultK, 0, n)
+			serializedBytes, err := sketch.Compact().Serialize()
+			Expect(err).ToNot(HaveOccurred())
+
+			heapified, err := HeapifyDoublesSketch(serializedBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(heapified).To(BeAssignableToTypeOf(&HeapCompactDoublesSketch{}))
+			Expect(heapified.GetN()).To(Equal(int64(n)))
+
+			reserializedBytes, err := heapified.Serialize()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reserializedBytes).To(Equal(serializedBytes))
+		})
+
+		It("Converts between the updatable and compact formats", func() {
+			sketch := newSketchWithRange(defaultK, 0, n)
+			updatableBytes, err := sketch.SerializeCustom(false)
+			Expect(err).ToNot(HaveOccurred())
+			compactBytes, err := sketch.SerializeCustom(true)
+			Expect(err).ToNot(HaveOccurred())
+
+			compact, err := HeapifyCompactDoublesSketch(updatableBytes)
+			Expect(err).ToNot(HaveOccurred())
+			actual, err := compact.Serialize()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(Equal(compactBytes))
+
+			updatable, err := HeapifyUpdatableDoublesSketch(compactBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updatable.Update(42)).To(Succeed())
+			Expect(updatable.GetN()).To(Equal(int64(n + 1)))
+		})
+	}
+
+	It("Rejects invalid input", func() {
+		sketch := newSketchWithRange(defaultK, 0, 1000)
+		serializedBytes, err := sketch.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = HeapifyDoublesSketch(serializedBytes[:4])
+		Expect(err).To(HaveOccurred())
+		_, err = HeapifyDoublesSketch(serializedBytes[:len(serializedBytes)-8])
+		Expect(err).To(HaveOccurred())
+
+		corrupt := func(index int, value byte) []byte {
+			corrupted := make([]byte, len(serializedBytes))
+			copy(corrupted, serializedBytes)
+			corrupted[index] = value
+			return corrupted
+		}
+		_, err = HeapifyDoublesSketch(corrupt(FAMILY_BYTE, 7))
+		Expect(err).To(HaveOccurred())
+		_, err = HeapifyDoublesSketch(corrupt(SER_VER_BYTE, 4))
+		Expect(err).To(HaveOccurred())
+		_, err = HeapifyDoublesSketch(corrupt(PREAMBLE_LONGS_BYTE, 1))
+		Expect(err).To(HaveOccurred())
+		_, err = HeapifyDoublesSketch(corrupt(K_SHORT, 100))
+		Expect(err).To(HaveOccurred())
+		_, err = HeapifyDoublesSketch(corrupt(N_LONG+7, 0x7F))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Returns typed errors", func() {
+		sketch := newSketchWithRange(defaultK, 0, 1000)
+		for _, compact := range []bool{false, true} {
+			serializedBytes, err := sketch.SerializeWithByteOrder(compact, binary.LittleEndian)
+			Expect(err).ToNot(HaveOccurred())
+			corrupt := func(mutate func([]byte)) []byte {
+				corrupted := append([]byte{}, serializedBytes...)
+				mutate(corrupted)
+				return corrupted
+			}
+			expectError := func(srcBytes []byte, target error) {
+				_, err := HeapifyDoublesSketch(srcBytes)
+				Expect(errors.Is(err, target)).To(BeTrue(), "%v", err)
+				_, err = WrapDoublesSketch(srcBytes)
+				Expect(errors.Is(err, target)).To(BeTrue(), "%v", err)
+			}
+
+			expectError(serializedBytes[:4], ErrCorruptSketch)
+			expectError(serializedBytes[:len(serializedBytes)-8], ErrCorruptSketch)
+			expectError(corrupt(func(b []byte) { b[FAMILY_BYTE] = 15 }), ErrFamilyMismatch)
+			expectError(corrupt(func(b []byte) { b[SER_VER_BYTE] = 9 }), ErrUnsupportedSerVer)
+			expectError(corrupt(func(b []byte) { b[PREAMBLE_LONGS_BYTE] = 1 }), ErrCorruptSketch)
+			expectError(corrupt(func(b []byte) { b[K_SHORT] = 100 }), ErrCorruptSketch)
+			expectError(corrupt(func(b []byte) { b[FLAGS_BYTE] ^= READ_ONLY_FLAG_MASK }), ErrCorruptSketch)
+			expectError(corrupt(func(b []byte) { b[FLAGS_BYTE] |= 0x80 }), ErrCorruptSketch)
+
+			_, err = HeapifyDoublesSketch(corrupt(func(b []byte) {
+				util.BinaryPutFloat64(b[MIN_DOUBLE:], binary.LittleEndian, 2000)
+			}))
+			Expect(errors.Is(err, ErrCorruptSketch)).To(BeTrue(), "%v", err)
+			_, err = HeapifyDoublesSketch(corrupt(func(b []byte) {
+				util.BinaryPutFloat64(b[MAX_DOUBLE:], binary.LittleEndian, math.NaN())
+			}))
+			Expect(errors.Is(err, ErrCorruptSketch)).To(BeTrue(), "%v", err)
+			_, err = HeapifyDoublesSketch(corrupt(func(b []byte) {
+				// the first item of the last level is now larger than its successors
+				last := len(b) - int(defaultK)*8
+				util.BinaryPutFloat64(b[last:], binary.LittleEndian, 999)
+			}))
+			Expect(errors.Is(err, ErrCorruptSketch)).To(BeTrue(), "%v", err)
+		}
+	})
+})
+
+// toSerVer1 converts updatable serialization version 3 bytes into version 1,
+// which has 5 preamble longs including the buffer allocation.
+func toSerVer1(serVer3Bytes []byte) []byte {
+	if serVer3Bytes[FLAGS_BYTE]&EMPTY_FLAG_MASK > 0 {
+		serVer1Bytes := append([]byte{}, serVer3Bytes...)
+		serVer1Bytes[SER_VER_BYTE] = 1
+		return serVer1Bytes
+	}
+	serVer1Bytes := make([]byte, 0, len(serVer3Bytes)+8)
+	serVer1Bytes = append(serVer1Bytes, serVer3Bytes[:COMBINED_BUFFER]...)
+	serVer1Bytes = append(serVer1Bytes, make([]byte, 8)...)
+	serVer1Bytes = append(serVer1Bytes, serVer3Bytes[COMBINED_BUFFER:]...)
+	serVer1Bytes[PREAMBLE_LONGS_BYTE] = 5
+	serVer1Bytes[SER_VER_BYTE] = 1
+	return serVer1Bytes
+}
+
+// toSerVer2 converts compact serialization version 3 bytes into version 2,
+// which is always compact but does not set the compact flags.
+func toSerVer2(serVer3Bytes []byte) []byte {
+	serVer2Bytes := append([]byte{}, serVer3Bytes...)
+	serVer2Bytes[SER_VER_BYTE] = 2
+	serVer2Bytes[FLAGS_BYTE] &= EMPTY_FLAG_MASK
+	return serVer2Bytes
+}
+
+var _ = Describe("Older serialization versions", func() {
+	for _, n := range []int{0, 1, 100, 1000, 100000} {
+		n := n
+
+		It("Heapifies and upgrades serialization version 1", func() {
+			sketch := newSketchWithRange(defaultK, 0, n)
+			serVer3Bytes, err := sketch.SerializeCustom(false)
+			Expect(err).ToNot(HaveOccurred())
+
+			heapified, err := HeapifyDoublesSketch(toSerVer1(serVer3Bytes))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(heapified.GetN()).To(Equal(int64(n)))
+			Expect(heapified.IsCompact()).To(BeFalse())
+
+			upgradedBytes, err := UpgradeDoublesSketchBytes(toSerVer1(serVer3Bytes))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(upgradedBytes).To(Equal(serVer3Bytes))
+		})
+
+		It("Heapifies and upgrades serialization version 2", func() {
+			sketch := newSketchWithRange(defaultK, 0, n)
+			serVer3Bytes, err := sketch.SerializeCustom(true)
+			Expect(err).ToNot(HaveOccurred())
+
+			heapified, err := HeapifyDoublesSketch(toSerVer2(serVer3Bytes))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(heapified.GetN()).To(Equal(int64(n)))
+			Expect(heapified.IsCompact()).To(BeTrue())
+
+			updatable, err := HeapifyUpdatableDoublesSketch(toSerVer2(serVer3Bytes))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updatable.GetN()).To(Equal(int64(n)))
+
+			upgradedBytes, err := UpgradeDoublesSketchBytes(toSerVer2(serVer3Bytes))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(upgradedBytes).To(Equal(serVer3Bytes))
+		})
+	}
+})
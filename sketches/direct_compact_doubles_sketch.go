@@ -0,0 +1,170 @@
+package sketches
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+const MIN_DIRECT_DOUBLES_SER_VER int32 = 3
+
+// DirectCompactDoublesSketch is a read-only compact sketch that answers all
+// queries straight from its serialized bytes, without copying them. All
+// mutating methods return ErrSketchReadOnly.
+type DirectCompactDoublesSketch struct {
+	*DoublesSketchImpl
+
+	k         int32
+	mem       []byte
+	byteOrder binary.ByteOrder
+}
+
+// WrapDoublesSketch wraps serialized sketch bytes read-only. Compact bytes
+// are wrapped by a *DirectCompactDoublesSketch, updatable bytes by a
+// read-only *DirectUpdateDoublesSketch. The bytes must not be modified while
+// the returned sketch is in use.
+func WrapDoublesSketch(srcBytes []byte) (DoublesSketch, error) {
+	if checkIsCompactMemory(srcBytes) {
+		return WrapCompactDoublesSketch(srcBytes)
+	}
+	sketch, err := WrapDirectUpdateDoublesSketch(srcBytes, nil)
+	if err != nil {
+		return nil, err
+	}
+	sketch.readOnly = true
+	return sketch, nil
+}
+
+// WrapCompactDoublesSketch wraps compact serialized sketch bytes read-only.
+// The base buffer must be ordered, as it is when serialized by this library.
+func WrapCompactDoublesSketch(srcBytes []byte) (*DirectCompactDoublesSketch, error) {
+	pre, err := extractPreamble(srcBytes)
+	if err != nil {
+		return nil, err
+	}
+	if pre.serVer < MIN_DIRECT_DOUBLES_SER_VER {
+		return nil, fmt.Errorf("%w for a direct sketch: %v", ErrUnsupportedSerVer, pre.serVer)
+	}
+	var compactFlags int32 = COMPACT_FLAG_MASK | ORDERED_FLAG_MASK
+	if !pre.empty && pre.flags&compactFlags != compactFlags {
+		return nil, newCorruptSketchError("must be empty, or compact and ordered (flags %b)", pre.flags)
+	}
+	if err := checkStorageBytes(pre.k, pre.n, true, pre.serVer, len(srcBytes)); err != nil {
+		return nil, err
+	}
+
+	impl := &DoublesSketchImpl{}
+	sketch := &DirectCompactDoublesSketch{
+		DoublesSketchImpl: impl,
+		k:                 pre.k,
+		mem:               srcBytes,
+		byteOrder:         pre.byteOrder,
+	}
+	impl.DoublesSketch = sketch
+	return sketch, nil
+}
+
+func (s *DirectCompactDoublesSketch) IsDirect() bool {
+	return true
+}
+
+func (s *DirectCompactDoublesSketch) IsCompact() bool {
+	return true
+}
+
+func (s *DirectCompactDoublesSketch) IsReadOnly() bool {
+	return true
+}
+
+func (s *DirectCompactDoublesSketch) IsEmpty() bool {
+	return s.GetN() == 0
+}
+
+// GetMemory returns the wrapped bytes.
+func (s *DirectCompactDoublesSketch) GetMemory() []byte {
+	return s.mem
+}
+
+func (s *DirectCompactDoublesSketch) getByteOrder() binary.ByteOrder {
+	return s.byteOrder
+}
+
+// GETS
+
+func (s *DirectCompactDoublesSketch) GetK() int32 {
+	return s.k
+}
+
+func (s *DirectCompactDoublesSketch) GetN() int64 {
+	if len(s.mem) < COMBINED_BUFFER || s.mem[FLAGS_BYTE]&EMPTY_FLAG_MASK > 0 {
+		return 0
+	}
+	return int64(s.byteOrder.Uint64(s.mem[N_LONG:]))
+}
+
+// GetCombinedBuffer returns a copy of the retained items in compact layout.
+func (s *DirectCompactDoublesSketch) GetCombinedBuffer() []float64 {
+	combinedBuffer := make([]float64, util.ComputeRetainedItems(s.k, s.GetN()))
+	if len(combinedBuffer) > 0 {
+		util.BinaryGetFloat64Slice(combinedBuffer, s.mem[COMBINED_BUFFER:], s.byteOrder)
+	}
+	return combinedBuffer
+}
+
+func (s *DirectCompactDoublesSketch) GetBaseBufferCount() int32 {
+	return util.ComputeBaseBufferItems(s.k, s.GetN())
+}
+
+func (s *DirectCompactDoublesSketch) GetBitPattern() int64 {
+	return util.ComputeBitPattern(s.k, s.GetN())
+}
+
+func (s *DirectCompactDoublesSketch) GetMinValue() float64 {
+	if s.IsEmpty() {
+		return math.NaN()
+	}
+	return util.BinaryGetFloat64(s.mem[MIN_DOUBLE:], s.byteOrder)
+}
+
+func (s *DirectCompactDoublesSketch) GetMaxValue() float64 {
+	if s.IsEmpty() {
+		return math.NaN()
+	}
+	return util.BinaryGetFloat64(s.mem[MAX_DOUBLE:], s.byteOrder)
+}
+
+// PUTS
+
+func (s *DirectCompactDoublesSketch) PutK(v int32) error {
+	return ErrSketchReadOnly
+}
+
+func (s *DirectCompactDoublesSketch) PutN(v int64) error {
+	return ErrSketchReadOnly
+}
+
+func (s *DirectCompactDoublesSketch) PutCombinedBuffer(v []float64) error {
+	return ErrSketchReadOnly
+}
+
+func (s *DirectCompactDoublesSketch) PutBaseBufferCount(v int32) error {
+	return ErrSketchReadOnly
+}
+
+func (s *DirectCompactDoublesSketch) PutBitPattern(v int64) error {
+	return ErrSketchReadOnly
+}
+
+func (s *DirectCompactDoublesSketch) PutMinValue(v float64) error {
+	return ErrSketchReadOnly
+}
+
+func (s *DirectCompactDoublesSketch) PutMaxValue(v float64) error {
+	return ErrSketchReadOnly
+}
+
+func (s *DirectCompactDoublesSketch) Update(dataItem float64) error {
+	return ErrSketchReadOnly
+}
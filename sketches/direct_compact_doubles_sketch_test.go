@@ -0,0 +1,96 @@
+package sketches
+
+import (
+	"math"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WrapDoublesSketch", func() {
+	It("Answers queries from compact bytes like the heap sketch", func() {
+		heapSketch := newSketchWithRange(defaultK, 0, 10000)
+		bytes, err := heapSketch.SerializeCustom(true)
+		Expect(err).ToNot(HaveOccurred())
+
+		sketch, err := WrapDoublesSketch(bytes)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sketch).To(BeAssignableToTypeOf(&DirectCompactDoublesSketch{}))
+		Expect(sketch.IsDirect()).To(BeTrue())
+		Expect(sketch.IsCompact()).To(BeTrue())
+		Expect(sketch.GetN()).To(Equal(heapSketch.GetN()))
+		Expect(sketch.GetMinValue()).To(Equal(heapSketch.GetMinValue()))
+		Expect(sketch.GetMaxValue()).To(Equal(heapSketch.GetMaxValue()))
+
+		for _, rank := range []float64{0, 0.1, 0.5, 0.99, 1} {
+			expected, err := heapSketch.GetQuantile(rank)
+			Expect(err).ToNot(HaveOccurred())
+			actual, err := sketch.GetQuantile(rank)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(Equal(expected))
+		}
+		expectRanksWithin(sketch, 10000, 0.02)
+
+		reserialized, err := sketch.SerializeCustom(true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reserialized).To(Equal(bytes))
+	})
+
+	It("Wraps an empty compact sketch", func() {
+		empty, err := NewDoublesSketch(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		bytes, err := empty.SerializeCustom(true)
+		Expect(err).ToNot(HaveOccurred())
+		sketch, err := WrapDoublesSketch(bytes)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sketch.IsEmpty()).To(BeTrue())
+		Expect(math.IsNaN(sketch.GetMinValue())).To(BeTrue())
+		quantile, err := sketch.GetQuantile(0.5)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(math.IsNaN(quantile)).To(BeTrue())
+	})
+
+	It("Wraps updatable bytes read-only", func() {
+		heapSketch := newSketchWithRange(defaultK, 0, 1000)
+		bytes, err := heapSketch.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+
+		sketch, err := WrapDoublesSketch(bytes)
+		Expect(err).ToNot(HaveOccurred())
+		direct, ok := sketch.(*DirectUpdateDoublesSketch)
+		Expect(ok).To(BeTrue())
+		Expect(direct.IsReadOnly()).To(BeTrue())
+		Expect(direct.Update(1)).To(MatchError(ErrSketchReadOnly))
+		Expect(direct.PutN(0)).To(MatchError(ErrSketchReadOnly))
+		Expect(direct.GetN()).To(Equal(int64(1000)))
+	})
+
+	It("Rejects mutation", func() {
+		bytes, err := newSketchWithRange(defaultK, 0, 1000).SerializeCustom(true)
+		Expect(err).ToNot(HaveOccurred())
+		sketch, err := WrapCompactDoublesSketch(bytes)
+		Expect(err).ToNot(HaveOccurred())
+		original := append([]byte{}, bytes...)
+
+		Expect(sketch.Update(1)).To(MatchError(ErrSketchReadOnly))
+		Expect(sketch.PutK(64)).To(MatchError(ErrSketchReadOnly))
+		Expect(sketch.PutN(0)).To(MatchError(ErrSketchReadOnly))
+		Expect(sketch.PutCombinedBuffer([]float64{1})).To(MatchError(ErrSketchReadOnly))
+		Expect(sketch.PutMinValue(0)).To(MatchError(ErrSketchReadOnly))
+		Expect(sketch.PutMaxValue(0)).To(MatchError(ErrSketchReadOnly))
+		Expect(bytes).To(Equal(original))
+	})
+
+	It("Rejects invalid bytes", func() {
+		_, err := WrapDoublesSketch([]byte{1, 2})
+		Expect(err).To(HaveOccurred())
+
+		bytes, err := newSketchWithRange(defaultK, 0, 1000).SerializeCustom(true)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = WrapDoublesSketch(bytes[:len(bytes)-8])
+		Expect(err).To(HaveOccurred())
+
+		_, err = WrapDoublesSketch(toSerVer2(bytes))
+		Expect(err).To(HaveOccurred())
+	})
+})
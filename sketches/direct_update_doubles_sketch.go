@@ -0,0 +1,365 @@
+package sketches
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// MemoryRequestFunc is called by a direct sketch that needs more space than
+// its current byte slice provides. It must return a slice of at least
+// capacityBytes bytes that does not overlap currentMem. The sketch copies its
+// current contents into the returned slice and uses it from then on, so the
+// caller may reuse currentMem afterwards.
+type MemoryRequestFunc func(currentMem []byte, capacityBytes int) ([]byte, error)
+
+// directDoublesSketch is implemented by sketches that live in a byte slice.
+type directDoublesSketch interface {
+	DoublesSketch
+
+	GetMemory() []byte
+	getByteOrder() binary.ByteOrder
+}
+
+func asDirectDoublesSketch(sketch DoublesSketch) directDoublesSketch {
+	if impl, ok := sketch.(*DoublesSketchImpl); ok {
+		sketch = impl.DoublesSketch
+	}
+	return sketch.(directDoublesSketch)
+}
+
+// DirectUpdateDoublesSketch is an updatable sketch that lives entirely in a
+// caller-owned byte slice, using the updatable serialization layout. The
+// slice can be passed to HeapifyDoublesSketch or WrapDirectUpdateDoublesSketch
+// at any time.
+type DirectUpdateDoublesSketch struct {
+	*DoublesSketchImpl
+
+	k         int32
+	mem       []byte
+	memReq    MemoryRequestFunc
+	byteOrder binary.ByteOrder
+	readOnly  bool
+}
+
+// NewDirectUpdateDoublesSketch initializes an empty sketch in mem, which must
+// have at least 8 bytes. When the sketch grows beyond mem, memReq is asked for
+// a larger slice; if memReq is nil a new slice is allocated. The sketch is
+// kept in little-endian byte order, so mem can be shipped to any host.
+func NewDirectUpdateDoublesSketch(k int, mem []byte, memReq MemoryRequestFunc) (*DirectUpdateDoublesSketch, error) {
+	k_ := int32(k)
+	if !validK(k_) {
+		return nil, newSketchesArgumentError("k must be a power of 2, not lower than %v and not higher than %v (got %v)", MIN_K, MAX_K, k)
+	}
+	if reqBytes := computeUpdateableStorageBytes(k_, 0); len(mem) < int(reqBytes) {
+		return nil, fmt.Errorf("memory too small: %v < %v", len(mem), reqBytes)
+	}
+
+	byteOrder := binary.LittleEndian
+	byteOrderFlags, err := byteOrderFlag(byteOrder)
+	if err != nil {
+		return nil, err
+	}
+	sketch := newDirectUpdateDoublesSketch(k_, mem, memReq, byteOrder)
+	for i := 0; i < 8; i++ {
+		mem[i] = 0
+	}
+	insertPre0(mem, byteOrder, MAX_PRELONGS, EMPTY_FLAG_MASK|byteOrderFlags, k_)
+	if len(mem) >= COMBINED_BUFFER {
+		sketch.putN(0)
+		sketch.putMinValue(math.NaN())
+		sketch.putMaxValue(math.NaN())
+	}
+	return sketch, nil
+}
+
+// WrapDirectUpdateDoublesSketch wraps a sketch that was previously created in
+// mem by NewDirectUpdateDoublesSketch or serialized in the updatable format.
+func WrapDirectUpdateDoublesSketch(mem []byte, memReq MemoryRequestFunc) (*DirectUpdateDoublesSketch, error) {
+	pre, err := extractPreamble(mem)
+	if err != nil {
+		return nil, err
+	}
+	if pre.serVer != DOUBLES_SER_VER {
+		return nil, fmt.Errorf("%w for a direct sketch: %v", ErrUnsupportedSerVer, pre.serVer)
+	}
+	if pre.flags&(COMPACT_FLAG_MASK|READ_ONLY_FLAG_MASK) > 0 {
+		return nil, fmt.Errorf("a direct updatable sketch cannot wrap a compact or read-only sketch")
+	}
+	if err := checkStorageBytes(pre.k, pre.n, false, pre.serVer, len(mem)); err != nil {
+		return nil, err
+	}
+	return newDirectUpdateDoublesSketch(pre.k, mem, memReq, pre.byteOrder), nil
+}
+
+func newDirectUpdateDoublesSketch(k int32, mem []byte, memReq MemoryRequestFunc, byteOrder binary.ByteOrder) *DirectUpdateDoublesSketch {
+	impl := &DoublesSketchImpl{}
+	sketch := &DirectUpdateDoublesSketch{
+		DoublesSketchImpl: impl,
+		k:                 k,
+		mem:               mem,
+		memReq:            memReq,
+		byteOrder:         byteOrder,
+	}
+	impl.DoublesSketch = sketch
+	return sketch
+}
+
+func (s *DirectUpdateDoublesSketch) IsDirect() bool {
+	return true
+}
+
+func (s *DirectUpdateDoublesSketch) IsCompact() bool {
+	return false
+}
+
+// IsReadOnly returns true if the sketch was wrapped by WrapDoublesSketch, in
+// which case all mutating methods return ErrSketchReadOnly.
+func (s *DirectUpdateDoublesSketch) IsReadOnly() bool {
+	return s.readOnly
+}
+
+func (s *DirectUpdateDoublesSketch) IsEmpty() bool {
+	return s.GetN() == 0
+}
+
+// GetMemory returns the byte slice the sketch currently lives in, which
+// changes whenever the sketch has grown.
+func (s *DirectUpdateDoublesSketch) GetMemory() []byte {
+	return s.mem
+}
+
+func (s *DirectUpdateDoublesSketch) getByteOrder() binary.ByteOrder {
+	return s.byteOrder
+}
+
+// GETS
+
+func (s *DirectUpdateDoublesSketch) GetK() int32 {
+	return s.k
+}
+
+func (s *DirectUpdateDoublesSketch) GetN() int64 {
+	if len(s.mem) < COMBINED_BUFFER || s.mem[FLAGS_BYTE]&EMPTY_FLAG_MASK > 0 {
+		return 0
+	}
+	return int64(s.byteOrder.Uint64(s.mem[N_LONG:]))
+}
+
+// GetCombinedBuffer returns a copy of the combined buffer in memory.
+func (s *DirectUpdateDoublesSketch) GetCombinedBuffer() []float64 {
+	if s.IsEmpty() {
+		return make([]float64, s.k<<1)
+	}
+	itemCap := util.Intmin(computeCombinedBufferItemCapacity(s.k, s.GetN()), s.getCombinedBufferItemCapacity())
+	combinedBuffer := make([]float64, itemCap)
+	util.BinaryGetFloat64Slice(combinedBuffer, s.mem[COMBINED_BUFFER:], s.byteOrder)
+	return combinedBuffer
+}
+
+func (s *DirectUpdateDoublesSketch) GetBaseBufferCount() int32 {
+	return util.ComputeBaseBufferItems(s.k, s.GetN())
+}
+
+func (s *DirectUpdateDoublesSketch) GetBitPattern() int64 {
+	return util.ComputeBitPattern(s.k, s.GetN())
+}
+
+func (s *DirectUpdateDoublesSketch) GetMinValue() float64 {
+	if len(s.mem) < COMBINED_BUFFER {
+		return math.NaN()
+	}
+	return util.BinaryGetFloat64(s.mem[MIN_DOUBLE:], s.byteOrder)
+}
+
+func (s *DirectUpdateDoublesSketch) GetMaxValue() float64 {
+	if len(s.mem) < COMBINED_BUFFER {
+		return math.NaN()
+	}
+	return util.BinaryGetFloat64(s.mem[MAX_DOUBLE:], s.byteOrder)
+}
+
+// PUTS
+
+func (s *DirectUpdateDoublesSketch) PutK(v int32) error {
+	if s.readOnly {
+		return ErrSketchReadOnly
+	}
+	s.k = v
+	s.byteOrder.PutUint16(s.mem[K_SHORT:], uint16(v))
+	s.resetSortedView()
+	return nil
+}
+
+func (s *DirectUpdateDoublesSketch) PutN(v int64) error {
+	if s.readOnly {
+		return ErrSketchReadOnly
+	}
+	s.putN(v)
+	s.resetSortedView()
+	return nil
+}
+
+func (s *DirectUpdateDoublesSketch) PutCombinedBuffer(v []float64) error {
+	if s.readOnly {
+		return ErrSketchReadOnly
+	}
+	numItems := util.Intmin(int32(len(v)), s.getCombinedBufferItemCapacity())
+	for i := int32(0); i < numItems; i++ {
+		util.BinaryPutFloat64(s.mem[COMBINED_BUFFER+(i<<3):], s.byteOrder, v[i])
+	}
+	s.resetSortedView()
+	return nil
+}
+
+// PutBaseBufferCount is a no-op, as the base buffer count of a direct sketch
+// is derived from n.
+func (s *DirectUpdateDoublesSketch) PutBaseBufferCount(v int32) error {
+	if s.readOnly {
+		return ErrSketchReadOnly
+	}
+	return nil
+}
+
+// PutBitPattern is a no-op, as the bit pattern of a direct sketch is derived
+// from n.
+func (s *DirectUpdateDoublesSketch) PutBitPattern(v int64) error {
+	if s.readOnly {
+		return ErrSketchReadOnly
+	}
+	return nil
+}
+
+func (s *DirectUpdateDoublesSketch) PutMinValue(v float64) error {
+	if s.readOnly {
+		return ErrSketchReadOnly
+	}
+	s.putMinValue(v)
+	s.resetSortedView()
+	return nil
+}
+
+func (s *DirectUpdateDoublesSketch) PutMaxValue(v float64) error {
+	if s.readOnly {
+		return ErrSketchReadOnly
+	}
+	s.putMaxValue(v)
+	s.resetSortedView()
+	return nil
+}
+
+// putN also keeps the empty flag in step with n, as GetN honors the flag.
+func (s *DirectUpdateDoublesSketch) putN(v int64) {
+	s.byteOrder.PutUint64(s.mem[N_LONG:], uint64(v))
+	if v == 0 {
+		s.mem[FLAGS_BYTE] |= EMPTY_FLAG_MASK
+	} else {
+		s.mem[FLAGS_BYTE] &^= EMPTY_FLAG_MASK
+	}
+}
+
+func (s *DirectUpdateDoublesSketch) putMinValue(v float64) {
+	util.BinaryPutFloat64(s.mem[MIN_DOUBLE:], s.byteOrder, v)
+}
+
+func (s *DirectUpdateDoublesSketch) putMaxValue(v float64) {
+	util.BinaryPutFloat64(s.mem[MAX_DOUBLE:], s.byteOrder, v)
+}
+
+func (s *DirectUpdateDoublesSketch) Update(dataItem float64) error {
+	if s.readOnly {
+		return ErrSketchReadOnly
+	}
+	if keep, err := s.items.check(dataItem); !keep {
+		return err
+	}
+
+	var curBBCount int32 = s.GetBaseBufferCount()
+	var newBBCount int32 = curBBCount + 1
+	var curN int64 = s.GetN()
+	var newN int64 = curN + 1
+
+	// must grow the memory before anything is put into it, so that a failed
+	// request leaves the sketch unchanged
+	var itemSpaceNeeded int32 = s.getCombinedBufferItemCapacity()
+	if newBBCount > itemSpaceNeeded {
+		// only happens while the combined buffer is only a base buffer
+		itemSpaceNeeded = 2 * s.k
+	}
+	if newBBCount == (s.k << 1) {
+		// the base buffer plus old levels, and space for the new level
+		if required := computeRequiredItemCapacity(s.k, newN); required > itemSpaceNeeded {
+			itemSpaceNeeded = required
+		}
+	}
+	if itemSpaceNeeded > s.getCombinedBufferItemCapacity() {
+		if err := s.growCombinedMemBuffer(itemSpaceNeeded); err != nil {
+			return err
+		}
+	}
+
+	if curN == 0 {
+		s.putMaxValue(dataItem)
+		s.putMinValue(dataItem)
+	} else {
+		if dataItem > s.GetMaxValue() {
+			s.putMaxValue(dataItem)
+		}
+		if dataItem < s.GetMinValue() {
+			s.putMinValue(dataItem)
+		}
+	}
+
+	util.BinaryPutFloat64(s.mem[COMBINED_BUFFER+(curBBCount<<3):], s.byteOrder, dataItem)
+	// not compact, not ordered, not empty; the byte order is kept
+	s.mem[FLAGS_BYTE] &= BIG_ENDIAN_FLAG_MASK
+
+	if newBBCount == (s.k << 1) {
+		bbAccessor, tgtAccessor, levelAccessor := s.getUpdateAccessors()
+		bbAccessor.SetLevel(BB_LVL_IDX)
+		bbAccessor.Sort()
+
+		var newBitPattern int64 = inPlacePropagateCarry(
+			0,
+			nil,
+			bbAccessor,
+			true,
+			s.k,
+			tgtAccessor,
+			levelAccessor,
+			s.GetBitPattern(),
+			s.getRandom())
+
+		// the bit pattern of a direct sketch is derived from n
+		util.Assert(newBitPattern == util.ComputeBitPattern(s.k, newN), "newBitPattern == util.ComputeBitPattern(s.k, newN)")
+	}
+	s.putN(newN)
+	s.resetSortedView()
+	return nil
+}
+
+func (s *DirectUpdateDoublesSketch) getCombinedBufferItemCapacity() int32 {
+	return int32(util.Intmax(0, int32(len(s.mem))-COMBINED_BUFFER) / 8)
+}
+
+func (s *DirectUpdateDoublesSketch) growCombinedMemBuffer(itemSpaceNeeded int32) error {
+	needBytes := (int(itemSpaceNeeded) << 3) + COMBINED_BUFFER
+	var newMem []byte
+	if s.memReq == nil {
+		newMem = make([]byte, needBytes)
+	} else {
+		var err error
+		newMem, err = s.memReq(s.mem, needBytes)
+		if err != nil {
+			return err
+		}
+		if len(newMem) < needBytes {
+			return fmt.Errorf("requested memory too small: %v < %v", len(newMem), needBytes)
+		}
+	}
+	copy(newMem, s.mem)
+	s.mem = newMem
+	return nil
+}
@@ -0,0 +1,130 @@
+package sketches
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DirectUpdateDoublesSketch", func() {
+	It("Rejects an invalid k or too little memory", func() {
+		_, err := NewDirectUpdateDoublesSketch(100, make([]byte, 1024), nil)
+		Expect(err).To(HaveOccurred())
+		_, err = NewDirectUpdateDoublesSketch(defaultK, make([]byte, 4), nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Serializes like a heap sketch in exact mode", func() {
+		sketch, err := NewDirectUpdateDoublesSketch(defaultK, make([]byte, 8), nil)
+		Expect(err).ToNot(HaveOccurred())
+		heapSketch := newSketchWithRange(defaultK, 0, 100)
+		for i := 0; i < 100; i++ {
+			Expect(sketch.Update(float64(i))).To(Succeed())
+		}
+		Expect(sketch.IsDirect()).To(BeTrue())
+		Expect(sketch.GetN()).To(Equal(int64(100)))
+
+		expected, err := heapSketch.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		actual, err := sketch.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(Equal(expected))
+		expected, err = heapSketch.SerializeCustom(true)
+		Expect(err).ToNot(HaveOccurred())
+		actual, err = sketch.SerializeCustom(true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(Equal(expected))
+	})
+
+	It("Grows through the memory request callback", func() {
+		slab := make([]byte, 1<<20)
+		used := 0
+		requests := 0
+		memReq := func(currentMem []byte, capacityBytes int) ([]byte, error) {
+			requests++
+			mem := slab[used : used+capacityBytes]
+			used += capacityBytes
+			return mem, nil
+		}
+
+		sketch, err := NewDirectUpdateDoublesSketch(defaultK, make([]byte, 8), memReq)
+		Expect(err).ToNot(HaveOccurred())
+		n := 100000
+		for i := 0; i < n; i++ {
+			Expect(sketch.Update(float64(i))).To(Succeed())
+		}
+		Expect(requests).To(BeNumerically(">", 1))
+		Expect(&sketch.GetMemory()[0]).To(Equal(&slab[used-len(sketch.GetMemory())]))
+		expectRanksWithin(sketch, n, 0.02)
+	})
+
+	It("Is left unchanged by a failing memory request", func() {
+		fail := false
+		errNoMemory := errors.New("no memory")
+		memReq := func(currentMem []byte, capacityBytes int) ([]byte, error) {
+			if fail {
+				return nil, errNoMemory
+			}
+			return make([]byte, capacityBytes), nil
+		}
+
+		sketch, err := NewDirectUpdateDoublesSketch(defaultK, make([]byte, 8), memReq)
+		Expect(err).ToNot(HaveOccurred())
+		n := 10000
+		failures := 0
+		for i := 0; i < n; i++ {
+			// every update first runs out of memory, then succeeds
+			before := append([]byte{}, sketch.GetMemory()...)
+			fail = true
+			err := sketch.Update(float64(i))
+			fail = false
+			if err != nil {
+				Expect(err).To(MatchError(errNoMemory))
+				Expect(sketch.GetMemory()).To(Equal(before))
+				failures++
+				Expect(sketch.Update(float64(i))).To(Succeed())
+			}
+		}
+		// the first item, the first compaction and each new level
+		Expect(failures).To(BeNumerically(">", 2))
+		expectRanksWithin(sketch, n, 0.02)
+	})
+
+	It("Can be wrapped and heapified from its memory", func() {
+		sketch, err := NewDirectUpdateDoublesSketch(defaultK, make([]byte, 8), nil)
+		Expect(err).ToNot(HaveOccurred())
+		n := 10000
+		for i := 0; i < n/2; i++ {
+			Expect(sketch.Update(float64(i))).To(Succeed())
+		}
+
+		wrapped, err := WrapDirectUpdateDoublesSketch(sketch.GetMemory(), nil)
+		Expect(err).ToNot(HaveOccurred())
+		for i := n / 2; i < n; i++ {
+			Expect(wrapped.Update(float64(i))).To(Succeed())
+		}
+		expectRanksWithin(wrapped, n, 0.02)
+
+		heapified, err := HeapifyDoublesSketch(wrapped.GetMemory())
+		Expect(err).ToNot(HaveOccurred())
+		expected, err := wrapped.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		actual, err := heapified.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(Equal(expected))
+	})
+
+	It("Can be merged into a union", func() {
+		sketch, err := NewDirectUpdateDoublesSketch(defaultK, make([]byte, 8), nil)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < 50000; i++ {
+			Expect(sketch.Update(float64(i))).To(Succeed())
+		}
+		union, err := NewDoublesUnion(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(union.UpdateSketch(sketch)).To(Succeed())
+		Expect(union.UpdateSketch(newSketchWithRange(defaultK, 50000, 100000))).To(Succeed())
+		expectRanksWithin(union.GetResult(), 100000, 0.02)
+	})
+})
@@ -0,0 +1,43 @@
+package sketches
+
+// DoublesArrayAccessor is a DoublesBufferAccessor over a plain slice, used for
+// scratch buffers during merges.
+type DoublesArrayAccessor struct {
+	buffer []float64
+}
+
+func NewDoublesArrayAccessor(buffer []float64) *DoublesArrayAccessor {
+	return &DoublesArrayAccessor{buffer: buffer}
+}
+
+func InitializeDoublesArrayAccessor(numItems int32) *DoublesArrayAccessor {
+	return NewDoublesArrayAccessor(make([]float64, numItems))
+}
+
+func (acc *DoublesArrayAccessor) NumItems() int32 {
+	return int32(len(acc.buffer))
+}
+
+func (acc *DoublesArrayAccessor) GetArray(fromIdx int32, numItems int32) []float64 {
+	x := make([]float64, numItems)
+	copy(x, acc.buffer[fromIdx:fromIdx+numItems])
+	return x
+}
+
+func (acc *DoublesArrayAccessor) itemSlice(fromIdx int32, numItems int32) []float64 {
+	return acc.buffer[fromIdx : fromIdx+numItems]
+}
+
+func (acc *DoublesArrayAccessor) PutArray(srcArray []float64, srcIndex, dstIndex, numItems int32) {
+	copy(acc.buffer[dstIndex:dstIndex+numItems], srcArray[srcIndex:srcIndex+numItems])
+}
+
+func (acc *DoublesArrayAccessor) Get(index int32) float64 {
+	return acc.buffer[index]
+}
+
+func (acc *DoublesArrayAccessor) Set(index int32, value float64) float64 {
+	oldVal := acc.buffer[index]
+	acc.buffer[index] = value
+	return oldVal
+}
@@ -0,0 +1,191 @@
+package sketches
+
+import (
+	"math"
+	"math/bits"
+	"math/rand"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// mergeInto merges the source sketch into the target sketch. If the source
+// has a larger k than the target, it is downsampled while merging.
+func mergeInto(src DoublesSketch, tgt *HeapDoublesSketch) error {
+	var srcK int32 = src.GetK()
+	var tgtK int32 = tgt.GetK()
+	var srcN int64 = src.GetN()
+	var tgtN int64 = tgt.GetN()
+
+	if srcK != tgtK {
+		return downSamplingMergeInto(src, tgt)
+	}
+
+	srcSketchBuf := NewDoublesSketchAccessor(src, false)
+	var nFinal int64 = tgtN + srcN
+
+	// update only the base buffer
+	for i := int32(0); i < srcSketchBuf.NumItems(); i++ {
+		if err := tgt.Update(srcSketchBuf.Get(i)); err != nil {
+			return err
+		}
+	}
+
+	var spaceNeeded int32 = computeRequiredItemCapacity(tgtK, nFinal)
+	var tgtCombBufItemCap int32 = int32(len(tgt.combinedBuffer))
+	if spaceNeeded > tgtCombBufItemCap {
+		tgt.growCombinedBuffer(tgtCombBufItemCap, spaceNeeded)
+	}
+	tgt.unshareLevels()
+
+	scratch2KAcc := InitializeDoublesArrayAccessor(2 * tgtK)
+
+	var srcBitPattern uint64 = uint64(src.GetBitPattern())
+	util.Assert(int64(srcBitPattern) == srcN/(2*int64(srcK)), "srcBitPattern == srcN / (2 * srcK)")
+
+	tgtSketchBuf := NewDoublesSketchAccessor(tgt, true)
+	var newTgtBitPattern int64 = tgt.GetBitPattern()
+	for srcLvl := int32(0); srcBitPattern != 0; srcLvl++ {
+		if srcBitPattern&1 > 0 {
+			srcSketchBuf.SetLevel(srcLvl)
+			newTgtBitPattern = inPlacePropagateCarry(
+				srcLvl,
+				srcSketchBuf,
+				scratch2KAcc,
+				false,
+				tgtK,
+				tgtSketchBuf,
+				nil,
+				newTgtBitPattern,
+				tgt.getRandom())
+		}
+		srcBitPattern >>= 1
+	}
+
+	tgt.PutN(nFinal)
+	tgt.PutBitPattern(newTgtBitPattern)
+
+	util.Assert(tgt.GetN()/(2*int64(tgtK)) == newTgtBitPattern, "tgt.GetN() / (2 * tgtK) == newTgtBitPattern")
+
+	mergeMinMax(src, tgt)
+	tgt.resetSortedView()
+	return nil
+}
+
+// DownSample returns a new updatable sketch with the smaller k newK that
+// approximates this sketch, zipping each level down by the ratio of the two k
+// values. newK must be a valid k that divides the k of this sketch.
+func (s *DoublesSketchImpl) DownSample(newK int32) (*HeapDoublesSketch, error) {
+	if !validK(newK) {
+		return nil, newSketchesArgumentError("k must be a power of 2, not lower than %v and not higher than %v (got %v)", MIN_K, MAX_K, newK)
+	}
+	if newK > s.GetK() {
+		return nil, newSketchesArgumentError("new k must not be greater than the k of the sketch (got %v > %v)", newK, s.GetK())
+	}
+	newSketch := newHeapDoublesSketch(newK)
+	if err := downSamplingMergeInto(s, newSketch); err != nil {
+		return nil, err
+	}
+	return newSketch, nil
+}
+
+// downSamplingMergeInto merges the source sketch into a target sketch with a
+// smaller k, zipping each source level down by the ratio of the two k values.
+func downSamplingMergeInto(src DoublesSketch, tgt *HeapDoublesSketch) error {
+	var sourceK int32 = src.GetK()
+	var targetK int32 = tgt.GetK()
+	var tgtN int64 = tgt.GetN()
+
+	if sourceK%targetK != 0 {
+		return newSketchesArgumentError("source k must equal target k * 2^(nonnegative integer) (got %v and %v)", sourceK, targetK)
+	}
+
+	var downFactor int32 = sourceK / targetK
+	if !util.IsPowerOf2(downFactor) {
+		return newSketchesArgumentError("source k / target k ratio must be a power of 2 (got %v)", downFactor)
+	}
+	var lgDownFactor int32 = int32(bits.TrailingZeros32(uint32(downFactor)))
+
+	if src.IsEmpty() {
+		return nil
+	}
+
+	srcSketchBuf := NewDoublesSketchAccessor(src, false)
+	var nFinal int64 = tgtN + src.GetN()
+
+	// update only the base buffer
+	for i := int32(0); i < srcSketchBuf.NumItems(); i++ {
+		if err := tgt.Update(srcSketchBuf.Get(i)); err != nil {
+			return err
+		}
+	}
+
+	var spaceNeeded int32 = computeRequiredItemCapacity(targetK, nFinal)
+	var curCombBufCap int32 = int32(len(tgt.combinedBuffer))
+	if spaceNeeded > curCombBufCap {
+		tgt.growCombinedBuffer(curCombBufCap, spaceNeeded)
+	}
+	tgt.unshareLevels()
+
+	scratch2KAcc := InitializeDoublesArrayAccessor(2 * targetK)
+	downBuffer := InitializeDoublesArrayAccessor(targetK)
+
+	tgtSketchBuf := NewDoublesSketchAccessor(tgt, true)
+
+	var srcBitPattern uint64 = uint64(src.GetBitPattern())
+	var newTgtBitPattern int64 = tgt.GetBitPattern()
+	for srcLvl := int32(0); srcBitPattern != 0; srcLvl++ {
+		if srcBitPattern&1 > 0 {
+			srcSketchBuf.SetLevel(srcLvl)
+			justZipWithStride(srcSketchBuf, downBuffer, targetK, downFactor, tgt.getRandom())
+			newTgtBitPattern = inPlacePropagateCarry(
+				srcLvl+lgDownFactor,
+				downBuffer,
+				scratch2KAcc,
+				false,
+				targetK,
+				tgtSketchBuf,
+				nil,
+				newTgtBitPattern,
+				tgt.getRandom())
+			tgt.PutBitPattern(newTgtBitPattern)
+		}
+		srcBitPattern >>= 1
+	}
+
+	tgt.PutN(nFinal)
+
+	util.Assert(tgt.GetN()/(2*int64(targetK)) == newTgtBitPattern, "tgt.GetN() / (2 * targetK) == newTgtBitPattern")
+
+	mergeMinMax(src, tgt)
+	tgt.resetSortedView()
+	return nil
+}
+
+func justZipWithStride(bufA DoublesBufferAccessor, bufC DoublesBufferAccessor, kC int32, stride int32, rnd *rand.Rand) {
+	var a int32 = int32(rnd.Intn(int(stride)))
+	for c := int32(0); c < kC; c++ {
+		bufC.Set(c, bufA.Get(a))
+		a += stride
+	}
+}
+
+func mergeMinMax(src DoublesSketch, tgt *HeapDoublesSketch) {
+	srcMax := src.GetMaxValue()
+	if math.IsNaN(srcMax) {
+		srcMax = math.Inf(-1)
+	}
+	srcMin := src.GetMinValue()
+	if math.IsNaN(srcMin) {
+		srcMin = math.Inf(1)
+	}
+	tgtMax := tgt.GetMaxValue()
+	if math.IsNaN(tgtMax) {
+		tgtMax = math.Inf(-1)
+	}
+	tgtMin := tgt.GetMinValue()
+	if math.IsNaN(tgtMin) {
+		tgtMin = math.Inf(1)
+	}
+	tgt.PutMaxValue(math.Max(srcMax, tgtMax))
+	tgt.PutMinValue(math.Min(srcMin, tgtMin))
+}
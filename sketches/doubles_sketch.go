@@ -1,11 +1,14 @@
 package sketches
 
 import (
+	"encoding/binary"
+
 	"github.com/fluxninja/datasketches-go/sketches/util"
 )
 
 const (
 	DOUBLES_SER_VER     int32 = 3
+	DEFAULT_K           int32 = 128
 	MAX_K               int32 = 32768
 	MIN_K               int32 = 2
 	MIN_PRELONGS        int32 = 1
@@ -16,6 +19,12 @@ const (
 type DoublesSketch interface {
 	Serialize() ([]byte, error)
 	SerializeCustom(bool) ([]byte, error)
+	SerializeWithByteOrder(bool, binary.ByteOrder) ([]byte, error)
+	AppendSerialize([]byte) ([]byte, error)
+	AppendSerializeWithByteOrder([]byte, binary.ByteOrder) ([]byte, error)
+	SerializeInto([]byte) (int, error)
+	SerializeIntoWithByteOrder([]byte, binary.ByteOrder) (int, error)
+	GetSerializedSizeBytes(bool) int
 
 	IsDirect() bool
 	IsCompact() bool
@@ -29,13 +38,31 @@ type DoublesSketch interface {
 	GetMinValue() float64
 	GetMaxValue() float64
 
-	PutK(int32)
-	PutN(int64)
-	PutCombinedBuffer([]float64)
-	PutBaseBufferCount(int32)
-	PutBitPattern(int64)
-	PutMinValue(float64)
-	PutMaxValue(float64)
+	GetSortedView() *DoublesSketchSortedView
+	Iterator() *DoublesSketchIterator
+	DownSample(int32) (*HeapDoublesSketch, error)
+	GetQuantile(float64) (float64, error)
+	GetQuantiles([]float64) ([]float64, error)
+	GetEvenlySpacedQuantiles(int) ([]float64, error)
+	GetRank(float64, QuantileSearchCriteria) (float64, error)
+	GetCDF([]float64, QuantileSearchCriteria) ([]float64, error)
+	GetPMF([]float64, QuantileSearchCriteria) ([]float64, error)
+
+	GetNormalizedRankError(bool) float64
+	GetQuantileLowerBound(float64) (float64, error)
+	GetQuantileUpperBound(float64) (float64, error)
+	GetRankLowerBound(float64) float64
+	GetRankUpperBound(float64) float64
+
+	Validate() error
+
+	PutK(int32) error
+	PutN(int64) error
+	PutCombinedBuffer([]float64) error
+	PutBaseBufferCount(int32) error
+	PutBitPattern(int64) error
+	PutMinValue(float64) error
+	PutMaxValue(float64) error
 }
 
 func validK(k int32) bool {
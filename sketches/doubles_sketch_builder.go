@@ -0,0 +1,173 @@
+package sketches
+
+import (
+	"math/rand"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// DoublesSketchBuilder configures and builds DoublesSketches and
+// DoublesUnions.
+type DoublesSketchBuilder struct {
+	k          int32
+	kErr       error
+	seeded     bool
+	randSeed   int64
+	randSource rand.Source
+	items      itemPolicies
+}
+
+// NewDoublesSketchBuilder returns a builder with k = DEFAULT_K, a random
+// source per sketch, NaN items dropped and infinite items accepted.
+func NewDoublesSketchBuilder() *DoublesSketchBuilder {
+	return &DoublesSketchBuilder{
+		k:     DEFAULT_K,
+		items: itemPolicies{nan: ITEM_DROP, inf: ITEM_ACCEPT},
+	}
+}
+
+// SetK sets k, which must be a power of 2 between MIN_K and MAX_K.
+func (b *DoublesSketchBuilder) SetK(k int) *DoublesSketchBuilder {
+	b.k = int32(k)
+	b.kErr = nil
+	return b
+}
+
+// SetRankError sets k to the smallest value whose normalized rank error is at
+// most epsilon. See GetKFromEpsilon for the meaning of pmf. If no k is small
+// enough, building returns the error.
+func (b *DoublesSketchBuilder) SetRankError(epsilon float64, pmf bool) *DoublesSketchBuilder {
+	b.k, b.kErr = GetKFromEpsilon(epsilon, pmf)
+	return b
+}
+
+// SetRandomSeed sets the seed of the generator that decides which half of the
+// items survives each compaction. Every sketch built afterwards gets its own
+// generator seeded with seed, so the same sequence of updates produces
+// byte-identical sketches, and sketches built from the same builder can be
+// updated independently. Without a seed, each sketch gets its own generator
+// seeded from the global source.
+func (b *DoublesSketchBuilder) SetRandomSeed(seed int64) *DoublesSketchBuilder {
+	b.seeded = true
+	b.randSeed = seed
+	b.randSource = nil
+	return b
+}
+
+// SetRandomSource sets the source that decides which half of the items
+// survives each compaction, replacing any seed. Every sketch built afterwards
+// draws from this same source, so their compactions depend on each other, and
+// since a source is not safe for concurrent use, they must not be updated
+// concurrently. Prefer SetRandomSeed unless the source itself matters, e.g. to
+// record or replay its draws. A nil source gives each sketch its own
+// generator.
+func (b *DoublesSketchBuilder) SetRandomSource(source rand.Source) *DoublesSketchBuilder {
+	b.seeded = false
+	b.randSource = source
+	return b
+}
+
+// SetNaNPolicy sets how Update handles NaN items, either ITEM_DROP or
+// ITEM_REJECT.
+func (b *DoublesSketchBuilder) SetNaNPolicy(policy ItemPolicy) *DoublesSketchBuilder {
+	b.items.nan = policy
+	return b
+}
+
+// SetInfinityPolicy sets how Update handles positive and negative infinity.
+// Accepted infinities become the min or max value of the sketch.
+func (b *DoublesSketchBuilder) SetInfinityPolicy(policy ItemPolicy) *DoublesSketchBuilder {
+	b.items.inf = policy
+	return b
+}
+
+func (b *DoublesSketchBuilder) GetK() int32 {
+	return b.k
+}
+
+func (b *DoublesSketchBuilder) GetNaNPolicy() ItemPolicy {
+	return b.items.nan
+}
+
+func (b *DoublesSketchBuilder) GetInfinityPolicy() ItemPolicy {
+	return b.items.inf
+}
+
+// Build returns a new empty heap sketch.
+func (b *DoublesSketchBuilder) Build() (*HeapDoublesSketch, error) {
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	sketch := newHeapDoublesSketch(b.k)
+	b.configure(sketch.DoublesSketchImpl)
+	return sketch, nil
+}
+
+// BuildDirect returns a new empty sketch that lives in mem. See
+// NewDirectUpdateDoublesSketch for the meaning of mem and memReq.
+func (b *DoublesSketchBuilder) BuildDirect(mem []byte, memReq MemoryRequestFunc) (*DirectUpdateDoublesSketch, error) {
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	sketch, err := NewDirectUpdateDoublesSketch(int(b.k), mem, memReq)
+	if err != nil {
+		return nil, err
+	}
+	b.configure(sketch.DoublesSketchImpl)
+	return sketch, nil
+}
+
+// BuildUnion returns a new empty union with a maximum k of the configured k.
+// With a random seed, the union and the results it returns are reproducible.
+func (b *DoublesSketchBuilder) BuildUnion() (*DoublesUnion, error) {
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	union, err := NewDoublesUnion(int(b.k))
+	if err != nil {
+		return nil, err
+	}
+	union.items = b.items
+	union.rand = b.newRandom()
+	return union, nil
+}
+
+// BuildConcurrent returns a new empty sketch that can be used from many
+// goroutines. See NewConcurrentDoublesSketch for the meaning of numShards.
+func (b *DoublesSketchBuilder) BuildConcurrent(numShards int) (*ConcurrentDoublesSketch, error) {
+	shared, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	return newConcurrentDoublesSketch(shared, numShards), nil
+}
+
+func (b *DoublesSketchBuilder) check() error {
+	if b.kErr != nil {
+		return b.kErr
+	}
+	if err := checkItemPolicies(b.items.nan, b.items.inf); err != nil {
+		return err
+	}
+	if !validK(b.k) {
+		return newSketchesArgumentError("k must be a power of 2, not lower than %v and not higher than %v (got %v)", MIN_K, MAX_K, b.k)
+	}
+	return nil
+}
+
+func (b *DoublesSketchBuilder) configure(impl *DoublesSketchImpl) {
+	impl.items = b.items
+	impl.rand = b.newRandom()
+}
+
+// newRandom returns a new generator over the configured source or seeded with
+// the configured seed, or nil if there is neither.
+func (b *DoublesSketchBuilder) newRandom() *rand.Rand {
+	if b.randSource != nil {
+		return rand.New(b.randSource)
+	}
+	if !b.seeded {
+		return nil
+	}
+	return rand.New(util.NewSplitMix64Source(b.randSeed))
+}
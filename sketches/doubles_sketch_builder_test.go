@@ -0,0 +1,234 @@
+package sketches
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DoublesSketchBuilder", func() {
+	buildSeeded := func(seed int64, n int) *HeapDoublesSketch {
+		sketch, err := NewDoublesSketchBuilder().SetK(64).SetRandomSeed(seed).Build()
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < n; i++ {
+			Expect(sketch.Update(float64(i))).To(Succeed())
+		}
+		return sketch
+	}
+
+	It("Uses the default k", func() {
+		sketch, err := NewDoublesSketchBuilder().Build()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sketch.GetK()).To(Equal(DEFAULT_K))
+	})
+
+	It("Rejects an invalid k", func() {
+		_, err := NewDoublesSketchBuilder().SetK(100).Build()
+		Expect(err).To(HaveOccurred())
+		_, err = NewDoublesSketchBuilder().SetK(0).BuildDirect(make([]byte, 1024), nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Produces byte-identical sketches from the same seed", func() {
+		n := 100000
+		expected, err := buildSeeded(42, n).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		actual, err := buildSeeded(42, n).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(Equal(expected))
+
+		other, err := buildSeeded(43, n).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(other).ToNot(Equal(expected))
+	})
+
+	It("Gives every sketch built from a builder its own generator", func() {
+		n := 100000
+		builder := NewDoublesSketchBuilder().SetK(64).SetRandomSeed(42)
+		sketch1, err := builder.Build()
+		Expect(err).ToNot(HaveOccurred())
+		sketch2, err := builder.Build()
+		Expect(err).ToNot(HaveOccurred())
+		// updates of one sketch must not change the compactions of the other
+		for i := 0; i < n; i++ {
+			Expect(sketch1.Update(float64(i))).To(Succeed())
+			Expect(sketch2.Update(float64(i))).To(Succeed())
+			Expect(sketch2.Update(float64(n + i))).To(Succeed())
+		}
+		expected, err := buildSeeded(42, n).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		actual, err := sketch1.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(Equal(expected))
+	})
+
+	It("Compacts with the injected random source", func() {
+		k := 64
+		source := &countingSource{Source64: util.NewSplitMix64Source(42)}
+		sketch, err := NewDoublesSketchBuilder().SetK(k).SetRandomSource(source).Build()
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < 2*k-1; i++ {
+			Expect(sketch.Update(float64(i))).To(Succeed())
+		}
+		Expect(source.calls).To(BeZero())
+		// the base buffer is full at 2k items, which triggers a compaction
+		Expect(sketch.Update(float64(2*k - 1))).To(Succeed())
+		Expect(source.calls).To(BeNumerically(">", 0))
+
+		n := 100000
+		for i := 2 * k; i < n; i++ {
+			Expect(sketch.Update(float64(i))).To(Succeed())
+		}
+		// a source with the same state as the seeded generator compacts the same way
+		expected, err := buildSeeded(42, n).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		actual, err := sketch.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(Equal(expected))
+	})
+
+	It("Builds unions whose results are reproducible from the same seed", func() {
+		n := 20000
+		unionResult := func(peek bool) []byte {
+			union, err := NewDoublesSketchBuilder().SetK(64).SetRandomSeed(5).BuildUnion()
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < 4; i++ {
+				// merging a larger k downsamples, which also compacts
+				sketch, err := NewDoublesSketchBuilder().SetK(256).SetRandomSeed(int64(i)).Build()
+				Expect(err).ToNot(HaveOccurred())
+				for j := 0; j < n; j++ {
+					Expect(sketch.Update(float64(i*n + j))).To(Succeed())
+				}
+				Expect(union.UpdateSketch(sketch)).To(Succeed())
+				if peek {
+					// results must not draw from the generator of the union
+					Expect(union.GetResult().Update(0)).To(Succeed())
+				}
+			}
+			for j := 0; j < n; j++ {
+				Expect(union.UpdateValue(float64(j))).To(Succeed())
+			}
+			result := union.GetResultAndReset()
+			for j := 0; j < n; j++ {
+				Expect(result.Update(float64(j))).To(Succeed())
+			}
+			serializedBytes, err := result.Serialize()
+			Expect(err).ToNot(HaveOccurred())
+			return serializedBytes
+		}
+		expected := unionResult(false)
+		Expect(unionResult(false)).To(Equal(expected))
+		Expect(unionResult(true)).To(Equal(expected))
+	})
+
+	It("Builds a direct sketch that matches the heap sketch for the same seed", func() {
+		n := 100000
+		direct, err := NewDoublesSketchBuilder().SetK(64).SetRandomSeed(7).BuildDirect(make([]byte, 8), nil)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < n; i++ {
+			Expect(direct.Update(float64(i))).To(Succeed())
+		}
+		expected, err := buildSeeded(7, n).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		actual, err := direct.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(Equal(expected))
+	})
+
+	It("Derives k from the rank error", func() {
+		builder := NewDoublesSketchBuilder().SetRankError(0.015, false)
+		Expect(builder.GetK()).To(Equal(DEFAULT_K))
+		sketch, err := builder.Build()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sketch.GetNormalizedRankError(false)).To(BeNumerically("<=", 0.015))
+
+		_, err = NewDoublesSketchBuilder().SetRankError(1e-6, false).Build()
+		Expect(err).To(BeAssignableToTypeOf(&SketchesArgumentError{}))
+		_, err = NewDoublesSketchBuilder().SetRankError(1e-6, false).SetK(64).Build()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Applies the NaN and infinity policies to every kind of sketch", func() {
+		items := []float64{1, math.NaN(), math.Inf(1), 2, math.Inf(-1)}
+		type updater interface {
+			Update(float64) error
+			GetN() int64
+		}
+		build := func(b *DoublesSketchBuilder) []updater {
+			heap, err := b.Build()
+			Expect(err).ToNot(HaveOccurred())
+			direct, err := b.BuildDirect(make([]byte, 8), nil)
+			Expect(err).ToNot(HaveOccurred())
+			concurrent, err := b.BuildConcurrent(2)
+			Expect(err).ToNot(HaveOccurred())
+			union, err := b.BuildUnion()
+			Expect(err).ToNot(HaveOccurred())
+			return []updater{heap, direct, concurrent, unionUpdater{union}}
+		}
+		expectN := func(b *DoublesSketchBuilder, expectedN int64, expectedErrors int) {
+			for _, sketch := range build(b) {
+				numErrors := 0
+				for _, item := range items {
+					if err := sketch.Update(item); err != nil {
+						Expect(err).To(BeAssignableToTypeOf(&SketchesArgumentError{}))
+						numErrors++
+					}
+				}
+				Expect(sketch.GetN()).To(Equal(expectedN))
+				Expect(numErrors).To(Equal(expectedErrors))
+			}
+		}
+
+		expectN(NewDoublesSketchBuilder(), 4, 0)
+		expectN(NewDoublesSketchBuilder().SetInfinityPolicy(ITEM_DROP), 2, 0)
+		expectN(NewDoublesSketchBuilder().SetNaNPolicy(ITEM_REJECT), 4, 1)
+		expectN(NewDoublesSketchBuilder().SetNaNPolicy(ITEM_REJECT).SetInfinityPolicy(ITEM_REJECT), 2, 3)
+
+		sketch, err := NewDoublesSketchBuilder().Build()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sketch.UpdateBatch(items)).To(Succeed())
+		Expect(sketch.GetMinValue()).To(Equal(math.Inf(-1)))
+		Expect(sketch.GetMaxValue()).To(Equal(math.Inf(1)))
+
+		// a rejected item rejects the whole batch
+		sketch, err = NewDoublesSketchBuilder().SetInfinityPolicy(ITEM_REJECT).Build()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sketch.UpdateBatch(items)).ToNot(Succeed())
+		Expect(sketch.IsEmpty()).To(BeTrue())
+
+		_, err = NewDoublesSketchBuilder().SetNaNPolicy(ITEM_ACCEPT).Build()
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+// countingSource counts the draws from the source it wraps.
+type countingSource struct {
+	rand.Source64
+	calls int
+}
+
+func (s *countingSource) Int63() int64 {
+	s.calls++
+	return s.Source64.Int63()
+}
+
+func (s *countingSource) Uint64() uint64 {
+	s.calls++
+	return s.Source64.Uint64()
+}
+
+type unionUpdater struct {
+	*DoublesUnion
+}
+
+func (u unionUpdater) Update(dataItem float64) error {
+	return u.UpdateValue(dataItem)
+}
+
+func (u unionUpdater) GetN() int64 {
+	return u.GetResult().GetN()
+}
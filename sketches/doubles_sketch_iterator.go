@@ -0,0 +1,55 @@
+package sketches
+
+import "github.com/fluxninja/datasketches-go/sketches/util"
+
+// DoublesSketchIterator walks the items retained by a DoublesSketch: first the
+// base buffer, where every item has weight 1, then each populated level i,
+// where every item has weight 2^(i+1). Items are not in sorted order.
+//
+//	it := sketch.Iterator()
+//	for it.Next() {
+//		value, weight := it.GetValue(), it.GetWeight()
+//	}
+type DoublesSketchIterator struct {
+	accessor  DoublesSketchAccessor
+	numLevels int32
+	level     int32
+	index     int32
+}
+
+// Iterator returns an iterator over the retained items of this sketch. The
+// sketch must not be updated while the iterator is in use.
+func (s *DoublesSketchImpl) Iterator() *DoublesSketchIterator {
+	return &DoublesSketchIterator{
+		accessor:  NewDoublesSketchAccessor(s, false),
+		numLevels: util.ComputeTotalLevels(s.GetBitPattern()),
+		level:     BB_LVL_IDX,
+		index:     -1,
+	}
+}
+
+// Next advances to the next retained item and returns false when there are no
+// more items.
+func (it *DoublesSketchIterator) Next() bool {
+	it.index++
+	for it.index >= it.accessor.NumItems() {
+		if it.level+1 >= it.numLevels {
+			return false
+		}
+		it.level++
+		it.accessor.SetLevel(it.level)
+		it.index = 0
+	}
+	return true
+}
+
+// GetValue returns the value of the current item.
+func (it *DoublesSketchIterator) GetValue() float64 {
+	return it.accessor.Get(it.index)
+}
+
+// GetWeight returns the weight of the current item, i.e. the number of input
+// items it represents.
+func (it *DoublesSketchIterator) GetWeight() int64 {
+	return 1 << (it.level + 1)
+}
@@ -0,0 +1,64 @@
+package sketches
+
+import (
+	"sort"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DoublesSketchIterator", func() {
+	expectIteratorMatchesSortedView := func(sketch DoublesSketch) {
+		var totalWeight int64
+		var values []float64
+		it := sketch.Iterator()
+		for it.Next() {
+			Expect(it.GetWeight()).To(BeNumerically(">", 0))
+			totalWeight += it.GetWeight()
+			values = append(values, it.GetValue())
+		}
+		Expect(it.Next()).To(BeFalse())
+		Expect(totalWeight).To(Equal(sketch.GetN()))
+
+		sort.Float64s(values)
+		if sketch.IsEmpty() {
+			Expect(values).To(BeEmpty())
+		} else {
+			Expect(values).To(Equal(sketch.GetSortedView().GetItems()))
+		}
+	}
+
+	for _, n := range []int{0, 1, 100, 1000, 100000} {
+		n := n
+
+		It("Iterates heap, compact and direct sketches alike", func() {
+			sketch := newSketchWithRange(defaultK, 0, n)
+			expectIteratorMatchesSortedView(sketch)
+			expectIteratorMatchesSortedView(sketch.Compact())
+
+			compactBytes, err := sketch.SerializeCustom(true)
+			Expect(err).ToNot(HaveOccurred())
+			wrapped, err := WrapDoublesSketch(compactBytes)
+			Expect(err).ToNot(HaveOccurred())
+			expectIteratorMatchesSortedView(wrapped)
+
+			updatableBytes, err := sketch.SerializeCustom(false)
+			Expect(err).ToNot(HaveOccurred())
+			direct, err := WrapDirectUpdateDoublesSketch(updatableBytes, nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectIteratorMatchesSortedView(direct)
+		})
+	}
+
+	It("Weights each level by 2^(level+1)", func() {
+		k := 4
+		sketch := newSketchWithRange(k, 0, 3*2*k+1)
+		weights := map[int64]int{}
+		it := sketch.Iterator()
+		for it.Next() {
+			weights[it.GetWeight()]++
+		}
+		// bit pattern 0b11: one item in the base buffer, levels 0 and 1 full
+		Expect(weights).To(Equal(map[int64]int{1: 1, 2: k, 4: k}))
+	})
+})
@@ -0,0 +1,297 @@
+package sketches
+
+import (
+	"math"
+	"sort"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// Rank computations for small N are rounded to this many decimal places
+// before taking the floor or ceiling, so that e.g. 0.3 * 10 maps to 3.
+const TAIL_ROUNDING_FACTOR = 1e7
+
+// FloatItem is the item type of the sketches and sorted views that work on
+// both float32 and float64 items.
+type FloatItem interface {
+	float32 | float64
+}
+
+// SortedView is a sorted view of all items retained by a quantiles sketch of
+// float items, where each item carries the cumulative weight of itself and
+// all smaller items. Once built, every rank and quantile lookup is a binary
+// search.
+type SortedView[T FloatItem] struct {
+	n          int64
+	items      []T
+	cumWeights []int64
+}
+
+// DoublesSketchSortedView is the sorted view of a DoublesSketch or a
+// KllDoublesSketch. In a DoublesSketch, base buffer items have weight 1 and
+// items of level i have weight 2^(i+1).
+type DoublesSketchSortedView = SortedView[float64]
+
+// FloatsSketchSortedView is the sorted view of a KllFloatsSketch or a
+// ReqSketch.
+type FloatsSketchSortedView = SortedView[float32]
+
+// NewDoublesSketchSortedView merges the base buffer and all populated levels
+// of the given sketch into a new sorted view.
+func NewDoublesSketchSortedView(sketch DoublesSketch) *DoublesSketchSortedView {
+	k := sketch.GetK()
+	n := sketch.GetN()
+	numRetained := util.ComputeRetainedItems(k, n)
+	items := make([]float64, numRetained)
+	weights := make([]int64, numRetained)
+
+	accessor := NewDoublesSketchAccessor(sketch, false)
+	bbCount := accessor.NumItems()
+	copy(items, viewItems(accessor, 0, bbCount))
+	sort.Float64s(items[:bbCount])
+	for i := int32(0); i < bbCount; i++ {
+		weights[i] = 1
+	}
+
+	var offset int32 = bbCount
+	var weight int64 = 2
+	ubitPattern := uint64(sketch.GetBitPattern())
+	for level := int32(0); ubitPattern > 0; level++ {
+		if ubitPattern&1 > 0 {
+			accessor.SetLevel(level)
+			copy(items[offset:offset+k], viewItems(accessor, 0, k))
+			for i := offset; i < offset+k; i++ {
+				weights[i] = weight
+			}
+			offset += k
+		}
+		weight <<= 1
+		ubitPattern >>= 1
+	}
+	util.Assert(offset == numRetained, "offset == numRetained")
+
+	blockyTandemMergeSort(items, weights, bbCount, k)
+
+	var cumWeight int64 = 0
+	for i := range weights {
+		cumWeight += weights[i]
+		weights[i] = cumWeight
+	}
+	util.Assert(cumWeight == n, "cumWeight == n")
+
+	return &DoublesSketchSortedView{
+		n:          n,
+		items:      items,
+		cumWeights: weights,
+	}
+}
+
+func (sv *SortedView[T]) IsEmpty() bool {
+	return sv.n == 0
+}
+
+func (sv *SortedView[T]) GetN() int64 {
+	return sv.n
+}
+
+// GetItems returns the retained items in ascending order. The returned slice
+// must not be modified.
+func (sv *SortedView[T]) GetItems() []T {
+	return sv.items
+}
+
+// GetCumulativeWeights returns, for each item of GetItems, the total weight of
+// that item and all items before it. The returned slice must not be modified.
+func (sv *SortedView[T]) GetCumulativeWeights() []int64 {
+	return sv.cumWeights
+}
+
+// GetQuantile returns the approximate quantile of the given normalized rank.
+// An empty view returns NaN.
+func (sv *SortedView[T]) GetQuantile(rank float64, searchCrit QuantileSearchCriteria) (T, error) {
+	if err := checkNormalizedRankBounds(rank); err != nil {
+		return T(math.NaN()), err
+	}
+	if sv.IsEmpty() {
+		return T(math.NaN()), nil
+	}
+	return sv.getQuantile(rank, searchCrit), nil
+}
+
+// GetRank returns the approximate normalized rank of the given value. An
+// empty view returns NaN.
+func (sv *SortedView[T]) GetRank(value T, searchCrit QuantileSearchCriteria) (float64, error) {
+	if sv.IsEmpty() {
+		return math.NaN(), nil
+	}
+	return sv.getRank(value, searchCrit), nil
+}
+
+// GetCDF returns the approximate cumulative distribution function over the
+// intervals defined by splitPoints. An empty view returns nil.
+func (sv *SortedView[T]) GetCDF(splitPoints []T, searchCrit QuantileSearchCriteria) ([]float64, error) {
+	if err := checkSplitPoints(splitPoints); err != nil {
+		return nil, err
+	}
+	if sv.IsEmpty() {
+		return nil, nil
+	}
+	return sv.getCDF(splitPoints, searchCrit), nil
+}
+
+// GetPMF returns the approximate probability mass function over the
+// intervals defined by splitPoints. An empty view returns nil.
+func (sv *SortedView[T]) GetPMF(splitPoints []T, searchCrit QuantileSearchCriteria) ([]float64, error) {
+	if err := checkSplitPoints(splitPoints); err != nil {
+		return nil, err
+	}
+	if sv.IsEmpty() {
+		return nil, nil
+	}
+	return sv.getPMF(splitPoints, searchCrit), nil
+}
+
+func (sv *SortedView[T]) getQuantile(rank float64, searchCrit QuantileSearchCriteria) T {
+	naturalRank := getNaturalRank(rank, sv.n)
+	var index int
+	if searchCrit == INCLUSIVE {
+		ceilRank := int64(math.Ceil(naturalRank))
+		index = sort.Search(len(sv.cumWeights), func(i int) bool {
+			return sv.cumWeights[i] >= ceilRank
+		})
+	} else {
+		floorRank := int64(math.Floor(naturalRank))
+		index = sort.Search(len(sv.cumWeights), func(i int) bool {
+			return sv.cumWeights[i] > floorRank
+		})
+	}
+	if index == len(sv.cumWeights) {
+		return sv.items[len(sv.items)-1]
+	}
+	return sv.items[index]
+}
+
+func (sv *SortedView[T]) getRank(value T, searchCrit QuantileSearchCriteria) float64 {
+	index := sort.Search(len(sv.items), func(i int) bool {
+		if searchCrit == INCLUSIVE {
+			return sv.items[i] > value
+		}
+		return sv.items[i] >= value
+	}) - 1
+	if index < 0 {
+		return 0
+	}
+	return float64(sv.cumWeights[index]) / float64(sv.n)
+}
+
+func (sv *SortedView[T]) getCDF(splitPoints []T, searchCrit QuantileSearchCriteria) []float64 {
+	buckets := make([]float64, len(splitPoints)+1)
+	for i, splitPoint := range splitPoints {
+		buckets[i] = sv.getRank(splitPoint, searchCrit)
+	}
+	buckets[len(splitPoints)] = 1.0
+	return buckets
+}
+
+func (sv *SortedView[T]) getPMF(splitPoints []T, searchCrit QuantileSearchCriteria) []float64 {
+	buckets := sv.getCDF(splitPoints, searchCrit)
+	for i := len(buckets) - 1; i > 0; i-- {
+		buckets[i] -= buckets[i-1]
+	}
+	return buckets
+}
+
+func getNaturalRank(rank float64, n int64) float64 {
+	naturalRank := rank * float64(n)
+	if n <= TAIL_ROUNDING_FACTOR {
+		naturalRank = math.Round(naturalRank*TAIL_ROUNDING_FACTOR) / TAIL_ROUNDING_FACTOR
+	}
+	return naturalRank
+}
+
+// blockyTandemMergeSort sorts items and weights together, given that items
+// already consist of a sorted base buffer run of bbCount items followed by
+// sorted runs of k items each.
+func blockyTandemMergeSort(items []float64, weights []int64, bbCount int32, k int32) {
+	numItems := int32(len(items))
+	if numItems <= 1 {
+		return
+	}
+	runs := make([]int32, 0, 2+(numItems-bbCount)/k)
+	runs = append(runs, 0)
+	if bbCount > 0 {
+		runs = append(runs, bbCount)
+	}
+	for start := bbCount + k; start < numItems; start += k {
+		runs = append(runs, start)
+	}
+	runs = append(runs, numItems)
+	tandemMergeSortRuns(items, weights, runs)
+}
+
+// tandemMergeSortRuns sorts items and weights together, given that the items
+// between consecutive offsets in runs are already sorted. runs starts with 0
+// and ends with len(items).
+func tandemMergeSortRuns[T FloatItem](items []T, weights []int64, runs []int32) {
+	numItems := int32(len(items))
+	if numItems <= 1 {
+		return
+	}
+	tmpItems := make([]T, numItems)
+	tmpWeights := make([]int64, numItems)
+	srcItems, srcWeights := items, weights
+	dstItems, dstWeights := tmpItems, tmpWeights
+	for len(runs) > 2 {
+		merged := runs[:1]
+		var i int
+		for i = 0; i+2 < len(runs); i += 2 {
+			tandemMerge(srcItems, srcWeights, dstItems, dstWeights, runs[i], runs[i+1], runs[i+2])
+			merged = append(merged, runs[i+2])
+		}
+		if i+1 < len(runs) {
+			copy(dstItems[runs[i]:runs[i+1]], srcItems[runs[i]:runs[i+1]])
+			copy(dstWeights[runs[i]:runs[i+1]], srcWeights[runs[i]:runs[i+1]])
+			merged = append(merged, runs[i+1])
+		}
+		runs = merged
+		srcItems, dstItems = dstItems, srcItems
+		srcWeights, dstWeights = dstWeights, srcWeights
+	}
+	if &srcItems[0] != &items[0] {
+		copy(items, srcItems)
+		copy(weights, srcWeights)
+	}
+}
+
+func tandemMerge[T FloatItem](srcItems []T, srcWeights []int64, dstItems []T, dstWeights []int64, start, mid, end int32) {
+	i1, i2, iDst := start, mid, start
+	for i1 < mid && i2 < end {
+		if srcItems[i2] < srcItems[i1] {
+			dstItems[iDst] = srcItems[i2]
+			dstWeights[iDst] = srcWeights[i2]
+			i2++
+		} else {
+			dstItems[iDst] = srcItems[i1]
+			dstWeights[iDst] = srcWeights[i1]
+			i1++
+		}
+		iDst++
+	}
+	copy(dstItems[iDst:end], srcItems[i1:mid])
+	copy(dstWeights[iDst:end], srcWeights[i1:mid])
+	iDst += mid - i1
+	copy(dstItems[iDst:end], srcItems[i2:end])
+	copy(dstWeights[iDst:end], srcWeights[i2:end])
+}
+
+// floatSlice sorts float items in increasing order. The items must not be
+// NaN.
+type floatSlice[T FloatItem] []T
+
+func (x floatSlice[T]) Len() int           { return len(x) }
+func (x floatSlice[T]) Less(i, j int) bool { return x[i] < x[j] }
+func (x floatSlice[T]) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+
+func sortFloats[T FloatItem](items []T) {
+	sort.Sort(floatSlice[T](items))
+}
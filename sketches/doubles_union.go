@@ -0,0 +1,207 @@
+package sketches
+
+import (
+	"math/rand"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// DoublesUnion merges any number of DoublesSketches, including sketches with
+// different k. Sketches with a larger k than the union are downsampled.
+type DoublesUnion struct {
+	maxK   int32
+	items  itemPolicies
+	gadget *HeapDoublesSketch
+	// rand seeds the generators of the gadgets and results, which each get
+	// their own so that they are reproducible independently of each other
+	rand *rand.Rand
+}
+
+func NewDoublesUnion(maxK int) (*DoublesUnion, error) {
+	maxK_ := int32(maxK)
+	if !validK(maxK_) {
+		return nil, newSketchesArgumentError("k must be a power of 2, not lower than %v and not higher than %v (got %v)", MIN_K, MAX_K, maxK)
+	}
+	return &DoublesUnion{maxK: maxK_}, nil
+}
+
+func (u *DoublesUnion) IsEmpty() bool {
+	return u.gadget == nil || u.gadget.IsEmpty()
+}
+
+// GetMaxK returns the configured maximum k of this union.
+func (u *DoublesUnion) GetMaxK() int32 {
+	return u.maxK
+}
+
+// GetEffectiveK returns the k of the internal sketch, which may be smaller
+// than the maximum k after merging a sketch with a smaller k.
+func (u *DoublesUnion) GetEffectiveK() int32 {
+	if u.gadget == nil {
+		return u.maxK
+	}
+	return u.gadget.GetK()
+}
+
+// UpdateSketch merges the given sketch into this union. The given sketch is
+// not modified.
+func (u *DoublesUnion) UpdateSketch(sketch DoublesSketch) error {
+	var rnd *rand.Rand
+	if u.gadget != nil {
+		rnd = u.gadget.getRandom()
+	} else {
+		rnd = u.newRandom()
+	}
+	gadget, err := updateLogic(u.maxK, u.gadget, sketch, rnd)
+	if err != nil {
+		return err
+	}
+	u.gadget = gadget
+	if u.gadget != nil {
+		u.gadget.resetSortedView()
+	}
+	return nil
+}
+
+// UpdateValue updates the union with the given item. By default NaNs are
+// ignored; see DoublesSketchBuilder.SetNaNPolicy and SetInfinityPolicy.
+func (u *DoublesUnion) UpdateValue(dataItem float64) error {
+	if keep, err := u.items.check(dataItem); !keep {
+		return err
+	}
+	if u.gadget == nil {
+		u.gadget = newHeapDoublesSketch(u.maxK)
+		u.gadget.rand = u.newRandom()
+	}
+	return u.gadget.Update(dataItem)
+}
+
+// GetResult returns a copy of the union result, which handles NaN and
+// infinite items like the union. The union can still be updated afterwards.
+// The result gets its own generator, seeded from the one of the union.
+func (u *DoublesUnion) GetResult() *HeapDoublesSketch {
+	var result *HeapDoublesSketch
+	if u.gadget == nil {
+		result = newHeapDoublesSketch(u.maxK)
+		result.rand = u.newRandom()
+	} else {
+		result = copyToHeap(u.gadget, u.newRandom())
+	}
+	result.items = u.items
+	return result
+}
+
+// GetResultAndReset returns the union result without copying it and resets
+// the union.
+func (u *DoublesUnion) GetResultAndReset() *HeapDoublesSketch {
+	if u.gadget == nil {
+		return u.GetResult()
+	}
+	result := u.gadget
+	result.items = u.items
+	u.gadget = nil
+	return result
+}
+
+func (u *DoublesUnion) Reset() {
+	u.gadget = nil
+}
+
+// newRandom returns a new generator for a gadget or a result, seeded from the
+// generator of the union. Unions that were not given a random seed get their
+// own generator, seeded from the global source.
+func (u *DoublesUnion) newRandom() *rand.Rand {
+	if u.rand == nil {
+		u.rand = rand.New(util.NewSplitMix64Source(rand.Int63()))
+	}
+	return rand.New(util.NewSplitMix64Source(u.rand.Int63()))
+}
+
+// updateLogic merges other into the gadget myQS and returns the new gadget.
+// Every sketch it creates uses the generator rnd.
+func updateLogic(myMaxK int32, myQS *HeapDoublesSketch, other DoublesSketch, rnd *rand.Rand) (*HeapDoublesSketch, error) {
+	newGadget := func(k int32) *HeapDoublesSketch {
+		gadget := newHeapDoublesSketch(k)
+		gadget.rand = rnd
+		return gadget
+	}
+	var sw1 int = 0
+	if myQS != nil {
+		if myQS.IsEmpty() {
+			sw1 = 4
+		} else {
+			sw1 = 8
+		}
+	}
+	if other != nil {
+		if other.IsEmpty() {
+			sw1 |= 1
+		} else {
+			sw1 |= 2
+		}
+	}
+
+	switch sw1 {
+	case 0: // myQS = nil, other = nil
+		return nil, nil
+	case 1: // myQS = nil, other = empty
+		return newGadget(util.Intmin(myMaxK, other.GetK())), nil
+	case 2: // myQS = nil, other = valid
+		if !isEstimationMode(other) {
+			// exact mode, only need to copy the base buffer
+			ret := newGadget(myMaxK)
+			if err := updateFromBaseBuffer(ret, other); err != nil {
+				return nil, err
+			}
+			return ret, nil
+		}
+		if myMaxK < other.GetK() {
+			ret := newGadget(myMaxK)
+			if err := downSamplingMergeInto(other, ret); err != nil {
+				return nil, err
+			}
+			return ret, nil
+		}
+		// copy required because the caller still has a handle to other
+		return copyToHeap(other, rnd), nil
+	case 4, 5, 8, 9: // other = nil or empty
+		return myQS, nil
+	case 6, 10: // myQS = empty or valid, other = valid
+		if !isEstimationMode(other) {
+			// exact mode, only need to copy the base buffer
+			if err := updateFromBaseBuffer(myQS, other); err != nil {
+				return nil, err
+			}
+			return myQS, nil
+		}
+		if myQS.GetK() <= other.GetK() {
+			// myQS is smaller or equal, thus the target
+			if err := mergeInto(other, myQS); err != nil {
+				return nil, err
+			}
+			return myQS, nil
+		}
+		// myQS is bigger, so the roles must be reversed. other must be copied
+		// as the caller still has a handle to it.
+		ret := copyToHeap(other, rnd)
+		if err := mergeInto(myQS, ret); err != nil {
+			return nil, err
+		}
+		return ret, nil
+	}
+	return nil, nil
+}
+
+func updateFromBaseBuffer(tgt *HeapDoublesSketch, src DoublesSketch) error {
+	accessor := NewDoublesSketchAccessor(src, false)
+	for i := int32(0); i < accessor.NumItems(); i++ {
+		if err := tgt.Update(accessor.Get(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isEstimationMode(sketch DoublesSketch) bool {
+	return sketch.GetN() >= 2*int64(sketch.GetK())
+}
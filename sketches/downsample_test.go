@@ -0,0 +1,53 @@
+package sketches
+
+import (
+	"github.com/fluxninja/datasketches-go/sketches/util"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DownSample", func() {
+	for _, n := range []int{0, 1, 100, 10000, 100000} {
+		n := n
+
+		It("Approximates the original with a smaller k", func() {
+			var newK int32 = 128
+			sketch := newSketchWithRange(1024, 0, n)
+			for _, source := range []DoublesSketch{sketch, sketch.Compact()} {
+				downSampled, err := source.DownSample(newK)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(downSampled.GetK()).To(Equal(newK))
+				Expect(downSampled.GetN()).To(Equal(int64(n)))
+				Expect(downSampled.GetSortedView().GetItems()).To(HaveLen(int(util.ComputeRetainedItems(newK, int64(n)))))
+				if n > 0 {
+					Expect(downSampled.GetMinValue()).To(Equal(source.GetMinValue()))
+					Expect(downSampled.GetMaxValue()).To(Equal(source.GetMaxValue()))
+				}
+				if n >= 100 {
+					expectRanksWithin(downSampled, n, 2*downSampled.GetNormalizedRankError(false))
+				}
+			}
+			Expect(sketch.GetK()).To(Equal(int32(1024)))
+			Expect(sketch.GetN()).To(Equal(int64(n)))
+		})
+	}
+
+	It("Keeps the same k", func() {
+		sketch := newSketchWithRange(defaultK, 0, 1000)
+		same, err := sketch.DownSample(int32(defaultK))
+		Expect(err).ToNot(HaveOccurred())
+		expected, err := sketch.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		actual, err := same.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(Equal(expected))
+	})
+
+	It("Rejects an invalid or larger k", func() {
+		sketch := newSketchWithRange(defaultK, 0, 1000)
+		_, err := sketch.DownSample(100)
+		Expect(err).To(HaveOccurred())
+		_, err = sketch.DownSample(int32(2 * defaultK))
+		Expect(err).To(HaveOccurred())
+	})
+})
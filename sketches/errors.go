@@ -0,0 +1,41 @@
+package sketches
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrSketchReadOnly is returned by all mutating methods of a sketch wrapped
+// read-only by WrapDoublesSketch.
+var ErrSketchReadOnly = errors.New("sketch is read-only")
+
+// Errors returned when deserializing or wrapping sketch bytes. They are
+// wrapped with details and can be tested for with errors.Is.
+var (
+	// ErrCorruptSketch is returned for bytes that are truncated or do not
+	// describe a valid sketch.
+	ErrCorruptSketch = errors.New("possible corruption")
+	// ErrFamilyMismatch is returned for bytes of a different sketch family.
+	ErrFamilyMismatch = errors.New("family ID mismatch")
+	// ErrUnsupportedSerVer is returned for bytes of a serialization version
+	// that cannot be read.
+	ErrUnsupportedSerVer = errors.New("unsupported serialization version")
+)
+
+func newCorruptSketchError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrCorruptSketch, fmt.Sprintf(format, args...))
+}
+
+// SketchesArgumentError is returned when an argument passed to a sketch is
+// invalid, e.g. a rank outside of [0, 1] or unordered split points.
+type SketchesArgumentError struct {
+	msg string
+}
+
+func newSketchesArgumentError(format string, args ...interface{}) *SketchesArgumentError {
+	return &SketchesArgumentError{msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *SketchesArgumentError) Error() string {
+	return e.msg
+}
@@ -1,6 +1,11 @@
 package sketches
 
-import "github.com/fluxninja/datasketches-go/sketches/util"
+import (
+	"math"
+	"sync"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
 
 type HeapCompactDoublesSketch struct {
 	*DoublesSketchImpl
@@ -12,6 +17,17 @@ type HeapCompactDoublesSketch struct {
 	bitPattern      int64
 	minValue        float64
 	maxValue        float64
+
+	// initLevels, if set, copies the levels of a snapshot into combinedBuffer
+	// on first use
+	initLevels func()
+	initOnce   sync.Once
+}
+
+func (s *HeapCompactDoublesSketch) materialize() {
+	if s.initLevels != nil {
+		s.initOnce.Do(s.initLevels)
+	}
 }
 
 func (s *HeapCompactDoublesSketch) IsDirect() bool {
@@ -37,6 +53,7 @@ func (s *HeapCompactDoublesSketch) GetN() int64 {
 }
 
 func (s *HeapCompactDoublesSketch) GetCombinedBuffer() []float64 {
+	s.materialize()
 	return s.combinedBuffer
 }
 
@@ -58,42 +75,69 @@ func (s *HeapCompactDoublesSketch) GetMaxValue() float64 {
 
 // PUTS
 
-func (s *HeapCompactDoublesSketch) PutK(v int32) {
+func (s *HeapCompactDoublesSketch) PutK(v int32) error {
 	s.k = v
+	s.resetSortedView()
+	return nil
 }
 
-func (s *HeapCompactDoublesSketch) PutN(v int64) {
+func (s *HeapCompactDoublesSketch) PutN(v int64) error {
 	s.n = v
+	s.resetSortedView()
+	return nil
 }
 
-func (s *HeapCompactDoublesSketch) PutCombinedBuffer(v []float64) {
+func (s *HeapCompactDoublesSketch) PutCombinedBuffer(v []float64) error {
+	s.materialize()
 	s.combinedBuffer = v
+	s.resetSortedView()
+	return nil
 }
 
-func (s *HeapCompactDoublesSketch) PutBaseBufferCount(v int32) {
+func (s *HeapCompactDoublesSketch) PutBaseBufferCount(v int32) error {
 	s.baseBufferCount = v
+	s.resetSortedView()
+	return nil
 }
 
-func (s *HeapCompactDoublesSketch) PutBitPattern(v int64) {
+func (s *HeapCompactDoublesSketch) PutBitPattern(v int64) error {
 	s.bitPattern = v
+	s.resetSortedView()
+	return nil
 }
 
-func (s *HeapCompactDoublesSketch) PutMinValue(v float64) {
+func (s *HeapCompactDoublesSketch) PutMinValue(v float64) error {
 	s.minValue = v
+	s.resetSortedView()
+	return nil
 }
 
-func (s *HeapCompactDoublesSketch) PutMaxValue(v float64) {
+func (s *HeapCompactDoublesSketch) PutMaxValue(v float64) error {
 	s.maxValue = v
+	s.resetSortedView()
+	return nil
 }
 
-func FromUpdatableDoublesSketch(s *HeapDoublesSketch) *HeapCompactDoublesSketch {
+func newHeapCompactDoublesSketch(k int32) *HeapCompactDoublesSketch {
 	impl := &DoublesSketchImpl{}
 	hcds := &HeapCompactDoublesSketch{
 		DoublesSketchImpl: impl,
 	}
 	impl.DoublesSketch = hcds
 
-	hcds.k = s.GetK()
+	hcds.k = k
+	hcds.n = 0
+	hcds.combinedBuffer = []float64{}
+	hcds.baseBufferCount = 0
+	hcds.bitPattern = 0
+	hcds.minValue = math.NaN()
+	hcds.maxValue = math.NaN()
+
+	return hcds
+}
+
+func FromUpdatableDoublesSketch(s *HeapDoublesSketch) *HeapCompactDoublesSketch {
+	hcds := newHeapCompactDoublesSketch(s.GetK())
 	hcds.n = s.GetN()
 	hcds.bitPattern = util.ComputeBitPattern(hcds.k, hcds.n)
 	hcds.minValue = s.GetMinValue()
@@ -103,7 +147,7 @@ func FromUpdatableDoublesSketch(s *HeapDoublesSketch) *HeapCompactDoublesSketch
 	combinedBuffer := make([]float64, retainedItems)
 
 	accessor := NewDoublesSketchAccessor(s, false)
-	copy(combinedBuffer[0:hcds.baseBufferCount], accessor.GetArray(0, hcds.baseBufferCount)[0:hcds.baseBufferCount])
+	copy(combinedBuffer[0:hcds.baseBufferCount], viewItems(accessor, 0, hcds.baseBufferCount))
 
 	var combinedBufferOffsets int32 = hcds.baseBufferCount
 	ubitPattern := uint64(hcds.bitPattern)
@@ -111,7 +155,7 @@ func FromUpdatableDoublesSketch(s *HeapDoublesSketch) *HeapCompactDoublesSketch
 	for level := int32(0); ubitPattern > 0; level++ {
 		if ubitPattern&1 > 0 {
 			accessor.SetLevel(level)
-			copy(combinedBuffer[combinedBufferOffsets:combinedBufferOffsets+hcds.k], accessor.GetArray(0, hcds.k)[0:hcds.k])
+			copy(combinedBuffer[combinedBufferOffsets:combinedBufferOffsets+hcds.k], viewItems(accessor, 0, hcds.k))
 			combinedBufferOffsets += hcds.k
 		}
 		ubitPattern >>= 1
@@ -1,8 +1,10 @@
 package sketches
 
 import (
-	"fmt"
 	"math"
+	"math/rand"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
 )
 
 type HeapDoublesSketch struct {
@@ -15,6 +17,10 @@ type HeapDoublesSketch struct {
 	bitPattern      int64
 	minValue        float64
 	maxValue        float64
+
+	// levelsShared is set when a snapshot refers to the levels of
+	// combinedBuffer, which must then be copied before they are next written
+	levelsShared bool
 }
 
 func (s *HeapDoublesSketch) IsDirect() bool {
@@ -61,51 +67,68 @@ func (s *HeapDoublesSketch) GetMaxValue() float64 {
 
 // PUTS
 
-func (s *HeapDoublesSketch) PutK(v int32) {
+func (s *HeapDoublesSketch) PutK(v int32) error {
 	s.k = v
+	s.resetSortedView()
+	return nil
 }
 
-func (s *HeapDoublesSketch) PutN(v int64) {
+func (s *HeapDoublesSketch) PutN(v int64) error {
 	s.n = v
+	s.resetSortedView()
+	return nil
 }
 
-func (s *HeapDoublesSketch) PutCombinedBuffer(v []float64) {
+func (s *HeapDoublesSketch) PutCombinedBuffer(v []float64) error {
 	s.combinedBuffer = v
+	s.resetSortedView()
+	return nil
 }
 
-func (s *HeapDoublesSketch) PutBaseBufferCount(v int32) {
+func (s *HeapDoublesSketch) PutBaseBufferCount(v int32) error {
 	s.baseBufferCount = v
+	s.resetSortedView()
+	return nil
 }
 
-func (s *HeapDoublesSketch) PutBitPattern(v int64) {
+func (s *HeapDoublesSketch) PutBitPattern(v int64) error {
 	s.bitPattern = v
+	s.resetSortedView()
+	return nil
 }
 
-func (s *HeapDoublesSketch) PutMinValue(v float64) {
+func (s *HeapDoublesSketch) PutMinValue(v float64) error {
 	s.minValue = v
+	s.resetSortedView()
+	return nil
 }
 
-func (s *HeapDoublesSketch) PutMaxValue(v float64) {
+func (s *HeapDoublesSketch) PutMaxValue(v float64) error {
 	s.maxValue = v
+	s.resetSortedView()
+	return nil
 }
 
 func NewDoublesSketch(k int) (*HeapDoublesSketch, error) {
-	impl := &DoublesSketchImpl{}
-	sketch := &HeapDoublesSketch{
-		DoublesSketchImpl: impl,
-	}
-	impl.DoublesSketch = sketch
-
 	k_ := int32(k)
 	if k_ == 0 {
-		k_ = 128
+		k_ = DEFAULT_K
 	}
 	if !validK(k_) {
-		return nil, fmt.Errorf("k must be a power of 2, not lower than %v and not higher than %v (got %v)", MIN_K, MAX_K, k)
+		return nil, newSketchesArgumentError("k must be a power of 2, not lower than %v and not higher than %v (got %v)", MIN_K, MAX_K, k)
+	}
+	return newHeapDoublesSketch(k_), nil
+}
+
+func newHeapDoublesSketch(k int32) *HeapDoublesSketch {
+	impl := &DoublesSketchImpl{}
+	sketch := &HeapDoublesSketch{
+		DoublesSketchImpl: impl,
 	}
+	impl.DoublesSketch = sketch
 
 	var baseBufAlloc int32 = 2 * MIN_K
-	sketch.k = k_
+	sketch.k = k
 	sketch.n = 0
 	sketch.combinedBuffer = make([]float64, baseBufAlloc)
 	sketch.baseBufferCount = 0
@@ -113,9 +136,99 @@ func NewDoublesSketch(k int) (*HeapDoublesSketch, error) {
 	sketch.minValue = math.NaN()
 	sketch.maxValue = math.NaN()
 
-	return sketch, nil
+	return sketch
 }
 
 func (s *HeapDoublesSketch) Compact() *HeapCompactDoublesSketch {
 	return FromUpdatableDoublesSketch(s)
 }
+
+// Snapshot returns an immutable compact copy of the current state of the
+// sketch. Unlike Compact, it copies only the base buffer: the levels are
+// shared with this sketch until it next writes them, at which point the sketch
+// copies them first. The levels are copied into the snapshot on its first use,
+// so a caller that serializes updates with a lock only needs to hold it during
+// Snapshot, and may use the snapshot in another goroutine while updates
+// continue.
+func (s *HeapDoublesSketch) Snapshot() *HeapCompactDoublesSketch {
+	hcds := newHeapCompactDoublesSketch(s.k)
+	hcds.n = s.n
+	hcds.bitPattern = s.bitPattern
+	hcds.minValue = s.minValue
+	hcds.maxValue = s.maxValue
+	hcds.baseBufferCount = s.baseBufferCount
+
+	baseBuffer := make([]float64, s.baseBufferCount)
+	copy(baseBuffer, s.combinedBuffer[:s.baseBufferCount])
+	if s.bitPattern == 0 {
+		hcds.combinedBuffer = baseBuffer
+		return hcds
+	}
+
+	k := s.k
+	bitPattern := s.bitPattern
+	levels := s.combinedBuffer
+	s.levelsShared = true
+	hcds.initLevels = func() {
+		combinedBuffer := make([]float64, util.ComputeRetainedItems(k, hcds.n))
+		offset := int32(copy(combinedBuffer, baseBuffer))
+		ubitPattern := uint64(bitPattern)
+		for level := int32(0); ubitPattern > 0; level++ {
+			if ubitPattern&1 > 0 {
+				levelStart := (2 + level) * k
+				copy(combinedBuffer[offset:offset+k], levels[levelStart:levelStart+k])
+				offset += k
+			}
+			ubitPattern >>= 1
+		}
+		hcds.combinedBuffer = combinedBuffer
+	}
+	return hcds
+}
+
+// unshareLevels copies combinedBuffer if its levels are shared with a
+// snapshot. It must be called before the levels are written.
+func (s *HeapDoublesSketch) unshareLevels() {
+	if s.levelsShared {
+		combinedBuffer := make([]float64, len(s.combinedBuffer))
+		copy(combinedBuffer, s.combinedBuffer)
+		s.combinedBuffer = combinedBuffer
+		s.levelsShared = false
+	}
+}
+
+// copyToHeap returns an updatable heap copy of the given sketch, expanding
+// the levels of a compact sketch into the updatable layout. The copy uses the
+// generator rnd.
+func copyToHeap(sketch DoublesSketch, rnd *rand.Rand) *HeapDoublesSketch {
+	qsCopy := newHeapDoublesSketch(sketch.GetK())
+	qsCopy.rand = rnd
+	qsCopy.n = sketch.GetN()
+	qsCopy.minValue = sketch.GetMinValue()
+	qsCopy.maxValue = sketch.GetMaxValue()
+	qsCopy.baseBufferCount = sketch.GetBaseBufferCount()
+	qsCopy.bitPattern = sketch.GetBitPattern()
+
+	if sketch.IsCompact() {
+		combBufItems := computeCombinedBufferItemCapacity(sketch.GetK(), sketch.GetN())
+		qsCopy.combinedBuffer = make([]float64, combBufItems)
+		sketchAccessor := NewDoublesSketchAccessor(sketch, false)
+		copyAccessor := NewDoublesSketchAccessor(qsCopy, false)
+		copyItems(sketchAccessor, 0, copyAccessor, 0, sketchAccessor.NumItems())
+
+		ubitPattern := uint64(sketch.GetBitPattern())
+		for level := int32(0); ubitPattern > 0; level++ {
+			if ubitPattern&1 > 0 {
+				sketchAccessor.SetLevel(level)
+				copyAccessor.SetLevel(level)
+				copyItems(sketchAccessor, 0, copyAccessor, 0, sketchAccessor.NumItems())
+			}
+			ubitPattern >>= 1
+		}
+	} else {
+		combinedBuffer := sketch.GetCombinedBuffer()
+		qsCopy.combinedBuffer = make([]float64, len(combinedBuffer))
+		copy(qsCopy.combinedBuffer, combinedBuffer)
+	}
+	return qsCopy
+}
@@ -0,0 +1,87 @@
+package sketches
+
+import (
+	"math"
+)
+
+// ItemPolicy selects how a sketch handles NaN or infinite items given to
+// Update. The zero value selects the default of the item kind: NaNs are
+// dropped and infinities are accepted.
+type ItemPolicy int32
+
+const (
+	// ITEM_ACCEPT retains the item like any other. NaNs cannot be accepted,
+	// as they have no place in the order of the items.
+	ITEM_ACCEPT ItemPolicy = iota + 1
+	// ITEM_DROP silently ignores the item.
+	ITEM_DROP
+	// ITEM_REJECT ignores the item and returns a *SketchesArgumentError.
+	ITEM_REJECT
+)
+
+func (p ItemPolicy) String() string {
+	switch p {
+	case 0:
+		return "default"
+	case ITEM_ACCEPT:
+		return "accept"
+	case ITEM_DROP:
+		return "drop"
+	case ITEM_REJECT:
+		return "reject"
+	}
+	return "unknown"
+}
+
+// itemPolicies holds the policies of a sketch for NaN and infinite items. Its
+// zero value keeps the behavior of sketches created without a builder.
+type itemPolicies struct {
+	nan ItemPolicy
+	inf ItemPolicy
+}
+
+func checkItemPolicies(nan, inf ItemPolicy) error {
+	if nan != 0 && nan != ITEM_DROP && nan != ITEM_REJECT {
+		return newSketchesArgumentError("NaN items can only be dropped or rejected (got %v)", nan)
+	}
+	if inf < 0 || inf > ITEM_REJECT {
+		return newSketchesArgumentError("invalid policy for infinite items: %v", int32(inf))
+	}
+	return nil
+}
+
+// check returns whether the item is to be retained, or an error if it is
+// rejected.
+func (p itemPolicies) check(dataItem float64) (bool, error) {
+	// only NaN and ±Inf are not zero when subtracted from themselves
+	if dataItem-dataItem == 0 {
+		return true, nil
+	}
+	if math.IsNaN(dataItem) {
+		if p.nan == ITEM_REJECT {
+			return false, newSketchesArgumentError("NaN items are rejected")
+		}
+		return false, nil
+	}
+	switch p.inf {
+	case ITEM_DROP:
+		return false, nil
+	case ITEM_REJECT:
+		return false, newSketchesArgumentError("infinite items are rejected (got %v)", dataItem)
+	}
+	return true, nil
+}
+
+// checkAll returns an error if any of the items is rejected, so that a batch
+// is either applied in full or not at all.
+func (p itemPolicies) checkAll(dataItems []float64) error {
+	if p.nan != ITEM_REJECT && p.inf != ITEM_REJECT {
+		return nil
+	}
+	for _, dataItem := range dataItems {
+		if _, err := p.check(dataItem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package sketches
+
+import (
+	"math/bits"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// itemsMergeInto merges the source sketch into the target sketch. If the
+// source has a larger k than the target, it is downsampled while merging.
+func itemsMergeInto[T any](src *ItemsSketch[T], tgt *ItemsSketch[T]) error {
+	srcK := src.GetK()
+	tgtK := tgt.GetK()
+	if srcK != tgtK {
+		return itemsDownSamplingMergeInto(src, tgt)
+	}
+	if src.IsEmpty() {
+		return nil
+	}
+
+	tgtEmpty := tgt.IsEmpty()
+	nFinal := tgt.GetN() + src.GetN()
+
+	// update only the base buffer
+	for _, item := range src.combinedBuffer[:src.baseBufferCount] {
+		tgt.Update(item)
+	}
+
+	tgt.growCombinedBuffer(computeRequiredItemCapacity(tgtK, nFinal))
+	scratch2KBuf := make([]T, 2*tgtK)
+
+	srcBitPattern := uint64(src.GetBitPattern())
+	util.Assert(int64(srcBitPattern) == src.GetN()/(2*int64(srcK)), "srcBitPattern == srcN / (2 * srcK)")
+
+	for srcLvl := int32(0); srcBitPattern != 0; srcLvl++ {
+		if srcBitPattern&1 > 0 {
+			tgt.bitPattern = itemsInPlacePropagateCarry(srcLvl, src.level(srcLvl), scratch2KBuf, false, tgt)
+		}
+		srcBitPattern >>= 1
+	}
+
+	tgt.n = nFinal
+	util.Assert(tgt.n/(2*int64(tgtK)) == tgt.bitPattern, "tgt.n / (2 * tgtK) == tgt.bitPattern")
+
+	itemsMergeMinMax(src, tgt, tgtEmpty)
+	tgt.sortedView = nil
+	return nil
+}
+
+// DownSample returns a new sketch with the smaller k newK that approximates
+// this sketch, zipping each level down by the ratio of the two k values. newK
+// must be a valid k that divides the k of this sketch.
+func (s *ItemsSketch[T]) DownSample(newK int32) (*ItemsSketch[T], error) {
+	if !validK(newK) {
+		return nil, newSketchesArgumentError("k must be a power of 2, not lower than %v and not higher than %v (got %v)", MIN_K, MAX_K, newK)
+	}
+	if newK > s.k {
+		return nil, newSketchesArgumentError("new k must not be greater than the k of the sketch (got %v > %v)", newK, s.k)
+	}
+	newSketch := newItemsSketch(newK, s.less)
+	if err := itemsDownSamplingMergeInto(s, newSketch); err != nil {
+		return nil, err
+	}
+	return newSketch, nil
+}
+
+// itemsDownSamplingMergeInto merges the source sketch into a target sketch
+// with a smaller k, zipping each source level down by the ratio of the two k
+// values.
+func itemsDownSamplingMergeInto[T any](src *ItemsSketch[T], tgt *ItemsSketch[T]) error {
+	sourceK := src.GetK()
+	targetK := tgt.GetK()
+
+	if sourceK%targetK != 0 {
+		return newSketchesArgumentError("source k must equal target k * 2^(nonnegative integer) (got %v and %v)", sourceK, targetK)
+	}
+	downFactor := sourceK / targetK
+	if !util.IsPowerOf2(downFactor) {
+		return newSketchesArgumentError("source k / target k ratio must be a power of 2 (got %v)", downFactor)
+	}
+	lgDownFactor := int32(bits.TrailingZeros32(uint32(downFactor)))
+
+	if src.IsEmpty() {
+		return nil
+	}
+
+	tgtEmpty := tgt.IsEmpty()
+	nFinal := tgt.GetN() + src.GetN()
+
+	// update only the base buffer
+	for _, item := range src.combinedBuffer[:src.baseBufferCount] {
+		tgt.Update(item)
+	}
+
+	tgt.growCombinedBuffer(computeRequiredItemCapacity(targetK, nFinal))
+	scratch2KBuf := make([]T, 2*targetK)
+	downBuf := make([]T, targetK)
+
+	srcBitPattern := uint64(src.GetBitPattern())
+	for srcLvl := int32(0); srcBitPattern != 0; srcLvl++ {
+		if srcBitPattern&1 > 0 {
+			itemsJustZipWithStride(src.level(srcLvl), downBuf, downFactor, tgt)
+			tgt.bitPattern = itemsInPlacePropagateCarry(srcLvl+lgDownFactor, downBuf, scratch2KBuf, false, tgt)
+		}
+		srcBitPattern >>= 1
+	}
+
+	tgt.n = nFinal
+	util.Assert(tgt.n/(2*int64(targetK)) == tgt.bitPattern, "tgt.n / (2 * targetK) == tgt.bitPattern")
+
+	itemsMergeMinMax(src, tgt, tgtEmpty)
+	tgt.sortedView = nil
+	return nil
+}
+
+func itemsJustZipWithStride[T any](bufA []T, bufC []T, stride int32, tgt *ItemsSketch[T]) {
+	a := int32(tgt.getRandom().Intn(int(stride)))
+	for c := range bufC {
+		bufC[c] = bufA[a]
+		a += stride
+	}
+}
+
+// itemsMergeMinMax updates the min and max of the target sketch with those of
+// the non-empty source sketch. tgtEmpty tells whether the target was empty
+// before the merge, in which case its min and max are not set.
+func itemsMergeMinMax[T any](src *ItemsSketch[T], tgt *ItemsSketch[T], tgtEmpty bool) {
+	if tgtEmpty || tgt.less(tgt.maxValue, src.maxValue) {
+		tgt.maxValue = src.maxValue
+	}
+	if tgtEmpty || tgt.less(src.minValue, tgt.minValue) {
+		tgt.minValue = src.minValue
+	}
+}
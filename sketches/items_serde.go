@@ -0,0 +1,113 @@
+package sketches
+
+import (
+	"encoding/binary"
+	"math"
+	"unicode/utf8"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// ItemsSerDe serializes and deserializes the items of an ItemsSketch. The
+// serialized sketch does not record which SerDe was used, so the same SerDe
+// must be passed to HeapifyItemsSketch as to Serialize.
+type ItemsSerDe[T any] interface {
+	// SerializeToBytes returns the serialized form of items.
+	SerializeToBytes(items []T) ([]byte, error)
+	// DeserializeFromBytes reads numItems items from the start of srcBytes.
+	// It returns an error wrapping ErrCorruptSketch if srcBytes is too short
+	// or does not hold valid items.
+	DeserializeFromBytes(srcBytes []byte, numItems int) ([]T, error)
+}
+
+// ArrayOfStringsSerDe serializes strings as a 4-byte little-endian length
+// followed by the UTF-8 bytes, like ArrayOfStringsSerDe of DataSketches Java.
+type ArrayOfStringsSerDe struct{}
+
+func (ArrayOfStringsSerDe) SerializeToBytes(items []string) ([]byte, error) {
+	size := 0
+	for _, item := range items {
+		size += 4 + len(item)
+	}
+	out := make([]byte, size)
+	offset := 0
+	for _, item := range items {
+		if len(item) > math.MaxInt32 {
+			return nil, newSketchesArgumentError("string too long: %v bytes", len(item))
+		}
+		binary.LittleEndian.PutUint32(out[offset:], uint32(len(item)))
+		offset += 4
+		offset += copy(out[offset:], item)
+	}
+	return out, nil
+}
+
+func (ArrayOfStringsSerDe) DeserializeFromBytes(srcBytes []byte, numItems int) ([]string, error) {
+	// every item takes at least its length
+	if len(srcBytes) < numItems<<2 {
+		return nil, newCorruptSketchError("source length < %v: %v", numItems<<2, len(srcBytes))
+	}
+	items := make([]string, numItems)
+	offset := 0
+	for i := range items {
+		if len(srcBytes)-offset < 4 {
+			return nil, newCorruptSketchError("source length < %v: %v", offset+4, len(srcBytes))
+		}
+		length := int(binary.LittleEndian.Uint32(srcBytes[offset:]))
+		offset += 4
+		if len(srcBytes)-offset < length {
+			return nil, newCorruptSketchError("source length < %v: %v", offset+length, len(srcBytes))
+		}
+		item := srcBytes[offset : offset+length]
+		if !utf8.Valid(item) {
+			return nil, newCorruptSketchError("item %v is not valid UTF-8", i)
+		}
+		items[i] = string(item)
+		offset += length
+	}
+	return items, nil
+}
+
+// ArrayOfLongsSerDe serializes int64 items as 8 little-endian bytes each, like
+// ArrayOfLongsSerDe of DataSketches Java.
+type ArrayOfLongsSerDe struct{}
+
+func (ArrayOfLongsSerDe) SerializeToBytes(items []int64) ([]byte, error) {
+	out := make([]byte, len(items)<<3)
+	for i, item := range items {
+		binary.LittleEndian.PutUint64(out[i<<3:], uint64(item))
+	}
+	return out, nil
+}
+
+func (ArrayOfLongsSerDe) DeserializeFromBytes(srcBytes []byte, numItems int) ([]int64, error) {
+	if len(srcBytes) < numItems<<3 {
+		return nil, newCorruptSketchError("source length < %v: %v", numItems<<3, len(srcBytes))
+	}
+	items := make([]int64, numItems)
+	for i := range items {
+		items[i] = int64(binary.LittleEndian.Uint64(srcBytes[i<<3:]))
+	}
+	return items, nil
+}
+
+// ArrayOfDoublesSerDe serializes float64 items as 8 little-endian bytes each,
+// like ArrayOfDoublesSerDe of DataSketches Java.
+type ArrayOfDoublesSerDe struct{}
+
+func (ArrayOfDoublesSerDe) SerializeToBytes(items []float64) ([]byte, error) {
+	out := make([]byte, len(items)<<3)
+	if err := util.BinaryPutFloat64Slice(out, binary.LittleEndian, items); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (ArrayOfDoublesSerDe) DeserializeFromBytes(srcBytes []byte, numItems int) ([]float64, error) {
+	if len(srcBytes) < numItems<<3 {
+		return nil, newCorruptSketchError("source length < %v: %v", numItems<<3, len(srcBytes))
+	}
+	items := make([]float64, numItems)
+	util.BinaryGetFloat64Slice(items, srcBytes, binary.LittleEndian)
+	return items, nil
+}
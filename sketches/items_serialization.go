@@ -0,0 +1,169 @@
+package sketches
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// ITEMS_DATA_START is the offset of the serialized items, after the preamble
+// and n. ItemsSketch shares the family and serialization version of
+// DoublesSketch.
+const ITEMS_DATA_START = 16
+
+// Serialize serializes the sketch in the ItemsSketch format of DataSketches
+// Java, which is always compact and little-endian: the preamble and n as for
+// a compact DoublesSketch, followed by the items serialized by serDe. The
+// items are min, max, the sorted base buffer and then the populated levels
+// from the lowest.
+func (s *ItemsSketch[T]) Serialize(serDe ItemsSerDe[T]) ([]byte, error) {
+	byteOrder := binary.LittleEndian
+	flags := int32(COMPACT_FLAG_MASK | ORDERED_FLAG_MASK)
+	if s.IsEmpty() {
+		out := make([]byte, 8)
+		insertPre0(out, byteOrder, MIN_PRELONGS, flags|EMPTY_FLAG_MASK, s.k)
+		return out, nil
+	}
+
+	items := make([]T, 0, s.GetNumRetained()+2)
+	items = append(items, s.minValue, s.maxValue)
+	items = append(items, s.combinedBuffer[:s.baseBufferCount]...)
+	s.sortItems(items[2:])
+	ubitPattern := uint64(s.bitPattern)
+	for level := int32(0); ubitPattern > 0; level++ {
+		if ubitPattern&1 > 0 {
+			items = append(items, s.level(level)...)
+		}
+		ubitPattern >>= 1
+	}
+	itemBytes, err := serDe.SerializeToBytes(items)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, ITEMS_DATA_START+len(itemBytes))
+	insertPre0(out, byteOrder, MAX_PRELONGS, flags, s.k)
+	byteOrder.PutUint64(out[N_LONG:], uint64(s.n))
+	copy(out[ITEMS_DATA_START:], itemBytes)
+	return out, nil
+}
+
+// HeapifyItemsSketch returns a new sketch from bytes serialized by Serialize
+// or by ItemsSketch of DataSketches Java. less and serDe must be the ones the
+// sketch was built and serialized with.
+func HeapifyItemsSketch[T any](srcBytes []byte, less func(a, b T) bool, serDe ItemsSerDe[T]) (*ItemsSketch[T], error) {
+	if less == nil {
+		return nil, newSketchesArgumentError("less must not be nil")
+	}
+	if len(srcBytes) < 8 {
+		return nil, newCorruptSketchError("source bytes too small: %v < 8", len(srcBytes))
+	}
+	byteOrder := binary.LittleEndian
+	preLongs := int32(srcBytes[PREAMBLE_LONGS_BYTE])
+	serVer := int32(srcBytes[SER_VER_BYTE])
+	familyID := int32(srcBytes[FAMILY_BYTE])
+	flags := int32(srcBytes[FLAGS_BYTE])
+	k := int32(byteOrder.Uint16(srcBytes[K_SHORT:]))
+
+	if familyID != QUANTILES_FAMILY_ID {
+		return nil, fmt.Errorf("%w: must be %v (got %v)", ErrFamilyMismatch, QUANTILES_FAMILY_ID, familyID)
+	}
+	if serVer != DOUBLES_SER_VER {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedSerVer, serVer)
+	}
+	if err := checkHeapFlags(flags); err != nil {
+		return nil, err
+	}
+	if flags&BIG_ENDIAN_FLAG_MASK > 0 {
+		return nil, newCorruptSketchError("items sketches are always little-endian (flags %b)", flags)
+	}
+	empty := flags&EMPTY_FLAG_MASK > 0
+	expectedPreLongs := MAX_PRELONGS
+	if empty {
+		expectedPreLongs = MIN_PRELONGS
+	}
+	if preLongs != expectedPreLongs {
+		return nil, newCorruptSketchError("preamble longs %v do not match flags %b", preLongs, flags)
+	}
+	if !validK(k) {
+		return nil, newCorruptSketchError("k must be a power of 2, not lower than %v and not higher than %v (got %v)", MIN_K, MAX_K, k)
+	}
+
+	sketch := newItemsSketch(k, less)
+	if empty {
+		return sketch, nil
+	}
+
+	if len(srcBytes) < ITEMS_DATA_START {
+		return nil, newCorruptSketchError("source bytes too small: %v < %v", len(srcBytes), ITEMS_DATA_START)
+	}
+	n := int64(byteOrder.Uint64(srcBytes[N_LONG:]))
+	if n <= 0 {
+		return nil, newCorruptSketchError("n must be positive for a non-empty sketch (got %v)", n)
+	}
+	numItems := util.ComputeRetainedItems(k, n) + 2
+	items, err := serDe.DeserializeFromBytes(srcBytes[ITEMS_DATA_START:], int(numItems))
+	if err != nil {
+		return nil, err
+	}
+	if len(items) != int(numItems) {
+		return nil, newCorruptSketchError("expected %v items, got %v", numItems, len(items))
+	}
+
+	sketch.n = n
+	sketch.minValue = items[0]
+	sketch.maxValue = items[1]
+	sketch.baseBufferCount = util.ComputeBaseBufferItems(k, n)
+	sketch.bitPattern = util.ComputeBitPattern(k, n)
+	sketch.combinedBuffer = make([]T, computeCombinedBufferItemCapacity(k, n))
+	offset := 2 + copy(sketch.combinedBuffer, items[2:2+sketch.baseBufferCount])
+	ubitPattern := uint64(sketch.bitPattern)
+	for level := int32(0); ubitPattern > 0; level++ {
+		if ubitPattern&1 > 0 {
+			offset += copy(sketch.level(level), items[offset:offset+int(k)])
+		}
+		ubitPattern >>= 1
+	}
+
+	baseBuffer := sketch.combinedBuffer[:sketch.baseBufferCount]
+	if flags&ORDERED_FLAG_MASK == 0 {
+		sketch.sortItems(baseBuffer)
+	}
+	if err := sketch.checkItems(); err != nil {
+		return nil, err
+	}
+	return sketch, nil
+}
+
+// checkItems checks that min <= max, that all retained items are within
+// [min, max] and that the base buffer and every level are sorted.
+func (s *ItemsSketch[T]) checkItems() error {
+	if s.less(s.maxValue, s.minValue) {
+		return newCorruptSketchError("min must be <= max")
+	}
+	checkRun := func(items []T) error {
+		for i, item := range items {
+			if s.less(item, s.minValue) || s.less(s.maxValue, item) {
+				return newCorruptSketchError("items must be within [min, max]")
+			}
+			if i > 0 && s.less(item, items[i-1]) {
+				return newCorruptSketchError("items are not sorted")
+			}
+		}
+		return nil
+	}
+	if err := checkRun(s.combinedBuffer[:s.baseBufferCount]); err != nil {
+		return fmt.Errorf("%w in the base buffer", err)
+	}
+	ubitPattern := uint64(s.bitPattern)
+	for level := int32(0); ubitPattern > 0; level++ {
+		if ubitPattern&1 > 0 {
+			if err := checkRun(s.level(level)); err != nil {
+				return fmt.Errorf("%w at level %v", err, level)
+			}
+		}
+		ubitPattern >>= 1
+	}
+	return nil
+}
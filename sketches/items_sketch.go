@@ -0,0 +1,349 @@
+package sketches
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// ItemsSketch is the classic quantiles sketch of DoublesSketch for items of
+// any type T that can be ordered by a less-than function, e.g. strings or
+// fixed-point decimals. It keeps the layout of HeapDoublesSketch: a base
+// buffer of up to 2k items followed by levels of k items each, whose
+// populated levels are given by the bit pattern. less must be a strict weak
+// ordering of all items passed to the sketch.
+type ItemsSketch[T any] struct {
+	k               int32
+	n               int64
+	combinedBuffer  []T
+	baseBufferCount int32
+	bitPattern      int64
+	minValue        T
+	maxValue        T
+	less            func(a, b T) bool
+
+	sortedView *ItemsSketchSortedView[T]
+	rand       *rand.Rand
+}
+
+// NewItemsSketch returns a new empty sketch. k must be a power of 2 between
+// MIN_K and MAX_K, or 0 for DEFAULT_K.
+func NewItemsSketch[T any](k int, less func(a, b T) bool) (*ItemsSketch[T], error) {
+	k_ := int32(k)
+	if k_ == 0 {
+		k_ = DEFAULT_K
+	}
+	if !validK(k_) {
+		return nil, newSketchesArgumentError("k must be a power of 2, not lower than %v and not higher than %v (got %v)", MIN_K, MAX_K, k)
+	}
+	if less == nil {
+		return nil, newSketchesArgumentError("less must not be nil")
+	}
+	return newItemsSketch(k_, less), nil
+}
+
+func newItemsSketch[T any](k int32, less func(a, b T) bool) *ItemsSketch[T] {
+	return &ItemsSketch[T]{
+		k:              k,
+		combinedBuffer: make([]T, 2*MIN_K),
+		less:           less,
+	}
+}
+
+func (s *ItemsSketch[T]) IsEmpty() bool {
+	return s.n == 0
+}
+
+// IsEstimationMode returns true if the sketch has compacted items into levels,
+// and is therefore no longer exact.
+func (s *ItemsSketch[T]) IsEstimationMode() bool {
+	return s.n >= 2*int64(s.k)
+}
+
+func (s *ItemsSketch[T]) GetK() int32 {
+	return s.k
+}
+
+func (s *ItemsSketch[T]) GetN() int64 {
+	return s.n
+}
+
+// GetNumRetained returns the number of items retained by the sketch.
+func (s *ItemsSketch[T]) GetNumRetained() int32 {
+	return util.ComputeRetainedItems(s.k, s.n)
+}
+
+func (s *ItemsSketch[T]) GetBaseBufferCount() int32 {
+	return s.baseBufferCount
+}
+
+func (s *ItemsSketch[T]) GetBitPattern() int64 {
+	return s.bitPattern
+}
+
+// GetMinValue returns the smallest item seen, or the zero value of T if the
+// sketch is empty.
+func (s *ItemsSketch[T]) GetMinValue() T {
+	return s.minValue
+}
+
+// GetMaxValue returns the largest item seen, or the zero value of T if the
+// sketch is empty.
+func (s *ItemsSketch[T]) GetMaxValue() T {
+	return s.maxValue
+}
+
+// GetNormalizedRankError returns the normalized rank error of this sketch. See
+// the package-level GetNormalizedRankError.
+func (s *ItemsSketch[T]) GetNormalizedRankError(pmf bool) float64 {
+	return GetNormalizedRankError(s.k, pmf)
+}
+
+// Reset resets the sketch to the empty state, keeping k.
+func (s *ItemsSketch[T]) Reset() {
+	var zero T
+	s.n = 0
+	s.combinedBuffer = make([]T, 2*MIN_K)
+	s.baseBufferCount = 0
+	s.bitPattern = 0
+	s.minValue = zero
+	s.maxValue = zero
+	s.sortedView = nil
+}
+
+// Update updates the sketch with the given item.
+func (s *ItemsSketch[T]) Update(dataItem T) {
+	if s.n == 0 {
+		s.minValue = dataItem
+		s.maxValue = dataItem
+	} else {
+		if s.less(s.maxValue, dataItem) {
+			s.maxValue = dataItem
+		}
+		if s.less(dataItem, s.minValue) {
+			s.minValue = dataItem
+		}
+	}
+
+	if s.baseBufferCount == int32(len(s.combinedBuffer)) {
+		s.growBaseBuffer()
+	}
+	s.combinedBuffer[s.baseBufferCount] = dataItem
+	s.baseBufferCount++
+	s.n++
+
+	if s.baseBufferCount == 2*s.k {
+		s.propagateFullBaseBuffer()
+	}
+	s.sortedView = nil
+}
+
+// propagateFullBaseBuffer sorts the full base buffer and carries it into the
+// levels. n must already include the base buffer.
+func (s *ItemsSketch[T]) propagateFullBaseBuffer() {
+	s.growCombinedBuffer(computeRequiredItemCapacity(s.k, s.n))
+
+	baseBuffer := s.combinedBuffer[:2*s.k]
+	s.sortItems(baseBuffer)
+	newBitPattern := itemsInPlacePropagateCarry(0, nil, baseBuffer, true, s)
+
+	util.Assert(newBitPattern == util.ComputeBitPattern(s.k, s.n), "newBitPattern == util.ComputeBitPattern(s.k, s.n)")
+	util.Assert(newBitPattern == s.bitPattern+1, "newBitPattern == s.bitPattern + 1")
+
+	s.bitPattern = newBitPattern
+	s.baseBufferCount = 0
+	// release the references held by the base buffer
+	var zero T
+	for i := range baseBuffer {
+		baseBuffer[i] = zero
+	}
+}
+
+func (s *ItemsSketch[T]) growBaseBuffer() {
+	oldSize := int32(len(s.combinedBuffer))
+	util.Assert(oldSize < 2*s.k, "oldSize < 2 * s.k")
+	newSize := 2 * util.Intmax(util.Intmin(s.k, oldSize), MIN_K)
+	combinedBuffer := make([]T, newSize)
+	copy(combinedBuffer, s.combinedBuffer)
+	s.combinedBuffer = combinedBuffer
+}
+
+// growCombinedBuffer grows the combined buffer to hold at least spaceNeeded
+// items.
+func (s *ItemsSketch[T]) growCombinedBuffer(spaceNeeded int32) {
+	if spaceNeeded <= int32(len(s.combinedBuffer)) {
+		return
+	}
+	combinedBuffer := make([]T, spaceNeeded)
+	copy(combinedBuffer, s.combinedBuffer)
+	s.combinedBuffer = combinedBuffer
+}
+
+// level returns the k items of the given level of the combined buffer.
+func (s *ItemsSketch[T]) level(lvl int32) []T {
+	start := (2 + lvl) * s.k
+	return s.combinedBuffer[start : start+s.k]
+}
+
+func (s *ItemsSketch[T]) sortItems(items []T) {
+	sort.Slice(items, func(i, j int) bool {
+		return s.less(items[i], items[j])
+	})
+}
+
+// getRandom returns the generator used to pick which half of the items
+// survives a compaction, seeded from the global source on first use.
+func (s *ItemsSketch[T]) getRandom() *rand.Rand {
+	if s.rand == nil {
+		s.rand = rand.New(util.NewSplitMix64Source(rand.Int63()))
+	}
+	return s.rand
+}
+
+// copy returns a deep copy of the sketch.
+func (s *ItemsSketch[T]) copy() *ItemsSketch[T] {
+	sketchCopy := newItemsSketch(s.k, s.less)
+	sketchCopy.n = s.n
+	sketchCopy.combinedBuffer = make([]T, len(s.combinedBuffer))
+	copy(sketchCopy.combinedBuffer, s.combinedBuffer)
+	sketchCopy.baseBufferCount = s.baseBufferCount
+	sketchCopy.bitPattern = s.bitPattern
+	sketchCopy.minValue = s.minValue
+	sketchCopy.maxValue = s.maxValue
+	return sketchCopy
+}
+
+// itemsInPlacePropagateCarry is the ItemsSketch counterpart of
+// inPlacePropagateCarry. The update version zips size2KBuf into the new
+// level, while the merge version copies optSrcKBuf into it; size2KBuf is
+// scratch space for the carries in both cases. It returns the new bit pattern
+// of the sketch, which the caller must store.
+func itemsInPlacePropagateCarry[T any](
+	startingLevel int32,
+	optSrcKBuf []T,
+	size2KBuf []T,
+	doUpdateVersion bool,
+	sketch *ItemsSketch[T],
+) int64 {
+	bitPattern := sketch.bitPattern
+	endingLevel := util.LowestZeroBitStartingAt(bitPattern, startingLevel)
+	tgtLevel := sketch.level(endingLevel)
+	if doUpdateVersion {
+		itemsZipSize2KBuffer(size2KBuf, tgtLevel, sketch.getRandom())
+	} else {
+		util.Assert(optSrcKBuf != nil, "optSrcKBuf != nil")
+		copy(tgtLevel, optSrcKBuf[:sketch.k])
+	}
+
+	var zero T
+	for lvl := startingLevel; lvl < endingLevel; lvl++ {
+		util.Assert((bitPattern&(1<<lvl)) > 0, "(bitPattern & (1 << lvl)) > 0")
+		currLevel := sketch.level(lvl)
+		itemsMergeTwoSizeKBuffers(currLevel, tgtLevel, size2KBuf, sketch.less)
+		itemsZipSize2KBuffer(size2KBuf, tgtLevel, sketch.getRandom())
+		// release the references held by the carried level
+		for i := range currLevel {
+			currLevel[i] = zero
+		}
+	}
+
+	return bitPattern + (1 << startingLevel)
+}
+
+func itemsZipSize2KBuffer[T any](bufIn []T, bufOut []T, rnd *rand.Rand) {
+	idxIn := rnd.Intn(2)
+	for idxOut := range bufOut {
+		bufOut[idxOut] = bufIn[idxIn]
+		idxIn += 2
+	}
+}
+
+func itemsMergeTwoSizeKBuffers[T any](src1, src2, dst []T, less func(a, b T) bool) {
+	util.Assert(len(src1) == len(src2), "len(src1) == len(src2)")
+	k := len(src1)
+	i1, i2, iDst := 0, 0, 0
+	for i1 < k && i2 < k {
+		if less(src2[i2], src1[i1]) {
+			dst[iDst] = src2[i2]
+			i2++
+		} else {
+			dst[iDst] = src1[i1]
+			i1++
+		}
+		iDst++
+	}
+
+	if i1 < k {
+		copy(dst[iDst:], src1[i1:])
+	} else {
+		copy(dst[iDst:], src2[i2:])
+	}
+}
+
+// GetSortedView returns the sorted view of this sketch. The view is built on
+// first use and cached until the sketch is next updated, so it must not be
+// called concurrently with updates.
+func (s *ItemsSketch[T]) GetSortedView() *ItemsSketchSortedView[T] {
+	if s.sortedView == nil {
+		s.sortedView = NewItemsSketchSortedView(s)
+	}
+	return s.sortedView
+}
+
+// GetQuantile returns the approximate quantile of the given normalized rank,
+// which must be in the range [0, 1]. An empty sketch returns the zero value of
+// T.
+func (s *ItemsSketch[T]) GetQuantile(rank float64) (T, error) {
+	return s.GetSortedView().GetQuantile(rank, INCLUSIVE)
+}
+
+// GetQuantiles returns the approximate quantiles of the given normalized
+// ranks. An empty sketch returns nil.
+func (s *ItemsSketch[T]) GetQuantiles(ranks []float64) ([]T, error) {
+	for _, rank := range ranks {
+		if err := checkNormalizedRankBounds(rank); err != nil {
+			return nil, err
+		}
+	}
+	if s.IsEmpty() {
+		return nil, nil
+	}
+	sortedView := s.GetSortedView()
+	quantiles := make([]T, len(ranks))
+	for i, rank := range ranks {
+		quantiles[i] = sortedView.getQuantile(rank, INCLUSIVE)
+	}
+	return quantiles, nil
+}
+
+// GetEvenlySpacedQuantiles returns num quantiles at evenly spaced normalized
+// ranks from 0 to 1 inclusive. num must be at least 2.
+func (s *ItemsSketch[T]) GetEvenlySpacedQuantiles(num int) ([]T, error) {
+	if num < 2 {
+		return nil, newSketchesArgumentError("num must be >= 2 (got %v)", num)
+	}
+	return s.GetQuantiles(evenlySpacedRanks(num))
+}
+
+// GetRank returns the approximate normalized rank of the given value. With
+// INCLUSIVE search criteria the weight of items equal to value is included.
+// An empty sketch returns NaN.
+func (s *ItemsSketch[T]) GetRank(value T, searchCrit QuantileSearchCriteria) (float64, error) {
+	return s.GetSortedView().GetRank(value, searchCrit)
+}
+
+// GetCDF returns the approximate cumulative distribution function over the
+// intervals defined by splitPoints, which must be unique and monotonically
+// increasing. The last entry of the result is always 1. An empty sketch
+// returns nil.
+func (s *ItemsSketch[T]) GetCDF(splitPoints []T, searchCrit QuantileSearchCriteria) ([]float64, error) {
+	return s.GetSortedView().GetCDF(splitPoints, searchCrit)
+}
+
+// GetPMF returns the approximate probability mass function over the
+// len(splitPoints)+1 intervals defined by splitPoints, which must be unique
+// and monotonically increasing. An empty sketch returns nil.
+func (s *ItemsSketch[T]) GetPMF(splitPoints []T, searchCrit QuantileSearchCriteria) ([]float64, error) {
+	return s.GetSortedView().GetPMF(splitPoints, searchCrit)
+}
@@ -0,0 +1,250 @@
+package sketches
+
+import (
+	"math"
+	"sort"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// ItemsSketchSortedView is the ItemsSketch counterpart of
+// DoublesSketchSortedView.
+type ItemsSketchSortedView[T any] struct {
+	n          int64
+	items      []T
+	cumWeights []int64
+	less       func(a, b T) bool
+}
+
+// NewItemsSketchSortedView merges the base buffer and all populated levels of
+// the given sketch into a new sorted view.
+func NewItemsSketchSortedView[T any](sketch *ItemsSketch[T]) *ItemsSketchSortedView[T] {
+	k := sketch.GetK()
+	n := sketch.GetN()
+	numRetained := sketch.GetNumRetained()
+	items := make([]T, numRetained)
+	weights := make([]int64, numRetained)
+
+	bbCount := sketch.GetBaseBufferCount()
+	copy(items, sketch.combinedBuffer[:bbCount])
+	sketch.sortItems(items[:bbCount])
+	for i := int32(0); i < bbCount; i++ {
+		weights[i] = 1
+	}
+
+	var offset int32 = bbCount
+	var weight int64 = 2
+	ubitPattern := uint64(sketch.GetBitPattern())
+	for level := int32(0); ubitPattern > 0; level++ {
+		if ubitPattern&1 > 0 {
+			copy(items[offset:offset+k], sketch.level(level))
+			for i := offset; i < offset+k; i++ {
+				weights[i] = weight
+			}
+			offset += k
+		}
+		weight <<= 1
+		ubitPattern >>= 1
+	}
+	util.Assert(offset == numRetained, "offset == numRetained")
+
+	runs := make([]int32, 0, 2+(numRetained-bbCount)/k)
+	runs = append(runs, 0)
+	if bbCount > 0 {
+		runs = append(runs, bbCount)
+	}
+	for start := bbCount + k; start < numRetained; start += k {
+		runs = append(runs, start)
+	}
+	runs = append(runs, numRetained)
+	itemsTandemMergeSortRuns(items, weights, runs, sketch.less)
+
+	var cumWeight int64 = 0
+	for i := range weights {
+		cumWeight += weights[i]
+		weights[i] = cumWeight
+	}
+	util.Assert(cumWeight == n, "cumWeight == n")
+
+	return &ItemsSketchSortedView[T]{
+		n:          n,
+		items:      items,
+		cumWeights: weights,
+		less:       sketch.less,
+	}
+}
+
+func (sv *ItemsSketchSortedView[T]) IsEmpty() bool {
+	return sv.n == 0
+}
+
+func (sv *ItemsSketchSortedView[T]) GetN() int64 {
+	return sv.n
+}
+
+// GetItems returns the retained items in ascending order. The returned slice
+// must not be modified.
+func (sv *ItemsSketchSortedView[T]) GetItems() []T {
+	return sv.items
+}
+
+// GetCumulativeWeights returns, for each item of GetItems, the total weight of
+// that item and all items before it. The returned slice must not be modified.
+func (sv *ItemsSketchSortedView[T]) GetCumulativeWeights() []int64 {
+	return sv.cumWeights
+}
+
+// GetQuantile returns the approximate quantile of the given normalized rank.
+// An empty view returns the zero value of T.
+func (sv *ItemsSketchSortedView[T]) GetQuantile(rank float64, searchCrit QuantileSearchCriteria) (T, error) {
+	var zero T
+	if err := checkNormalizedRankBounds(rank); err != nil {
+		return zero, err
+	}
+	if sv.IsEmpty() {
+		return zero, nil
+	}
+	return sv.getQuantile(rank, searchCrit), nil
+}
+
+// GetRank returns the approximate normalized rank of the given value. An
+// empty view returns NaN.
+func (sv *ItemsSketchSortedView[T]) GetRank(value T, searchCrit QuantileSearchCriteria) (float64, error) {
+	if sv.IsEmpty() {
+		return math.NaN(), nil
+	}
+	return sv.getRank(value, searchCrit), nil
+}
+
+// GetCDF returns the approximate cumulative distribution function over the
+// intervals defined by splitPoints. An empty view returns nil.
+func (sv *ItemsSketchSortedView[T]) GetCDF(splitPoints []T, searchCrit QuantileSearchCriteria) ([]float64, error) {
+	if err := checkItemsSplitPoints(splitPoints, sv.less); err != nil {
+		return nil, err
+	}
+	if sv.IsEmpty() {
+		return nil, nil
+	}
+	return sv.getCDF(splitPoints, searchCrit), nil
+}
+
+// GetPMF returns the approximate probability mass function over the
+// intervals defined by splitPoints. An empty view returns nil.
+func (sv *ItemsSketchSortedView[T]) GetPMF(splitPoints []T, searchCrit QuantileSearchCriteria) ([]float64, error) {
+	if err := checkItemsSplitPoints(splitPoints, sv.less); err != nil {
+		return nil, err
+	}
+	if sv.IsEmpty() {
+		return nil, nil
+	}
+	buckets := sv.getCDF(splitPoints, searchCrit)
+	for i := len(buckets) - 1; i > 0; i-- {
+		buckets[i] -= buckets[i-1]
+	}
+	return buckets, nil
+}
+
+func (sv *ItemsSketchSortedView[T]) getQuantile(rank float64, searchCrit QuantileSearchCriteria) T {
+	naturalRank := getNaturalRank(rank, sv.n)
+	var index int
+	if searchCrit == INCLUSIVE {
+		ceilRank := int64(math.Ceil(naturalRank))
+		index = sort.Search(len(sv.cumWeights), func(i int) bool {
+			return sv.cumWeights[i] >= ceilRank
+		})
+	} else {
+		floorRank := int64(math.Floor(naturalRank))
+		index = sort.Search(len(sv.cumWeights), func(i int) bool {
+			return sv.cumWeights[i] > floorRank
+		})
+	}
+	if index == len(sv.cumWeights) {
+		return sv.items[len(sv.items)-1]
+	}
+	return sv.items[index]
+}
+
+func (sv *ItemsSketchSortedView[T]) getRank(value T, searchCrit QuantileSearchCriteria) float64 {
+	index := sort.Search(len(sv.items), func(i int) bool {
+		if searchCrit == INCLUSIVE {
+			return sv.less(value, sv.items[i])
+		}
+		return !sv.less(sv.items[i], value)
+	}) - 1
+	if index < 0 {
+		return 0
+	}
+	return float64(sv.cumWeights[index]) / float64(sv.n)
+}
+
+func (sv *ItemsSketchSortedView[T]) getCDF(splitPoints []T, searchCrit QuantileSearchCriteria) []float64 {
+	buckets := make([]float64, len(splitPoints)+1)
+	for i, splitPoint := range splitPoints {
+		buckets[i] = sv.getRank(splitPoint, searchCrit)
+	}
+	buckets[len(splitPoints)] = 1.0
+	return buckets
+}
+
+func checkItemsSplitPoints[T any](splitPoints []T, less func(a, b T) bool) error {
+	for i := 0; i < len(splitPoints)-1; i++ {
+		if !less(splitPoints[i], splitPoints[i+1]) {
+			return newSketchesArgumentError("split points must be unique and monotonically increasing")
+		}
+	}
+	return nil
+}
+
+// itemsTandemMergeSortRuns is the ItemsSketch counterpart of
+// tandemMergeSortRuns.
+func itemsTandemMergeSortRuns[T any](items []T, weights []int64, runs []int32, less func(a, b T) bool) {
+	numItems := int32(len(items))
+	if numItems <= 1 {
+		return
+	}
+	tmpItems := make([]T, numItems)
+	tmpWeights := make([]int64, numItems)
+	srcItems, srcWeights := items, weights
+	dstItems, dstWeights := tmpItems, tmpWeights
+	for len(runs) > 2 {
+		merged := runs[:1]
+		var i int
+		for i = 0; i+2 < len(runs); i += 2 {
+			itemsTandemMerge(srcItems, srcWeights, dstItems, dstWeights, runs[i], runs[i+1], runs[i+2], less)
+			merged = append(merged, runs[i+2])
+		}
+		if i+1 < len(runs) {
+			copy(dstItems[runs[i]:runs[i+1]], srcItems[runs[i]:runs[i+1]])
+			copy(dstWeights[runs[i]:runs[i+1]], srcWeights[runs[i]:runs[i+1]])
+			merged = append(merged, runs[i+1])
+		}
+		runs = merged
+		srcItems, dstItems = dstItems, srcItems
+		srcWeights, dstWeights = dstWeights, srcWeights
+	}
+	if &srcItems[0] != &items[0] {
+		copy(items, srcItems)
+		copy(weights, srcWeights)
+	}
+}
+
+func itemsTandemMerge[T any](srcItems []T, srcWeights []int64, dstItems []T, dstWeights []int64, start, mid, end int32, less func(a, b T) bool) {
+	i1, i2, iDst := start, mid, start
+	for i1 < mid && i2 < end {
+		if less(srcItems[i2], srcItems[i1]) {
+			dstItems[iDst] = srcItems[i2]
+			dstWeights[iDst] = srcWeights[i2]
+			i2++
+		} else {
+			dstItems[iDst] = srcItems[i1]
+			dstWeights[iDst] = srcWeights[i1]
+			i1++
+		}
+		iDst++
+	}
+	copy(dstItems[iDst:end], srcItems[i1:mid])
+	copy(dstWeights[iDst:end], srcWeights[i1:mid])
+	iDst += mid - i1
+	copy(dstItems[iDst:end], srcItems[i2:end])
+	copy(dstWeights[iDst:end], srcWeights[i2:end])
+}
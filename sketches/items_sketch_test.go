@@ -0,0 +1,389 @@
+package sketches
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func lessInt64(a, b int64) bool {
+	return a < b
+}
+
+func lessString(a, b string) bool {
+	return a < b
+}
+
+// lessFold orders strings case-insensitively, so "b" and "B" are equivalent
+// without being equal: a strict weak ordering that is not total.
+func lessFold(a, b string) bool {
+	return strings.ToLower(a) < strings.ToLower(b)
+}
+
+// foldCase returns the item of class i, in upper case for odd j.
+func foldCase(i, j int) string {
+	item := fmt.Sprintf("k%03d", i)
+	if j%2 == 1 {
+		return strings.ToUpper(item)
+	}
+	return item
+}
+
+func newItemsSketchWithRange(k int, from, to int) *ItemsSketch[int64] {
+	sketch, err := NewItemsSketch(k, lessInt64)
+	Expect(err).ToNot(HaveOccurred())
+	for i := from; i < to; i++ {
+		sketch.Update(int64(i))
+	}
+	return sketch
+}
+
+func expectItemsRanksWithin(sketch *ItemsSketch[int64], n int, eps float64) {
+	Expect(sketch.GetN()).To(Equal(int64(n)))
+	Expect(sketch.GetMinValue()).To(Equal(int64(0)))
+	Expect(sketch.GetMaxValue()).To(Equal(int64(n - 1)))
+	for _, rank := range []float64{0.01, 0.25, 0.5, 0.75, 0.99} {
+		quantile, err := sketch.GetQuantile(rank)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(float64(quantile) / float64(n)).To(BeNumerically("~", rank, eps))
+		actualRank, err := sketch.GetRank(int64(rank*float64(n)), INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actualRank).To(BeNumerically("~", rank, eps))
+	}
+}
+
+var _ = Describe("ItemsSketch", func() {
+	It("Rejects an invalid k or comparator", func() {
+		_, err := NewItemsSketch(100, lessInt64)
+		Expect(err).To(HaveOccurred())
+		_, err = NewItemsSketch[int64](defaultK, nil)
+		Expect(err).To(BeAssignableToTypeOf(&SketchesArgumentError{}))
+		sketch, err := NewItemsSketch(0, lessInt64)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sketch.GetK()).To(Equal(DEFAULT_K))
+	})
+
+	It("Handles an empty sketch", func() {
+		sketch, err := NewItemsSketch(defaultK, lessString)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sketch.IsEmpty()).To(BeTrue())
+		quantile, err := sketch.GetQuantile(0.5)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quantile).To(BeEmpty())
+		quantiles, err := sketch.GetQuantiles([]float64{0, 1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quantiles).To(BeNil())
+		cdf, err := sketch.GetCDF([]string{"a"}, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cdf).To(BeNil())
+		_, err = sketch.GetQuantile(1.5)
+		Expect(err).To(BeAssignableToTypeOf(&SketchesArgumentError{}))
+	})
+
+	It("Is exact below 2k items", func() {
+		sketch, err := NewItemsSketch(defaultK, lessString)
+		Expect(err).ToNot(HaveOccurred())
+		// insert in reverse so that the base buffer is not sorted
+		for i := 99; i >= 0; i-- {
+			sketch.Update(fmt.Sprintf("item-%02d", i))
+		}
+		Expect(sketch.IsEstimationMode()).To(BeFalse())
+		Expect(sketch.GetMinValue()).To(Equal("item-00"))
+		Expect(sketch.GetMaxValue()).To(Equal("item-99"))
+		for i := 0; i < 100; i++ {
+			rank, err := sketch.GetRank(fmt.Sprintf("item-%02d", i), EXCLUSIVE)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rank).To(Equal(float64(i) / 100))
+			quantile, err := sketch.GetQuantile(float64(i+1) / 100)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(quantile).To(Equal(fmt.Sprintf("item-%02d", i)))
+		}
+		pmf, err := sketch.GetPMF([]string{"item-25", "item-50"}, EXCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pmf).To(Equal([]float64{0.25, 0.25, 0.5}))
+		_, err = sketch.GetCDF([]string{"item-50", "item-50"}, EXCLUSIVE)
+		Expect(err).To(BeAssignableToTypeOf(&SketchesArgumentError{}))
+		quantiles, err := sketch.GetEvenlySpacedQuantiles(3)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quantiles).To(Equal([]string{"item-00", "item-49", "item-99"}))
+	})
+
+	It("Carries full base buffers into the levels of the bit pattern", func() {
+		k := 16
+		sketch := newItemsSketchWithRange(k, 0, 2*k-1)
+		Expect(sketch.GetBitPattern()).To(Equal(int64(0)))
+		Expect(sketch.GetBaseBufferCount()).To(Equal(int32(2*k - 1)))
+		Expect(sketch.IsEstimationMode()).To(BeFalse())
+
+		sketch.Update(int64(2*k - 1))
+		Expect(sketch.GetBitPattern()).To(Equal(int64(1)))
+		Expect(sketch.GetBaseBufferCount()).To(Equal(int32(0)))
+		Expect(sketch.GetNumRetained()).To(Equal(int32(k)))
+		Expect(sketch.IsEstimationMode()).To(BeTrue())
+
+		// the second full base buffer carries level 0 into level 1
+		for i := 2 * k; i < 4*k; i++ {
+			sketch.Update(int64(i))
+		}
+		Expect(sketch.GetBitPattern()).To(Equal(int64(2)))
+		Expect(sketch.GetNumRetained()).To(Equal(int32(k)))
+		for i := 4 * k; i < 6*k+5; i++ {
+			sketch.Update(int64(i))
+		}
+		Expect(sketch.GetBitPattern()).To(Equal(int64(3)))
+		Expect(sketch.GetBaseBufferCount()).To(Equal(int32(5)))
+		Expect(sketch.GetNumRetained()).To(Equal(int32(2*k + 5)))
+
+		sortedView := sketch.GetSortedView()
+		cumWeights := sortedView.GetCumulativeWeights()
+		Expect(cumWeights[len(cumWeights)-1]).To(Equal(int64(6*k + 5)))
+		Expect(sketch.GetMinValue()).To(Equal(int64(0)))
+		Expect(sketch.GetMaxValue()).To(Equal(int64(6*k + 4)))
+	})
+
+	It("Stays within the rank error", func() {
+		n := 100000
+		sketch := newItemsSketchWithRange(defaultK, 0, n)
+		Expect(sketch.GetNumRetained()).To(BeNumerically("<", n))
+		expectItemsRanksWithin(sketch, n, 2*sketch.GetNormalizedRankError(false))
+	})
+
+	It("Ranks items that less cannot tell apart together", func() {
+		sketch, err := NewItemsSketch(defaultK, lessFold)
+		Expect(err).ToNot(HaveOccurred())
+		// the first of equivalent items stays min or max
+		for _, item := range []string{"C", "c", "A", "a"} {
+			sketch.Update(item)
+		}
+		for i := 0; i < 100; i++ {
+			sketch.Update([]string{"b", "B"}[i%2])
+		}
+		for i := 0; i < 96; i++ {
+			sketch.Update([]string{"a", "c"}[i%2])
+		}
+		Expect(sketch.IsEstimationMode()).To(BeFalse())
+		Expect(sketch.GetMinValue()).To(Equal("A"))
+		Expect(sketch.GetMaxValue()).To(Equal("C"))
+
+		for _, item := range []string{"b", "B"} {
+			rank, err := sketch.GetRank(item, EXCLUSIVE)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rank).To(Equal(0.25))
+			rank, err = sketch.GetRank(item, INCLUSIVE)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rank).To(Equal(0.75))
+		}
+		quantile, err := sketch.GetQuantile(0.5)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.ToLower(quantile)).To(Equal("b"))
+		cdf, err := sketch.GetCDF([]string{"B", "c"}, EXCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cdf).To(Equal([]float64{0.25, 0.75, 1}))
+		// equivalent split points are not increasing
+		_, err = sketch.GetCDF([]string{"b", "B"}, EXCLUSIVE)
+		Expect(err).To(BeAssignableToTypeOf(&SketchesArgumentError{}))
+	})
+
+	It("Compacts items that less cannot tell apart", func() {
+		sketch, err := NewItemsSketch(defaultK, lessFold)
+		Expect(err).ToNot(HaveOccurred())
+		numClasses, n := 100, 100000
+		for j := 0; j < n/numClasses; j++ {
+			for i := 0; i < numClasses; i++ {
+				sketch.Update(foldCase(i, j))
+			}
+		}
+		Expect(sketch.IsEstimationMode()).To(BeTrue())
+		Expect(sketch.GetMinValue()).To(Equal("k000"))
+		Expect(sketch.GetMaxValue()).To(Equal("k099"))
+
+		items := sketch.GetSortedView().GetItems()
+		for i := 1; i < len(items); i++ {
+			Expect(lessFold(items[i], items[i-1])).To(BeFalse())
+		}
+		eps := 2 * sketch.GetNormalizedRankError(false)
+		for i := 0; i < numClasses; i += 10 {
+			for j := 0; j < 2; j++ {
+				rank, err := sketch.GetRank(foldCase(i, j), EXCLUSIVE)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rank).To(BeNumerically("~", float64(i)/float64(numClasses), eps))
+			}
+		}
+	})
+
+	It("Downsamples", func() {
+		sketch := newItemsSketchWithRange(256, 0, 100000)
+		downsampled, err := sketch.DownSample(64)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(downsampled.GetK()).To(Equal(int32(64)))
+		expectItemsRanksWithin(downsampled, 100000, 2*downsampled.GetNormalizedRankError(false))
+		_, err = sketch.DownSample(512)
+		Expect(err).To(BeAssignableToTypeOf(&SketchesArgumentError{}))
+	})
+
+	It("Resets", func() {
+		sketch := newItemsSketchWithRange(defaultK, 0, 1000)
+		sketch.Reset()
+		Expect(sketch.IsEmpty()).To(BeTrue())
+		Expect(sketch.GetNumRetained()).To(Equal(int32(0)))
+		sketch.Update(5)
+		Expect(sketch.GetMinValue()).To(Equal(int64(5)))
+	})
+})
+
+var _ = Describe("ItemsUnion", func() {
+	It("Returns an empty result when nothing was merged", func() {
+		union, err := NewItemsUnion(defaultK, lessInt64)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(union.IsEmpty()).To(BeTrue())
+		Expect(union.GetResult().IsEmpty()).To(BeTrue())
+		_, err = NewItemsUnion(100, lessInt64)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Merges sketches and values with the same k", func() {
+		union, err := NewItemsUnion(defaultK, lessInt64)
+		Expect(err).ToNot(HaveOccurred())
+		sketch := newItemsSketchWithRange(defaultK, 0, 10000)
+		Expect(union.UpdateSketch(sketch)).To(Succeed())
+		Expect(union.UpdateSketch(newItemsSketchWithRange(defaultK, 10000, 20000))).To(Succeed())
+		Expect(union.UpdateSketch(newItemsSketchWithRange(defaultK, 20000, 20010))).To(Succeed())
+		for i := 20010; i < 20100; i++ {
+			union.UpdateValue(int64(i))
+		}
+		expectItemsRanksWithin(union.GetResult(), 20100, 2*GetNormalizedRankError(int32(defaultK), false))
+		// the merged sketch is not modified
+		Expect(sketch.GetN()).To(Equal(int64(10000)))
+		Expect(sketch.GetMaxValue()).To(Equal(int64(9999)))
+	})
+
+	It("Downsamples sketches with a larger k", func() {
+		union, err := NewItemsUnion(64, lessInt64)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(union.UpdateSketch(newItemsSketchWithRange(256, 50000, 100000))).To(Succeed())
+		Expect(union.UpdateSketch(newItemsSketchWithRange(1024, 0, 50000))).To(Succeed())
+		Expect(union.GetEffectiveK()).To(Equal(int32(64)))
+		expectItemsRanksWithin(union.GetResultAndReset(), 100000, 2*GetNormalizedRankError(64, false))
+		Expect(union.IsEmpty()).To(BeTrue())
+	})
+
+	It("Merges sketches whose items less cannot tell apart", func() {
+		union, err := NewItemsUnion(defaultK, lessFold)
+		Expect(err).ToNot(HaveOccurred())
+		for j := 0; j < 2; j++ {
+			sketch, err := NewItemsSketch(defaultK, lessFold)
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < 10000; i++ {
+				sketch.Update(foldCase(i%100, j))
+			}
+			Expect(union.UpdateSketch(sketch)).To(Succeed())
+		}
+		result := union.GetResult()
+		Expect(result.GetN()).To(Equal(int64(20000)))
+		// min and max come from the first sketch
+		Expect(result.GetMinValue()).To(Equal("k000"))
+		Expect(result.GetMaxValue()).To(Equal("k099"))
+		rank, err := result.GetRank("K050", EXCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rank).To(BeNumerically("~", 0.5, 2*result.GetNormalizedRankError(false)))
+	})
+
+	It("Adopts a smaller k", func() {
+		union, err := NewItemsUnion(256, lessInt64)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(union.UpdateSketch(newItemsSketchWithRange(256, 0, 50000))).To(Succeed())
+		Expect(union.UpdateSketch(newItemsSketchWithRange(32, 50000, 100000))).To(Succeed())
+		Expect(union.GetEffectiveK()).To(Equal(int32(32)))
+		expectItemsRanksWithin(union.GetResult(), 100000, 2*GetNormalizedRankError(32, false))
+	})
+})
+
+var _ = Describe("ItemsSketch serialization", func() {
+	for _, n := range []int{0, 1, 10, 1000, 100000} {
+		n := n
+
+		It("Round-trips through serialization", func() {
+			sketch := newItemsSketchWithRange(defaultK, 0, n)
+			serializedBytes, err := sketch.Serialize(ArrayOfLongsSerDe{})
+			Expect(err).ToNot(HaveOccurred())
+			heapified, err := HeapifyItemsSketch[int64](serializedBytes, lessInt64, ArrayOfLongsSerDe{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(heapified.GetN()).To(Equal(int64(n)))
+			Expect(heapified.GetSortedView().GetItems()).To(Equal(sketch.GetSortedView().GetItems()))
+			reserializedBytes, err := heapified.Serialize(ArrayOfLongsSerDe{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reserializedBytes).To(Equal(serializedBytes))
+
+			heapified.Update(int64(n))
+			Expect(heapified.GetN()).To(Equal(int64(n + 1)))
+		})
+	}
+
+	It("Round-trips strings", func() {
+		sketch, err := NewItemsSketch(16, lessString)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < 1000; i++ {
+			sketch.Update(fmt.Sprintf("v%v.%v", i%7, i))
+		}
+		serializedBytes, err := sketch.Serialize(ArrayOfStringsSerDe{})
+		Expect(err).ToNot(HaveOccurred())
+		heapified, err := HeapifyItemsSketch[string](serializedBytes, lessString, ArrayOfStringsSerDe{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(heapified.GetMinValue()).To(Equal("v0.0"))
+		Expect(heapified.GetMaxValue()).To(Equal("v6.993"))
+		Expect(heapified.GetSortedView().GetItems()).To(Equal(sketch.GetSortedView().GetItems()))
+	})
+
+	It("Serializes in the format of DataSketches Java", func() {
+		empty, err := newItemsSketchWithRange(defaultK, 0, 0).Serialize(ArrayOfLongsSerDe{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(empty).To(Equal([]byte{1, 3, 8, 28, byte(defaultK), 0, 0, 0}))
+
+		sketch, err := NewItemsSketch(defaultK, lessString)
+		Expect(err).ToNot(HaveOccurred())
+		sketch.Update("b")
+		sketch.Update("a")
+		serializedBytes, err := sketch.Serialize(ArrayOfStringsSerDe{})
+		Expect(err).ToNot(HaveOccurred())
+		// preamble, n, then min, max and the sorted base buffer
+		Expect(serializedBytes).To(Equal([]byte{
+			2, 3, 8, 24, byte(defaultK), 0, 0, 0,
+			2, 0, 0, 0, 0, 0, 0, 0,
+			1, 0, 0, 0, 'a', 1, 0, 0, 0, 'b',
+			1, 0, 0, 0, 'a', 1, 0, 0, 0, 'b',
+		}))
+	})
+
+	It("Rejects invalid input", func() {
+		serializedBytes, err := newItemsSketchWithRange(defaultK, 0, 1000).Serialize(ArrayOfLongsSerDe{})
+		Expect(err).ToNot(HaveOccurred())
+		corrupt := func(mutate func([]byte)) []byte {
+			corrupted := append([]byte{}, serializedBytes...)
+			mutate(corrupted)
+			return corrupted
+		}
+		expectError := func(srcBytes []byte, target error) {
+			_, err := HeapifyItemsSketch[int64](srcBytes, lessInt64, ArrayOfLongsSerDe{})
+			Expect(errors.Is(err, target)).To(BeTrue(), "%v", err)
+		}
+
+		expectError(serializedBytes[:4], ErrCorruptSketch)
+		expectError(serializedBytes[:len(serializedBytes)-8], ErrCorruptSketch)
+		expectError(corrupt(func(b []byte) { b[FAMILY_BYTE] = 15 }), ErrFamilyMismatch)
+		expectError(corrupt(func(b []byte) { b[SER_VER_BYTE] = 2 }), ErrUnsupportedSerVer)
+		expectError(corrupt(func(b []byte) { b[PREAMBLE_LONGS_BYTE] = 1 }), ErrCorruptSketch)
+		expectError(corrupt(func(b []byte) { b[FLAGS_BYTE] |= BIG_ENDIAN_FLAG_MASK }), ErrCorruptSketch)
+		expectError(corrupt(func(b []byte) { b[N_LONG] ^= 1 }), ErrCorruptSketch)
+		expectError(corrupt(func(b []byte) {
+			// the last item is the largest of the top level
+			binary.LittleEndian.PutUint64(b[len(b)-8:], 0)
+		}), ErrCorruptSketch)
+
+		_, err = HeapifyItemsSketch[string]([]byte{2, 3, 8, 24, 16, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 200, 0, 0, 0}, lessString, ArrayOfStringsSerDe{})
+		Expect(errors.Is(err, ErrCorruptSketch)).To(BeTrue(), "%v", err)
+	})
+})
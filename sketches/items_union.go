@@ -0,0 +1,152 @@
+package sketches
+
+import "github.com/fluxninja/datasketches-go/sketches/util"
+
+// ItemsUnion merges any number of ItemsSketches with the same less function,
+// including sketches with different k. Sketches with a larger k than the
+// union are downsampled.
+type ItemsUnion[T any] struct {
+	maxK   int32
+	less   func(a, b T) bool
+	gadget *ItemsSketch[T]
+}
+
+func NewItemsUnion[T any](maxK int, less func(a, b T) bool) (*ItemsUnion[T], error) {
+	maxK_ := int32(maxK)
+	if !validK(maxK_) {
+		return nil, newSketchesArgumentError("k must be a power of 2, not lower than %v and not higher than %v (got %v)", MIN_K, MAX_K, maxK)
+	}
+	if less == nil {
+		return nil, newSketchesArgumentError("less must not be nil")
+	}
+	return &ItemsUnion[T]{maxK: maxK_, less: less}, nil
+}
+
+func (u *ItemsUnion[T]) IsEmpty() bool {
+	return u.gadget == nil || u.gadget.IsEmpty()
+}
+
+// GetMaxK returns the configured maximum k of this union.
+func (u *ItemsUnion[T]) GetMaxK() int32 {
+	return u.maxK
+}
+
+// GetEffectiveK returns the k of the internal sketch, which may be smaller
+// than the maximum k after merging a sketch with a smaller k.
+func (u *ItemsUnion[T]) GetEffectiveK() int32 {
+	if u.gadget == nil {
+		return u.maxK
+	}
+	return u.gadget.GetK()
+}
+
+// UpdateSketch merges the given sketch into this union. The given sketch is
+// not modified.
+func (u *ItemsUnion[T]) UpdateSketch(sketch *ItemsSketch[T]) error {
+	gadget, err := itemsUpdateLogic(u.maxK, u.less, u.gadget, sketch)
+	if err != nil {
+		return err
+	}
+	u.gadget = gadget
+	return nil
+}
+
+// UpdateValue updates the union with the given item.
+func (u *ItemsUnion[T]) UpdateValue(dataItem T) {
+	if u.gadget == nil {
+		u.gadget = newItemsSketch(u.maxK, u.less)
+	}
+	u.gadget.Update(dataItem)
+}
+
+// GetResult returns a copy of the union result. The union can still be
+// updated afterwards.
+func (u *ItemsUnion[T]) GetResult() *ItemsSketch[T] {
+	if u.gadget == nil {
+		return newItemsSketch(u.maxK, u.less)
+	}
+	return u.gadget.copy()
+}
+
+// GetResultAndReset returns the union result without copying it and resets
+// the union.
+func (u *ItemsUnion[T]) GetResultAndReset() *ItemsSketch[T] {
+	if u.gadget == nil {
+		return u.GetResult()
+	}
+	result := u.gadget
+	u.gadget = nil
+	return result
+}
+
+func (u *ItemsUnion[T]) Reset() {
+	u.gadget = nil
+}
+
+func itemsUpdateLogic[T any](myMaxK int32, less func(a, b T) bool, myQS *ItemsSketch[T], other *ItemsSketch[T]) (*ItemsSketch[T], error) {
+	var sw1 int = 0
+	if myQS != nil {
+		if myQS.IsEmpty() {
+			sw1 = 4
+		} else {
+			sw1 = 8
+		}
+	}
+	if other != nil {
+		if other.IsEmpty() {
+			sw1 |= 1
+		} else {
+			sw1 |= 2
+		}
+	}
+
+	switch sw1 {
+	case 0: // myQS = nil, other = nil
+		return nil, nil
+	case 1: // myQS = nil, other = empty
+		return newItemsSketch(util.Intmin(myMaxK, other.GetK()), less), nil
+	case 2: // myQS = nil, other = valid
+		if !other.IsEstimationMode() {
+			// exact mode, only need to copy the base buffer
+			ret := newItemsSketch(myMaxK, less)
+			for _, item := range other.combinedBuffer[:other.baseBufferCount] {
+				ret.Update(item)
+			}
+			return ret, nil
+		}
+		if myMaxK < other.GetK() {
+			ret := newItemsSketch(myMaxK, less)
+			if err := itemsDownSamplingMergeInto(other, ret); err != nil {
+				return nil, err
+			}
+			return ret, nil
+		}
+		// copy required because the caller still has a handle to other
+		return other.copy(), nil
+	case 4, 5, 8, 9: // other = nil or empty
+		return myQS, nil
+	case 6, 10: // myQS = empty or valid, other = valid
+		if !other.IsEstimationMode() {
+			// exact mode, only need to copy the base buffer
+			for _, item := range other.combinedBuffer[:other.baseBufferCount] {
+				myQS.Update(item)
+			}
+			return myQS, nil
+		}
+		if myQS.GetK() <= other.GetK() {
+			// myQS is smaller or equal, thus the target
+			if err := itemsMergeInto(other, myQS); err != nil {
+				return nil, err
+			}
+			return myQS, nil
+		}
+		// myQS is bigger, so the roles must be reversed. other must be copied
+		// as the caller still has a handle to it.
+		ret := other.copy()
+		if err := itemsMergeInto(myQS, ret); err != nil {
+			return nil, err
+		}
+		return ret, nil
+	}
+	return nil, nil
+}
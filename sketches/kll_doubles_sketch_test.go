@@ -0,0 +1,292 @@
+package sketches
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func newKllSketchWithRange(k int, from, to int) *KllDoublesSketch {
+	sketch, err := NewKllDoublesSketch(k)
+	Expect(err).ToNot(HaveOccurred())
+	for i := from; i < to; i++ {
+		Expect(sketch.Update(float64(i))).To(Succeed())
+	}
+	return sketch
+}
+
+func expectKllRanksWithin(sketch *KllDoublesSketch, n int, eps float64) {
+	Expect(sketch.GetN()).To(Equal(int64(n)))
+	Expect(sketch.GetMinValue()).To(Equal(0.0))
+	Expect(sketch.GetMaxValue()).To(Equal(float64(n - 1)))
+	for _, rank := range []float64{0.01, 0.25, 0.5, 0.75, 0.99} {
+		quantile, err := sketch.GetQuantile(rank, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quantile / float64(n)).To(BeNumerically("~", rank, eps))
+		actualRank, err := sketch.GetRank(float64(int(rank*float64(n))), INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actualRank).To(BeNumerically("~", rank, eps))
+	}
+}
+
+// countKllItems returns how often the item is retained at each level.
+func countKllItems(sketch *KllDoublesSketch, item float64) []int {
+	counts := make([]int, sketch.getNumLevels())
+	for level := range counts {
+		for _, retained := range sketch.items[sketch.levels[level]:sketch.levels[level+1]] {
+			if retained == item {
+				counts[level]++
+			}
+		}
+	}
+	return counts
+}
+
+var _ = Describe("KllDoublesSketch", func() {
+	It("Rejects an invalid k", func() {
+		_, err := NewKllDoublesSketch(int(KLL_MIN_K) - 1)
+		Expect(err).To(BeAssignableToTypeOf(&SketchesArgumentError{}))
+		_, err = NewKllDoublesSketch(int(KLL_MAX_K) + 1)
+		Expect(err).To(BeAssignableToTypeOf(&SketchesArgumentError{}))
+	})
+
+	It("Compacts level 0 only once it is full", func() {
+		k := KLL_DEFAULT_K
+		sketch := newKllSketchWithRange(int(k), 0, int(k))
+		Expect(sketch.levels).To(Equal([]int32{0, k}))
+		Expect(sketch.IsEstimationMode()).To(BeFalse())
+		rank, err := sketch.GetRank(99, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rank).To(Equal(0.5))
+
+		// the next item adds a level below, whose capacity is 2/3 of k, and
+		// halves the full level into it
+		Expect(sketch.Update(float64(k))).To(Succeed())
+		levelZeroCap := kllLevelCapacity(k, 2, 0, KLL_DEFAULT_M)
+		Expect(levelZeroCap).To(Equal(int32(133)))
+		Expect(sketch.levels).To(Equal([]int32{levelZeroCap + k/2 - 1, levelZeroCap + k/2, levelZeroCap + k}))
+		Expect(sketch.items).To(HaveLen(int(levelZeroCap + k)))
+		Expect(sketch.IsEstimationMode()).To(BeTrue())
+		Expect(sketch.GetNumRetained()).To(Equal(k/2 + 1))
+		Expect(kllSumLevelWeights(sketch.levels)).To(Equal(sketch.GetN()))
+		Expect(sort.Float64sAreSorted(sketch.items[sketch.levels[1]:sketch.levels[2]])).To(BeTrue())
+		Expect(sketch.GetMinValue()).To(Equal(0.0))
+		Expect(sketch.GetMaxValue()).To(Equal(float64(k)))
+	})
+
+	It("Keeps the odd item of a compacted level at that level", func() {
+		k := KLL_DEFAULT_K
+		sketch := newKllSketchWithRange(int(k), 0, int(k)+1)
+		// level 0 fills all the space below level 1, an odd number of items
+		for sketch.levels[0] > 0 {
+			Expect(sketch.Update(-1)).To(Succeed())
+		}
+		levelZeroSize := sketch.getLevelSize(0)
+		Expect(levelZeroSize % 2).To(Equal(int32(1)))
+		levelOneSize := sketch.getLevelSize(1)
+		Expect(sketch.Update(-2)).To(Succeed())
+		Expect(sketch.getLevelSize(0)).To(Equal(int32(2)))
+		Expect(sketch.getLevelSize(1)).To(Equal(levelOneSize + (levelZeroSize-1)/2))
+		Expect(kllSumLevelWeights(sketch.levels)).To(Equal(sketch.GetN()))
+	})
+
+	It("Adds a weight below the free space of level 0 item by item", func() {
+		sketch := newKllSketchWithRange(int(KLL_DEFAULT_K), 0, 150)
+		Expect(sketch.levels[0]).To(Equal(int32(50)))
+		Expect(sketch.UpdateWeighted(7, 49)).To(Succeed())
+		Expect(sketch.levels[0]).To(Equal(int32(1)))
+		Expect(sketch.IsEstimationMode()).To(BeFalse())
+		Expect(countKllItems(sketch, 7)).To(Equal([]int{50}))
+		Expect(sketch.GetN()).To(Equal(int64(199)))
+		rank, err := sketch.GetRank(7, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rank).To(Equal(float64(8+49) / 199))
+	})
+
+	It("Spreads a weight that reaches levels[0] over the levels of its bits", func() {
+		sketch := newKllSketchWithRange(int(KLL_DEFAULT_K), 0, 150)
+		Expect(sketch.UpdateWeighted(7, 50)).To(Succeed())
+		Expect(sketch.GetN()).To(Equal(int64(200)))
+		Expect(sketch.IsEstimationMode()).To(BeTrue())
+		Expect(kllSumLevelWeights(sketch.levels)).To(Equal(int64(200)))
+		// 50 is 0b110010; the copies at levels 4 and 5 are never compacted
+		counts := countKllItems(sketch, 7)
+		Expect(counts[4]).To(Equal(1))
+		Expect(counts[5]).To(Equal(1))
+		rank, err := sketch.GetRank(7, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rank).To(BeNumerically("~", float64(8+50)/200, sketch.GetNormalizedRankError(false)))
+
+		// with levels[0] at 1, even a weight of 1 takes the merge path
+		sketch = newKllSketchWithRange(int(KLL_DEFAULT_K), 0, 199)
+		Expect(sketch.UpdateWeighted(7, 1)).To(Succeed())
+		Expect(sketch.levels).To(Equal([]int32{0, KLL_DEFAULT_K}))
+		Expect(sketch.UpdateWeighted(7, 1)).To(Succeed())
+		Expect(sketch.IsEstimationMode()).To(BeTrue())
+		Expect(sketch.GetN()).To(Equal(int64(201)))
+		Expect(kllSumLevelWeights(sketch.levels)).To(Equal(int64(201)))
+	})
+
+	It("Accepts weights up to the top levels", func() {
+		sketch := newKllSketchWithRange(int(KLL_DEFAULT_K), 0, 0)
+		Expect(sketch.UpdateWeighted(1, 0)).ToNot(Succeed())
+		Expect(sketch.UpdateWeighted(math.NaN(), 1<<40)).To(Succeed())
+		Expect(sketch.IsEmpty()).To(BeTrue())
+		Expect(sketch.UpdateWeighted(1, 1010)).To(Succeed())
+		Expect(sketch.UpdateWeighted(3, 1<<40)).To(Succeed())
+		Expect(sketch.getNumLevels()).To(Equal(int32(41)))
+		Expect(countKllItems(sketch, 3)[40]).To(Equal(1))
+		Expect(sketch.GetN()).To(Equal(int64(1010 + 1<<40)))
+		rank, err := sketch.GetRank(1, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rank).To(BeNumerically("~", 1010/float64(1010+1<<40), 1e-9))
+		quantile, err := sketch.GetQuantile(0.5, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quantile).To(Equal(3.0))
+	})
+
+	It("Stays within the rank error", func() {
+		n := 1000000
+		sketch := newKllSketchWithRange(int(KLL_DEFAULT_K), 0, n)
+		Expect(sketch.GetNumRetained()).To(BeNumerically("<", 4*KLL_DEFAULT_K))
+		expectKllRanksWithin(sketch, n, 2*sketch.GetNormalizedRankError(false))
+	})
+
+	It("Lowers min k only when merging a sketch in estimation mode", func() {
+		sketch := newKllSketchWithRange(int(KLL_DEFAULT_K), 0, 50000)
+		Expect(sketch.Merge(newKllSketchWithRange(100, 50000, 50050))).To(Succeed())
+		Expect(sketch.GetMinK()).To(Equal(KLL_DEFAULT_K))
+
+		other := newKllSketchWithRange(100, 50050, 100000)
+		Expect(sketch.Merge(other)).To(Succeed())
+		Expect(sketch.GetK()).To(Equal(KLL_DEFAULT_K))
+		Expect(sketch.GetMinK()).To(Equal(int32(100)))
+		Expect(other.GetN()).To(Equal(int64(49950)))
+		Expect(kllSumLevelWeights(sketch.levels)).To(Equal(int64(100000)))
+		expectKllRanksWithin(sketch, 100000, 2*sketch.GetNormalizedRankError(false))
+
+		Expect(sketch.Merge(sketch)).To(Succeed())
+		Expect(sketch.GetN()).To(Equal(int64(200000)))
+		Expect(kllSumLevelWeights(sketch.levels)).To(Equal(int64(200000)))
+	})
+
+	for _, n := range []int{0, 1, 2, 200, 201, 100000} {
+		n := n
+
+		It("Round-trips its levels through serialization", func() {
+			sketch := newKllSketchWithRange(int(KLL_DEFAULT_K), 0, n)
+			serializedBytes, err := sketch.Serialize()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serializedBytes).To(HaveLen(sketch.GetSerializedSizeBytes()))
+
+			heapified, err := HeapifyKllDoublesSketch(serializedBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(heapified.GetN()).To(Equal(int64(n)))
+			Expect(heapified.levels).To(Equal(sketch.levels))
+			Expect(heapified.items[heapified.levels[0]:]).To(Equal(sketch.items[sketch.levels[0]:]))
+			reserializedBytes, err := heapified.Serialize()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reserializedBytes).To(Equal(serializedBytes))
+
+			// the heapified sketch has room for level 0 to grow
+			for i := n; i < n+int(KLL_DEFAULT_K); i++ {
+				Expect(heapified.Update(float64(i))).To(Succeed())
+			}
+			Expect(kllSumLevelWeights(heapified.levels)).To(Equal(int64(n) + int64(KLL_DEFAULT_K)))
+		})
+	}
+
+	It("Serializes empty, single-item and exact sketches", func() {
+		empty, err := newKllSketchWithRange(int(KLL_DEFAULT_K), 0, 0).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(empty).To(Equal([]byte{2, 1, 15, 1, 200, 0, 8, 0}))
+
+		single, err := newKllSketchWithRange(int(KLL_DEFAULT_K), 5, 6).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		expected := []byte{2, 2, 15, 4, 200, 0, 8, 0}
+		expected = append(expected, float64Bytes(5)...)
+		Expect(single).To(Equal(expected))
+
+		full, err := newKllSketchWithRange(int(KLL_DEFAULT_K), 1, 4).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		expected = []byte{5, 1, 15, 0, 200, 0, 8, 0, 3, 0, 0, 0, 0, 0, 0, 0, 200, 0, 1, 0, 197, 0, 0, 0}
+		// min, max, then level 0, which grows downwards
+		for _, item := range []float64{1, 3, 3, 2, 1} {
+			expected = append(expected, float64Bytes(item)...)
+		}
+		Expect(full).To(Equal(expected))
+	})
+
+	It("Lays out the levels of an estimation mode sketch", func() {
+		n := 10000
+		serializedBytes, err := newKllSketchWithRange(int(KLL_DEFAULT_K), 0, n).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(serializedBytes[:KLL_M_BYTE+2]).To(Equal([]byte{5, 1, 15, 0, 200, 0, 8, 0}))
+		Expect(binary.LittleEndian.Uint64(serializedBytes[N_LONG:])).To(Equal(uint64(n)))
+		Expect(binary.LittleEndian.Uint16(serializedBytes[KLL_MIN_K_SHORT:])).To(Equal(uint16(KLL_DEFAULT_K)))
+
+		// only the start of each level is written; the end of the top level is
+		// the total capacity for this number of levels
+		numLevels := int(serializedBytes[KLL_NUM_LEVELS_BYTE])
+		Expect(numLevels).To(BeNumerically(">", 2))
+		levels := make([]int32, numLevels+1)
+		for i := 0; i < numLevels; i++ {
+			levels[i] = int32(binary.LittleEndian.Uint32(serializedBytes[KLL_DATA_START+4*i:]))
+		}
+		levels[numLevels] = kllComputeTotalCapacity(KLL_DEFAULT_K, KLL_DEFAULT_M, int32(numLevels))
+		itemsStart := KLL_DATA_START + 4*numLevels + 16
+		Expect(serializedBytes).To(HaveLen(itemsStart + 8*int(levels[numLevels]-levels[0])))
+		Expect(util.BinaryGetFloat64(serializedBytes[itemsStart-16:], binary.LittleEndian)).To(Equal(0.0))
+		Expect(util.BinaryGetFloat64(serializedBytes[itemsStart-8:], binary.LittleEndian)).To(Equal(float64(n - 1)))
+
+		var weight int64
+		for level := 0; level < numLevels; level++ {
+			items := make([]float64, levels[level+1]-levels[level])
+			offset := itemsStart + 8*int(levels[level]-levels[0])
+			util.BinaryGetFloat64Slice(items, serializedBytes[offset:], binary.LittleEndian)
+			if level > 0 {
+				Expect(sort.Float64sAreSorted(items)).To(BeTrue(), "level %v", level)
+			}
+			weight += int64(len(items)) << uint(level)
+		}
+		Expect(weight).To(Equal(int64(n)))
+	})
+
+	It("Rejects invalid input", func() {
+		serializedBytes, err := newKllSketchWithRange(int(KLL_DEFAULT_K), 0, 100000).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		corrupt := func(mutate func([]byte)) []byte {
+			corrupted := append([]byte{}, serializedBytes...)
+			mutate(corrupted)
+			return corrupted
+		}
+		expectError := func(srcBytes []byte, target error) {
+			_, err := HeapifyKllDoublesSketch(srcBytes)
+			Expect(errors.Is(err, target)).To(BeTrue(), "%v", err)
+		}
+
+		expectError(serializedBytes[:4], ErrCorruptSketch)
+		expectError(serializedBytes[:len(serializedBytes)-8], ErrCorruptSketch)
+		expectError(corrupt(func(b []byte) { b[FAMILY_BYTE] = 8 }), ErrFamilyMismatch)
+		expectError(corrupt(func(b []byte) { b[SER_VER_BYTE] = 3 }), ErrUnsupportedSerVer)
+		expectError(corrupt(func(b []byte) { b[PREAMBLE_LONGS_BYTE] = 2 }), ErrCorruptSketch)
+		expectError(corrupt(func(b []byte) { b[KLL_M_BYTE] = 3 }), ErrCorruptSketch)
+		expectError(corrupt(func(b []byte) { b[N_LONG] ^= 1 }), ErrCorruptSketch)
+		expectError(corrupt(func(b []byte) { b[KLL_NUM_LEVELS_BYTE]++ }), ErrCorruptSketch)
+		expectError(corrupt(func(b []byte) {
+			// the last item is the largest of the top level
+			util.BinaryPutFloat64(b[len(b)-8:], binary.LittleEndian, -1)
+		}), ErrCorruptSketch)
+	})
+})
+
+func float64Bytes(f float64) []byte {
+	b := make([]byte, 8)
+	util.BinaryPutFloat64(b, binary.LittleEndian, f)
+	return b
+}
@@ -0,0 +1,193 @@
+package sketches
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func newKllFloatsSketchWithRange(k int, from, to int) *KllFloatsSketch {
+	sketch, err := NewKllFloatsSketch(k)
+	Expect(err).ToNot(HaveOccurred())
+	for i := from; i < to; i++ {
+		Expect(sketch.Update(float32(i))).To(Succeed())
+	}
+	return sketch
+}
+
+func expectKllFloatsRanksWithin(sketch *KllFloatsSketch, n int, eps float64) {
+	Expect(sketch.GetN()).To(Equal(int64(n)))
+	Expect(sketch.GetMinValue()).To(Equal(float32(0)))
+	Expect(sketch.GetMaxValue()).To(Equal(float32(n - 1)))
+	for _, rank := range []float64{0.01, 0.25, 0.5, 0.75, 0.99} {
+		quantile, err := sketch.GetQuantile(rank, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(float64(quantile) / float64(n)).To(BeNumerically("~", rank, eps))
+		actualRank, err := sketch.GetRank(float32(int(rank*float64(n))), INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actualRank).To(BeNumerically("~", rank, eps))
+	}
+}
+
+var _ = Describe("KllFloatsSketch", func() {
+	It("Ignores NaN but keeps infinities and the float32 extremes", func() {
+		sketch := newKllFloatsSketchWithRange(int(KLL_DEFAULT_K), 0, 0)
+		Expect(sketch.Update(float32(math.NaN()))).To(Succeed())
+		Expect(sketch.UpdateWeighted(float32(math.NaN()), 1000)).To(Succeed())
+		Expect(sketch.IsEmpty()).To(BeTrue())
+		quantile, err := sketch.GetQuantile(0.5, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(math.IsNaN(float64(quantile))).To(BeTrue())
+
+		for _, item := range []float32{math.MaxFloat32, -math.MaxFloat32, math.SmallestNonzeroFloat32} {
+			Expect(sketch.Update(item)).To(Succeed())
+		}
+		Expect(sketch.GetMinValue()).To(Equal(float32(-math.MaxFloat32)))
+		Expect(sketch.GetMaxValue()).To(Equal(float32(math.MaxFloat32)))
+		Expect(sketch.UpdateWeighted(float32(math.Inf(1)), 1000)).To(Succeed())
+		Expect(sketch.UpdateWeighted(float32(math.Inf(-1)), 1000)).To(Succeed())
+		Expect(sketch.GetMinValue()).To(Equal(float32(math.Inf(-1))))
+		Expect(sketch.GetMaxValue()).To(Equal(float32(math.Inf(1))))
+		rank, err := sketch.GetRank(math.MaxFloat32, EXCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rank).To(BeNumerically("~", 0.5, sketch.GetNormalizedRankError(false)))
+
+		serializedBytes, err := sketch.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		heapified, err := HeapifyKllFloatsSketch(serializedBytes)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(heapified.GetMinValue()).To(Equal(float32(math.Inf(-1))))
+		Expect(heapified.GetMaxValue()).To(Equal(float32(math.Inf(1))))
+		Expect(heapified.GetN()).To(Equal(int64(2003)))
+	})
+
+	It("Compacts exactly as the doubles sketch for the same random seed", func() {
+		floats := newKllFloatsSketchWithRange(int(KLL_DEFAULT_K), 0, 0)
+		doubles := newKllSketchWithRange(int(KLL_DEFAULT_K), 0, 0)
+		floats.rand = rand.New(util.NewSplitMix64Source(1))
+		doubles.rand = rand.New(util.NewSplitMix64Source(1))
+		otherFloats := newKllFloatsSketchWithRange(100, 0, 0)
+		otherDoubles := newKllSketchWithRange(100, 0, 0)
+		otherFloats.rand = rand.New(util.NewSplitMix64Source(2))
+		otherDoubles.rand = rand.New(util.NewSplitMix64Source(2))
+
+		// integers below 2^24 are exact in float32, so both sketches see the
+		// same items in the same unsorted order
+		n := 100000
+		for i := 0; i < n; i++ {
+			item := (i * 7919) % n
+			Expect(floats.Update(float32(item))).To(Succeed())
+			Expect(doubles.Update(float64(item))).To(Succeed())
+			Expect(otherFloats.Update(float32(n + item))).To(Succeed())
+			Expect(otherDoubles.Update(float64(n + item))).To(Succeed())
+		}
+		Expect(floats.UpdateWeighted(7, 1000)).To(Succeed())
+		Expect(doubles.UpdateWeighted(7, 1000)).To(Succeed())
+		Expect(floats.Merge(otherFloats)).To(Succeed())
+		Expect(doubles.Merge(otherDoubles)).To(Succeed())
+
+		Expect(floats.GetN()).To(Equal(int64(2*n + 1000)))
+		Expect(floats.GetMinK()).To(Equal(int32(100)))
+		Expect(floats.levels).To(Equal(doubles.levels))
+		Expect(floats.isLevelZeroSorted).To(Equal(doubles.isLevelZeroSorted))
+		for i := floats.levels[0]; i < floats.levels[len(floats.levels)-1]; i++ {
+			Expect(float64(floats.items[i])).To(Equal(doubles.items[i]))
+		}
+
+		// the floats sketch takes half the bytes per item
+		floatsBytes := floats.GetSerializedSizeBytes()
+		doublesBytes := doubles.GetSerializedSizeBytes()
+		numLevels := int(floats.getNumLevels())
+		Expect(doublesBytes - floatsBytes).To(Equal(4 * (int(floats.GetNumRetained()) + 2)))
+		Expect(floatsBytes).To(Equal(KLL_DATA_START + 4*numLevels + 4*(int(floats.GetNumRetained())+2)))
+	})
+
+	It("Stays within the rank error", func() {
+		n := 1000000
+		sketch := newKllFloatsSketchWithRange(int(KLL_DEFAULT_K), 0, n)
+		expectKllFloatsRanksWithin(sketch, n, 2*sketch.GetNormalizedRankError(false))
+	})
+
+	for _, n := range []int{0, 1, 2, 201, 100000} {
+		n := n
+
+		It("Round-trips through serialization", func() {
+			sketch := newKllFloatsSketchWithRange(int(KLL_DEFAULT_K), 0, n)
+			serializedBytes, err := sketch.Serialize()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serializedBytes).To(HaveLen(sketch.GetSerializedSizeBytes()))
+
+			heapified, err := HeapifyKllFloatsSketch(serializedBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(heapified.GetN()).To(Equal(int64(n)))
+			Expect(heapified.levels).To(Equal(sketch.levels))
+			reserializedBytes, err := heapified.Serialize()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reserializedBytes).To(Equal(serializedBytes))
+		})
+	}
+
+	It("Serializes empty, single-item and exact sketches", func() {
+		empty, err := newKllFloatsSketchWithRange(int(KLL_DEFAULT_K), 0, 0).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(empty).To(Equal([]byte{2, 1, 15, 1, 200, 0, 8, 0}))
+
+		single, err := newKllFloatsSketchWithRange(int(KLL_DEFAULT_K), 5, 6).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		expected := []byte{2, 2, 15, 4, 200, 0, 8, 0}
+		expected = append(expected, float32Bytes(5)...)
+		Expect(single).To(Equal(expected))
+
+		full, err := newKllFloatsSketchWithRange(int(KLL_DEFAULT_K), 1, 4).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		expected = []byte{5, 1, 15, 0, 200, 0, 8, 0, 3, 0, 0, 0, 0, 0, 0, 0, 200, 0, 1, 0, 197, 0, 0, 0}
+		// min, max, then level 0, which grows downwards
+		for _, item := range []float32{1, 3, 3, 2, 1} {
+			expected = append(expected, float32Bytes(item)...)
+		}
+		Expect(full).To(Equal(expected))
+	})
+
+	It("Lays out the levels of an estimation mode sketch with 4-byte items", func() {
+		n := 10000
+		sketch := newKllFloatsSketchWithRange(int(KLL_DEFAULT_K), 0, n)
+		serializedBytes, err := sketch.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		numLevels := int(serializedBytes[KLL_NUM_LEVELS_BYTE])
+		Expect(numLevels).To(Equal(int(sketch.getNumLevels())))
+		for i, level := range sketch.levels[:numLevels] {
+			Expect(binary.LittleEndian.Uint32(serializedBytes[KLL_DATA_START+4*i:])).To(Equal(uint32(level)))
+		}
+		itemsStart := KLL_DATA_START + 4*numLevels + 8
+		Expect(util.BinaryGetFloat32(serializedBytes[itemsStart-8:], binary.LittleEndian)).To(Equal(float32(0)))
+		Expect(util.BinaryGetFloat32(serializedBytes[itemsStart-4:], binary.LittleEndian)).To(Equal(float32(n - 1)))
+		items := make([]float32, sketch.GetNumRetained())
+		util.BinaryGetFloat32Slice(items, serializedBytes[itemsStart:], binary.LittleEndian)
+		Expect(items).To(Equal(sketch.items[sketch.levels[0]:]))
+		Expect(serializedBytes).To(HaveLen(itemsStart + 4*len(items)))
+	})
+
+	It("Rejects invalid input", func() {
+		_, err := NewKllFloatsSketch(int(KLL_MAX_K) + 1)
+		Expect(err).To(BeAssignableToTypeOf(&SketchesArgumentError{}))
+		serializedBytes, err := newKllFloatsSketchWithRange(int(KLL_DEFAULT_K), 0, 100000).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = HeapifyKllFloatsSketch(serializedBytes[:len(serializedBytes)-4])
+		Expect(errors.Is(err, ErrCorruptSketch)).To(BeTrue(), "%v", err)
+		corrupted := append([]byte{}, serializedBytes...)
+		util.BinaryPutFloat32(corrupted[len(corrupted)-4:], binary.LittleEndian, -1)
+		_, err = HeapifyKllFloatsSketch(corrupted)
+		Expect(errors.Is(err, ErrCorruptSketch)).To(BeTrue(), "%v", err)
+	})
+})
+
+func float32Bytes(f float32) []byte {
+	b := make([]byte, 4)
+	util.BinaryPutFloat32(b, binary.LittleEndian, f)
+	return b
+}
@@ -0,0 +1,268 @@
+package sketches
+
+import (
+	"math"
+	"math/bits"
+	"math/rand"
+)
+
+// KLL sketch parameters, as in DataSketches Java and C++
+const (
+	KLL_DEFAULT_K int32 = 200
+	KLL_MIN_K     int32 = KLL_DEFAULT_M
+	KLL_MAX_K     int32 = (1 << 16) - 1
+	KLL_DEFAULT_M int32 = 8
+	KLL_MIN_M     int32 = 2
+	KLL_MAX_M     int32 = 8
+
+	KLL_FAMILY_ID int32 = 15
+	// KLL_MAX_NUM_LEVELS bounds the number of levels of a valid sketch, as n
+	// cannot exceed 2^61
+	KLL_MAX_NUM_LEVELS int32 = 61
+)
+
+// KLL byte addresses and bit masks. The first 6 bytes follow the preamble of
+// the classic quantiles sketches, except that PREAMBLE_LONGS_BYTE holds the
+// number of preamble ints instead of longs.
+const (
+	KLL_M_BYTE          = 6
+	KLL_MIN_K_SHORT     = 16 //to 17
+	KLL_NUM_LEVELS_BYTE = 18
+
+	//After Preamble:
+	KLL_DATA_START_SINGLE_ITEM = 8  // the item of a single-item sketch
+	KLL_DATA_START             = 20 // the levels array, then min, max and items
+
+	KLL_PREAMBLE_INTS_SHORT int32 = 2 // empty and single-item sketches
+	KLL_PREAMBLE_INTS_FULL  int32 = 5
+	KLL_SER_VER_1           int32 = 1 // empty or full
+	KLL_SER_VER_2           int32 = 2 // single item
+
+	// flag bit masks
+	KLL_EMPTY_FLAG_MASK             = 1
+	KLL_LEVEL_ZERO_SORTED_FLAG_MASK = 2
+	KLL_SINGLE_ITEM_FLAG_MASK       = 4
+)
+
+const kllPowersOfThreeMaxExponent = 30
+
+var kllPowersOfThree = func() [kllPowersOfThreeMaxExponent + 1]uint64 {
+	var powers [kllPowersOfThreeMaxExponent + 1]uint64
+	powers[0] = 1
+	for i := 1; i < len(powers); i++ {
+		powers[i] = 3 * powers[i-1]
+	}
+	return powers
+}()
+
+// GetKllNormalizedRankError returns the approximate rank error of a KLL
+// sketch with the given k, as a fraction of n, at 99% confidence. See
+// GetNormalizedRankError for the meaning of pmf.
+func GetKllNormalizedRankError(k int32, pmf bool) float64 {
+	if pmf {
+		return 2.446 / math.Pow(float64(k), 0.9433)
+	}
+	return 2.296 / math.Pow(float64(k), 0.9723)
+}
+
+func checkKllK(k int32, m int32) error {
+	if k < m || k > KLL_MAX_K {
+		return newSketchesArgumentError("k must be >= %v and <= %v (got %v)", m, KLL_MAX_K, k)
+	}
+	return nil
+}
+
+func checkKllM(m int32) error {
+	if m < KLL_MIN_M || m > KLL_MAX_M || m%2 != 0 {
+		return newSketchesArgumentError("m must be even, >= %v and <= %v (got %v)", KLL_MIN_M, KLL_MAX_M, m)
+	}
+	return nil
+}
+
+// kllComputeTotalCapacity returns the number of items a sketch with the given
+// number of levels can hold before it must compact.
+func kllComputeTotalCapacity(k int32, m int32, numLevels int32) int32 {
+	var total int32 = 0
+	for height := int32(0); height < numLevels; height++ {
+		total += kllLevelCapacity(k, numLevels, height, m)
+	}
+	return total
+}
+
+// kllLevelCapacity returns the capacity of the level at the given height.
+// Capacities decrease by a factor of 2/3 from the top level down, but never
+// drop below m.
+func kllLevelCapacity(k int32, numLevels int32, height int32, m int32) int32 {
+	depth := numLevels - height - 1
+	capacity := kllIntCapAux(k, depth)
+	if capacity < m {
+		return m
+	}
+	return capacity
+}
+
+func kllIntCapAux(k int32, depth int32) int32 {
+	if depth <= kllPowersOfThreeMaxExponent {
+		return kllIntCapAuxAux(k, depth)
+	}
+	half := depth / 2
+	rest := depth - half
+	tmp := kllIntCapAuxAux(k, half)
+	return kllIntCapAuxAux(tmp, rest)
+}
+
+// kllIntCapAuxAux returns round(k * (2/3)^depth) for depth <= 30.
+func kllIntCapAuxAux(k int32, depth int32) int32 {
+	twoK := uint64(k) << 1
+	tmp := (twoK << uint(depth)) / kllPowersOfThree[depth]
+	return int32((tmp + 1) >> 1)
+}
+
+// kllUbOnNumLevels returns an upper bound on the number of levels of a sketch
+// of the given n.
+func kllUbOnNumLevels(n int64) int32 {
+	if n <= 0 {
+		return 1
+	}
+	return int32(bits.Len64(uint64(n)))
+}
+
+// kllSumLevelWeights returns the total weight of the items in the given
+// levels, where items of level h have weight 2^h, or -1 if the total does not
+// fit in an int64.
+func kllSumLevelWeights(levels []int32) int64 {
+	var total int64 = 0
+	for height := 0; height+1 < len(levels); height++ {
+		pop := int64(levels[height+1] - levels[height])
+		if pop == 0 {
+			continue
+		}
+		if height >= 63 || pop > (math.MaxInt64-total)>>uint(height) {
+			return -1
+		}
+		total += pop << uint(height)
+	}
+	return total
+}
+
+// kllRandomlyHalveDown keeps every other item of the sorted
+// buf[start:start+length], starting at a random one of the first two, and
+// packs them into the lower half of the range.
+func kllRandomlyHalveDown[T FloatItem](buf []T, start int32, length int32, rnd *rand.Rand) {
+	halfLength := length / 2
+	offset := int32(rnd.Int63() & 1)
+	j := start + offset
+	for i := start; i < start+halfLength; i++ {
+		buf[i] = buf[j]
+		j += 2
+	}
+}
+
+// kllRandomlyHalveUp is like kllRandomlyHalveDown, but packs the
+// kept items into the upper half of the range.
+func kllRandomlyHalveUp[T FloatItem](buf []T, start int32, length int32, rnd *rand.Rand) {
+	halfLength := length / 2
+	offset := int32(rnd.Int63() & 1)
+	j := start + length - 1 - offset
+	for i := start + length - 1; i >= start+halfLength; i-- {
+		buf[i] = buf[j]
+		j -= 2
+	}
+}
+
+// kllMergeSortedArrays merges the sorted bufA[startA:startA+lenA] and
+// bufB[startB:startB+lenB] into bufC starting at startC. The buffers may be
+// the same slice as long as the output never overtakes unread input.
+func kllMergeSortedArrays[T FloatItem](bufA []T, startA int32, lenA int32, bufB []T, startB int32, lenB int32, bufC []T, startC int32) {
+	limA := startA + lenA
+	limB := startB + lenB
+	limC := startC + lenA + lenB
+	a := startA
+	b := startB
+	for c := startC; c < limC; c++ {
+		if a == limA {
+			bufC[c] = bufB[b]
+			b++
+		} else if b == limB {
+			bufC[c] = bufA[a]
+			a++
+		} else if bufA[a] < bufB[b] {
+			bufC[c] = bufA[a]
+			a++
+		} else {
+			bufC[c] = bufB[b]
+			b++
+		}
+	}
+}
+
+// kllGeneralCompress compacts the levels described by inLevels, whose
+// items are in buf, until the total number of items fits the capacity of the
+// resulting number of levels. Levels are only ever moved down in buf, and
+// outLevels receives the new level boundaries starting at 0. inLevels and
+// outLevels must have room for at least one level more than the result.
+// It returns the final number of levels, the final capacity and the final
+// number of items.
+func kllGeneralCompress[T FloatItem](k int32, m int32, numLevelsIn int32, buf []T, inLevels []int32, outLevels []int32,
+	isLevelZeroSorted bool, rnd *rand.Rand) (int32, int32, int32) {
+	currentNumLevels := numLevelsIn
+	currentItemCount := inLevels[numLevelsIn] - inLevels[0]
+	targetItemCount := kllComputeTotalCapacity(k, m, currentNumLevels)
+	outLevels[0] = 0
+	for currentLevel := int32(0); currentLevel < currentNumLevels; currentLevel++ {
+		// create an extra level if needed
+		if currentLevel == currentNumLevels-1 {
+			inLevels[currentLevel+2] = inLevels[currentLevel+1]
+		}
+		rawBeg := inLevels[currentLevel]
+		rawLim := inLevels[currentLevel+1]
+		rawPop := rawLim - rawBeg
+
+		if currentItemCount < targetItemCount || rawPop < kllLevelCapacity(k, currentNumLevels, currentLevel, m) {
+			// move the level over as is
+			copy(buf[outLevels[currentLevel]:], buf[rawBeg:rawLim])
+			outLevels[currentLevel+1] = outLevels[currentLevel] + rawPop
+			continue
+		}
+
+		// the sketch and this level are too full, so the level is compacted
+		popAbove := inLevels[currentLevel+2] - rawLim
+		oddPop := rawPop%2 == 1
+		adjBeg := rawBeg
+		adjPop := rawPop
+		if oddPop {
+			adjBeg++
+			adjPop--
+		}
+		halfAdjPop := adjPop / 2
+
+		if oddPop {
+			// the odd item stays at this level
+			buf[outLevels[currentLevel]] = buf[rawBeg]
+			outLevels[currentLevel+1] = outLevels[currentLevel] + 1
+		} else {
+			outLevels[currentLevel+1] = outLevels[currentLevel]
+		}
+
+		if currentLevel == 0 && !isLevelZeroSorted {
+			sortFloats(buf[adjBeg : adjBeg+adjPop])
+		}
+		if popAbove == 0 {
+			kllRandomlyHalveUp(buf, adjBeg, adjPop, rnd)
+		} else {
+			kllRandomlyHalveDown(buf, adjBeg, adjPop, rnd)
+			kllMergeSortedArrays(buf, adjBeg, halfAdjPop, buf, rawLim, popAbove, buf, adjBeg+halfAdjPop)
+		}
+
+		currentItemCount -= halfAdjPop
+		inLevels[currentLevel+1] -= halfAdjPop
+
+		// compacting the old top level adds a level, and with it the capacity
+		// of the new bottom level
+		if currentLevel == currentNumLevels-1 {
+			currentNumLevels++
+			targetItemCount += kllLevelCapacity(k, currentNumLevels, 0, m)
+		}
+	}
+	return currentNumLevels, targetItemCount, currentItemCount
+}
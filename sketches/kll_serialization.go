@@ -0,0 +1,277 @@
+package sketches
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// GetSerializedSizeBytes returns the number of bytes Serialize will produce.
+func (s *KllSketch[T]) GetSerializedSizeBytes() int {
+	itemSize := kllItemSize[T]()
+	if s.IsEmpty() {
+		return KLL_DATA_START_SINGLE_ITEM
+	}
+	if s.n == 1 {
+		return KLL_DATA_START_SINGLE_ITEM + itemSize
+	}
+	numLevels := int(s.getNumLevels())
+	return KLL_DATA_START + numLevels*4 + (int(s.GetNumRetained())+2)*itemSize
+}
+
+// Serialize serializes the sketch in a compact, always little-endian layout
+// modeled on the KLL format of DataSketches Java and C++. It is not
+// tested against sketches written by those libraries, so binary
+// compatibility with them is not guaranteed.
+func (s *KllSketch[T]) Serialize() ([]byte, error) {
+	out := make([]byte, s.GetSerializedSizeBytes())
+	byteOrder := binary.LittleEndian
+	singleItem := s.n == 1
+
+	preInts := KLL_PREAMBLE_INTS_FULL
+	if s.IsEmpty() || singleItem {
+		preInts = KLL_PREAMBLE_INTS_SHORT
+	}
+	serVer := KLL_SER_VER_1
+	if singleItem {
+		serVer = KLL_SER_VER_2
+	}
+	var flags byte = 0
+	if s.IsEmpty() {
+		flags |= KLL_EMPTY_FLAG_MASK
+	}
+	if s.isLevelZeroSorted {
+		flags |= KLL_LEVEL_ZERO_SORTED_FLAG_MASK
+	}
+	if singleItem {
+		flags |= KLL_SINGLE_ITEM_FLAG_MASK
+	}
+
+	out[PREAMBLE_LONGS_BYTE] = byte(preInts)
+	out[SER_VER_BYTE] = byte(serVer)
+	out[FAMILY_BYTE] = byte(KLL_FAMILY_ID)
+	out[FLAGS_BYTE] = flags
+	byteOrder.PutUint16(out[K_SHORT:], uint16(s.k))
+	out[KLL_M_BYTE] = byte(s.m)
+
+	if s.IsEmpty() {
+		return out, nil
+	}
+	if singleItem {
+		putKllItem(out[KLL_DATA_START_SINGLE_ITEM:], byteOrder, s.items[s.levels[0]])
+		return out, nil
+	}
+
+	byteOrder.PutUint64(out[N_LONG:], uint64(s.n))
+	byteOrder.PutUint16(out[KLL_MIN_K_SHORT:], uint16(s.minK))
+	numLevels := s.getNumLevels()
+	out[KLL_NUM_LEVELS_BYTE] = byte(numLevels)
+	offset := KLL_DATA_START
+	// the top of the last level is implied by k, m and the number of levels
+	for _, level := range s.levels[:numLevels] {
+		byteOrder.PutUint32(out[offset:], uint32(level))
+		offset += 4
+	}
+	itemSize := kllItemSize[T]()
+	putKllItem(out[offset:], byteOrder, s.minValue)
+	putKllItem(out[offset+itemSize:], byteOrder, s.maxValue)
+	offset += 2 * itemSize
+	if err := putKllItems(out[offset:], byteOrder, s.items[s.levels[0]:]); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// HeapifyKllDoublesSketch returns a new KllDoublesSketch from the bytes of
+// Serialize. See HeapifyKllSketch.
+func HeapifyKllDoublesSketch(srcBytes []byte) (*KllDoublesSketch, error) {
+	return HeapifyKllSketch[float64](srcBytes)
+}
+
+// HeapifyKllFloatsSketch returns a new KllFloatsSketch from the bytes of
+// Serialize. See HeapifyKllSketch.
+func HeapifyKllFloatsSketch(srcBytes []byte) (*KllFloatsSketch, error) {
+	return HeapifyKllSketch[float32](srcBytes)
+}
+
+// HeapifyKllSketch returns a new sketch from the bytes of Serialize. The
+// format does not record the item type, so T must be the item type of the
+// serialized sketch.
+func HeapifyKllSketch[T FloatItem](srcBytes []byte) (*KllSketch[T], error) {
+	if len(srcBytes) < KLL_DATA_START_SINGLE_ITEM {
+		return nil, newCorruptSketchError("source length < %v: %v", KLL_DATA_START_SINGLE_ITEM, len(srcBytes))
+	}
+	byteOrder := binary.LittleEndian
+	preInts := int32(srcBytes[PREAMBLE_LONGS_BYTE])
+	serVer := int32(srcBytes[SER_VER_BYTE])
+	familyID := int32(srcBytes[FAMILY_BYTE])
+	flags := srcBytes[FLAGS_BYTE]
+	k := int32(byteOrder.Uint16(srcBytes[K_SHORT:]))
+	m := int32(srcBytes[KLL_M_BYTE])
+
+	if familyID != KLL_FAMILY_ID {
+		return nil, fmt.Errorf("%w: expected %v, got %v", ErrFamilyMismatch, KLL_FAMILY_ID, familyID)
+	}
+	if serVer != KLL_SER_VER_1 && serVer != KLL_SER_VER_2 {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedSerVer, serVer)
+	}
+	if err := checkKllM(m); err != nil {
+		return nil, newCorruptSketchError("%v", err)
+	}
+	if err := checkKllK(k, m); err != nil {
+		return nil, newCorruptSketchError("%v", err)
+	}
+	empty := flags&KLL_EMPTY_FLAG_MASK > 0
+	singleItem := flags&KLL_SINGLE_ITEM_FLAG_MASK > 0
+	if empty && singleItem {
+		return nil, newCorruptSketchError("both the empty and the single item flags are set")
+	}
+	if singleItem != (serVer == KLL_SER_VER_2) {
+		return nil, newCorruptSketchError("the single item flag does not match serialization version %v", serVer)
+	}
+	expectedPreInts := KLL_PREAMBLE_INTS_FULL
+	if empty || singleItem {
+		expectedPreInts = KLL_PREAMBLE_INTS_SHORT
+	}
+	if preInts != expectedPreInts {
+		return nil, newCorruptSketchError("preamble ints %v do not match flags %b", preInts, flags)
+	}
+
+	sketch := newKllSketch[T](k, m)
+	itemSize := kllItemSize[T]()
+	if empty {
+		return sketch, nil
+	}
+	if singleItem {
+		if len(srcBytes) < KLL_DATA_START_SINGLE_ITEM+itemSize {
+			return nil, newCorruptSketchError("source length < %v: %v", KLL_DATA_START_SINGLE_ITEM+itemSize, len(srcBytes))
+		}
+		item := getKllItem[T](srcBytes[KLL_DATA_START_SINGLE_ITEM:], byteOrder)
+		if err := sketch.Update(item); err != nil {
+			return nil, err
+		}
+		if sketch.IsEmpty() {
+			return nil, newCorruptSketchError("the single item is NaN")
+		}
+		return sketch, nil
+	}
+
+	if len(srcBytes) < KLL_DATA_START {
+		return nil, newCorruptSketchError("source length < %v: %v", KLL_DATA_START, len(srcBytes))
+	}
+	n := int64(byteOrder.Uint64(srcBytes[N_LONG:]))
+	minK := int32(byteOrder.Uint16(srcBytes[KLL_MIN_K_SHORT:]))
+	numLevels := int32(srcBytes[KLL_NUM_LEVELS_BYTE])
+	if n <= 1 {
+		return nil, newCorruptSketchError("a sketch that is not empty or single-item must have n > 1: %v", n)
+	}
+	if minK < m || minK > k {
+		return nil, newCorruptSketchError("min k must be >= %v and <= k %v (got %v)", m, k, minK)
+	}
+	if numLevels < 1 || numLevels > KLL_MAX_NUM_LEVELS {
+		return nil, newCorruptSketchError("number of levels must be >= 1 and <= %v (got %v)", KLL_MAX_NUM_LEVELS, numLevels)
+	}
+	capacity := kllComputeTotalCapacity(k, m, numLevels)
+	levelsEnd := KLL_DATA_START + int(numLevels)*4
+	itemsStart := levelsEnd + 2*itemSize
+	if len(srcBytes) < itemsStart {
+		return nil, newCorruptSketchError("source length < %v: %v", itemsStart, len(srcBytes))
+	}
+	levels := make([]int32, numLevels+1)
+	for i := range levels[:numLevels] {
+		levels[i] = int32(byteOrder.Uint32(srcBytes[KLL_DATA_START+i*4:]))
+	}
+	levels[numLevels] = capacity
+	for i := int32(0); i < numLevels; i++ {
+		if levels[i] < 0 || levels[i] > levels[i+1] {
+			return nil, newCorruptSketchError("invalid levels array: %v", levels)
+		}
+	}
+	if weight := kllSumLevelWeights(levels); weight != n {
+		return nil, newCorruptSketchError("the total weight of the levels %v does not match n %v", weight, n)
+	}
+	numRetained := capacity - levels[0]
+	if requiredBytes := itemsStart + int(numRetained)*itemSize; len(srcBytes) < requiredBytes {
+		return nil, newCorruptSketchError("source length < %v: %v", requiredBytes, len(srcBytes))
+	}
+
+	sketch.n = n
+	sketch.minK = minK
+	sketch.isLevelZeroSorted = flags&KLL_LEVEL_ZERO_SORTED_FLAG_MASK > 0
+	sketch.levels = levels
+	sketch.items = make([]T, capacity)
+	sketch.minValue = getKllItem[T](srcBytes[levelsEnd:], byteOrder)
+	sketch.maxValue = getKllItem[T](srcBytes[levelsEnd+itemSize:], byteOrder)
+	getKllItems(sketch.items[levels[0]:], srcBytes[itemsStart:], byteOrder)
+	if err := sketch.checkItems(); err != nil {
+		return nil, err
+	}
+	return sketch, nil
+}
+
+// checkItems checks that min <= max, that all items are within [min, max]
+// and that all levels that must be sorted are.
+func (s *KllSketch[T]) checkItems() error {
+	if !(s.minValue <= s.maxValue) {
+		return newCorruptSketchError("min must be <= max (got %v and %v)", s.minValue, s.maxValue)
+	}
+	for level := int32(0); level < s.getNumLevels(); level++ {
+		ordered := level > 0 || s.isLevelZeroSorted
+		items := s.items[s.levels[level]:s.levels[level+1]]
+		for i, item := range items {
+			if !(item >= s.minValue && item <= s.maxValue) {
+				return newCorruptSketchError("item %v is not within [%v, %v] at level %v", item, s.minValue, s.maxValue, level)
+			}
+			if ordered && i > 0 && item < items[i-1] {
+				return newCorruptSketchError("items are not sorted at level %v", level)
+			}
+		}
+	}
+	return nil
+}
+
+// kllItemSize returns the number of bytes of a serialized item of type T.
+func kllItemSize[T FloatItem]() int {
+	var item T
+	if _, ok := any(item).(float32); ok {
+		return 4
+	}
+	return 8
+}
+
+func putKllItem[T FloatItem](b []byte, byteOrder binary.ByteOrder, item T) {
+	switch item := any(item).(type) {
+	case float32:
+		util.BinaryPutFloat32(b, byteOrder, item)
+	case float64:
+		util.BinaryPutFloat64(b, byteOrder, item)
+	}
+}
+
+func getKllItem[T FloatItem](b []byte, byteOrder binary.ByteOrder) T {
+	var item T
+	if _, ok := any(item).(float32); ok {
+		return T(util.BinaryGetFloat32(b, byteOrder))
+	}
+	return T(util.BinaryGetFloat64(b, byteOrder))
+}
+
+func putKllItems[T FloatItem](outBuffer []byte, byteOrder binary.ByteOrder, items []T) error {
+	switch items := any(items).(type) {
+	case []float32:
+		return util.BinaryPutFloat32Slice(outBuffer, byteOrder, items)
+	case []float64:
+		return util.BinaryPutFloat64Slice(outBuffer, byteOrder, items)
+	}
+	return nil
+}
+
+func getKllItems[T FloatItem](items []T, inBuffer []byte, byteOrder binary.ByteOrder) {
+	switch items := any(items).(type) {
+	case []float32:
+		util.BinaryGetFloat32Slice(items, inBuffer, byteOrder)
+	case []float64:
+		util.BinaryGetFloat64Slice(items, inBuffer, byteOrder)
+	}
+}
@@ -0,0 +1,511 @@
+package sketches
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// KllSketch is a KLL quantiles sketch of float32 or float64 items. For the
+// same number of retained items it is more accurate than the classic
+// quantiles DoublesSketch, and it can be updated with weighted items.
+//
+// The items of all levels live in one slice. Level h holds the items
+// items[levels[h]:levels[h+1]], each of weight 2^h, and all levels but level 0
+// are sorted. Level 0 grows downwards from levels[1], and when it reaches the
+// start of the slice, the lowest level that is at capacity is compacted into
+// the level above it.
+type KllSketch[T FloatItem] struct {
+	k                 int32
+	m                 int32
+	minK              int32
+	n                 int64
+	isLevelZeroSorted bool
+	levels            []int32
+	items             []T
+	minValue          T
+	maxValue          T
+
+	sortedView *SortedView[T]
+	rand       *rand.Rand
+}
+
+// KllDoublesSketch is a KLL sketch of float64 items.
+type KllDoublesSketch = KllSketch[float64]
+
+// KllFloatsSketch is a KLL sketch of float32 items. It takes half the memory
+// and serialized size per item of KllDoublesSketch, which suits items like
+// latencies that do not need float64 precision.
+type KllFloatsSketch = KllSketch[float32]
+
+// NewKllSketch returns an empty KLL sketch with the given k, which must be
+// between KLL_MIN_K and KLL_MAX_K. KLL_DEFAULT_K is a good default.
+func NewKllSketch[T FloatItem](k int) (*KllSketch[T], error) {
+	if err := checkKllK(int32(k), KLL_DEFAULT_M); err != nil {
+		return nil, err
+	}
+	return newKllSketch[T](int32(k), KLL_DEFAULT_M), nil
+}
+
+// NewKllDoublesSketch returns an empty KllDoublesSketch. See NewKllSketch.
+func NewKllDoublesSketch(k int) (*KllDoublesSketch, error) {
+	return NewKllSketch[float64](k)
+}
+
+// NewKllFloatsSketch returns an empty KllFloatsSketch. See NewKllSketch.
+func NewKllFloatsSketch(k int) (*KllFloatsSketch, error) {
+	return NewKllSketch[float32](k)
+}
+
+func newKllSketch[T FloatItem](k int32, m int32) *KllSketch[T] {
+	return &KllSketch[T]{
+		k:        k,
+		m:        m,
+		minK:     k,
+		levels:   []int32{k, k},
+		items:    make([]T, k),
+		minValue: T(math.NaN()),
+		maxValue: T(math.NaN()),
+	}
+}
+
+// newKllSketchWeighted returns a sketch of a single item with the given
+// weight, which holds one copy of the item for each bit set in the weight.
+func newKllSketchWeighted[T FloatItem](k int32, m int32, item T, weight int64) *KllSketch[T] {
+	numLevels := kllUbOnNumLevels(weight)
+	levels := make([]int32, numLevels+1)
+	for height := int32(0); height < numLevels; height++ {
+		levels[height+1] = levels[height] + int32((weight>>uint(height))&1)
+	}
+	items := make([]T, levels[numLevels])
+	for i := range items {
+		items[i] = item
+	}
+	return &KllSketch[T]{
+		k:                 k,
+		m:                 m,
+		minK:              k,
+		n:                 weight,
+		isLevelZeroSorted: true,
+		levels:            levels,
+		items:             items,
+		minValue:          item,
+		maxValue:          item,
+	}
+}
+
+func (s *KllSketch[T]) GetK() int32 {
+	return s.k
+}
+
+// GetMinK returns the smallest k of this sketch and all sketches merged into
+// it, which determines the rank error.
+func (s *KllSketch[T]) GetMinK() int32 {
+	return s.minK
+}
+
+func (s *KllSketch[T]) GetN() int64 {
+	return s.n
+}
+
+func (s *KllSketch[T]) IsEmpty() bool {
+	return s.n == 0
+}
+
+// IsEstimationMode returns true once the sketch has compacted items, so that
+// its results are approximate.
+func (s *KllSketch[T]) IsEstimationMode() bool {
+	return s.getNumLevels() > 1
+}
+
+// GetNumRetained returns the number of items retained by the sketch.
+func (s *KllSketch[T]) GetNumRetained() int32 {
+	return s.levels[len(s.levels)-1] - s.levels[0]
+}
+
+func (s *KllSketch[T]) GetMinValue() T {
+	return s.minValue
+}
+
+func (s *KllSketch[T]) GetMaxValue() T {
+	return s.maxValue
+}
+
+// GetNormalizedRankError returns the normalized rank error of this sketch,
+// given its min k. See GetKllNormalizedRankError.
+func (s *KllSketch[T]) GetNormalizedRankError(pmf bool) float64 {
+	return GetKllNormalizedRankError(s.minK, pmf)
+}
+
+func (s *KllSketch[T]) getNumLevels() int32 {
+	return int32(len(s.levels)) - 1
+}
+
+func (s *KllSketch[T]) getLevelSize(level int32) int32 {
+	if level >= s.getNumLevels() {
+		return 0
+	}
+	return s.levels[level+1] - s.levels[level]
+}
+
+func (s *KllSketch[T]) getRandom() *rand.Rand {
+	if s.rand == nil {
+		s.rand = rand.New(util.NewSplitMix64Source(rand.Int63()))
+	}
+	return s.rand
+}
+
+// Reset returns the sketch to its empty state, keeping k.
+func (s *KllSketch[T]) Reset() {
+	rnd := s.rand
+	*s = *newKllSketch[T](s.k, s.m)
+	s.rand = rnd
+}
+
+// UPDATES
+
+// Update updates the sketch with the given item. NaNs are ignored.
+func (s *KllSketch[T]) Update(dataItem T) error {
+	if math.IsNaN(float64(dataItem)) {
+		return nil
+	}
+	s.updateMinMax(dataItem)
+	s.internalUpdate(dataItem)
+	s.n++
+	s.sortedView = nil
+	return nil
+}
+
+// UpdateWeighted updates the sketch with the given item as if Update were
+// called weight times, which must be at least 1. NaNs are ignored.
+func (s *KllSketch[T]) UpdateWeighted(dataItem T, weight int64) error {
+	if weight < 1 {
+		return newSketchesArgumentError("weight must be >= 1 (got %v)", weight)
+	}
+	if math.IsNaN(float64(dataItem)) {
+		return nil
+	}
+	if weight < int64(s.levels[0]) {
+		// fits into the free space of level 0
+		for i := int64(0); i < weight; i++ {
+			if err := s.Update(dataItem); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return s.Merge(newKllSketchWeighted(s.k, s.m, dataItem, weight))
+}
+
+func (s *KllSketch[T]) updateMinMax(dataItem T) {
+	if s.IsEmpty() {
+		s.minValue = dataItem
+		s.maxValue = dataItem
+		return
+	}
+	if dataItem < s.minValue {
+		s.minValue = dataItem
+	}
+	if dataItem > s.maxValue {
+		s.maxValue = dataItem
+	}
+}
+
+// internalUpdate adds the item to level 0 without updating n, min or max.
+func (s *KllSketch[T]) internalUpdate(dataItem T) {
+	if s.levels[0] == 0 {
+		s.compressWhileUpdating()
+	}
+	s.isLevelZeroSorted = false
+	s.levels[0]--
+	s.items[s.levels[0]] = dataItem
+}
+
+// compressWhileUpdating compacts the lowest level that is at capacity, adding
+// a level first if it is the top level. This frees space at the start of
+// items for level 0.
+func (s *KllSketch[T]) compressWhileUpdating() {
+	level := s.findLevelToCompact()
+	if level == s.getNumLevels()-1 {
+		s.addEmptyTopLevelToCompletelyFullSketch()
+	}
+
+	rawBeg := s.levels[level]
+	rawLim := s.levels[level+1]
+	popAbove := s.levels[level+2] - rawLim
+	rawPop := rawLim - rawBeg
+	oddPop := rawPop%2 == 1
+	adjBeg := rawBeg
+	adjPop := rawPop
+	if oddPop {
+		adjBeg++
+		adjPop--
+	}
+	halfAdjPop := adjPop / 2
+
+	if level == 0 && !s.isLevelZeroSorted {
+		sortFloats(s.items[adjBeg : adjBeg+adjPop])
+	}
+	if popAbove == 0 {
+		kllRandomlyHalveUp(s.items, adjBeg, adjPop, s.getRandom())
+	} else {
+		kllRandomlyHalveDown(s.items, adjBeg, adjPop, s.getRandom())
+		kllMergeSortedArrays(s.items, adjBeg, halfAdjPop, s.items, rawLim, popAbove, s.items, adjBeg+halfAdjPop)
+	}
+
+	s.levels[level+1] -= halfAdjPop
+	if oddPop {
+		// the odd item stays at this level, right below the level above
+		s.levels[level] = s.levels[level+1] - 1
+		s.items[s.levels[level]] = s.items[rawBeg]
+	} else {
+		s.levels[level] = s.levels[level+1]
+	}
+	util.Assert(s.levels[level] == rawBeg+halfAdjPop, "levels[level] == rawBeg + halfAdjPop")
+
+	// shift the levels below up into the space that was freed
+	if level > 0 {
+		amount := rawBeg - s.levels[0]
+		copy(s.items[s.levels[0]+halfAdjPop:], s.items[s.levels[0]:s.levels[0]+amount])
+		for lvl := int32(0); lvl < level; lvl++ {
+			s.levels[lvl] += halfAdjPop
+		}
+	}
+}
+
+func (s *KllSketch[T]) findLevelToCompact() int32 {
+	numLevels := s.getNumLevels()
+	for level := int32(0); ; level++ {
+		util.Assert(level < numLevels, "level < numLevels")
+		pop := s.levels[level+1] - s.levels[level]
+		if pop >= kllLevelCapacity(s.k, numLevels, level, s.m) {
+			return level
+		}
+	}
+}
+
+// addEmptyTopLevelToCompletelyFullSketch grows items by the capacity of the
+// new bottom level, moving all existing items up.
+func (s *KllSketch[T]) addEmptyTopLevelToCompletelyFullSketch() {
+	numLevels := s.getNumLevels()
+	curTotalCap := s.levels[numLevels]
+	util.Assert(s.levels[0] == 0, "levels[0] == 0")
+	deltaCap := kllLevelCapacity(s.k, numLevels+1, 0, s.m)
+	newTotalCap := curTotalCap + deltaCap
+
+	newItems := make([]T, newTotalCap)
+	copy(newItems[deltaCap:], s.items[:curTotalCap])
+	for i := range s.levels {
+		s.levels[i] += deltaCap
+	}
+	util.Assert(s.levels[numLevels] == newTotalCap, "levels[numLevels] == newTotalCap")
+	s.levels = append(s.levels, newTotalCap)
+	s.items = newItems
+}
+
+// MERGE
+
+// Merge merges the other sketch into this one. The sketches may have
+// different k; the rank error of the result follows the smaller one. The
+// other sketch is not modified.
+func (s *KllSketch[T]) Merge(other *KllSketch[T]) error {
+	if other == nil || other.IsEmpty() {
+		return nil
+	}
+	if s.m != other.m {
+		return newSketchesArgumentError("incompatible m: %v and %v", s.m, other.m)
+	}
+	if other == s {
+		other = s.copy()
+	}
+	finalN := s.n + other.n
+
+	if s.IsEmpty() {
+		s.minValue = other.minValue
+		s.maxValue = other.maxValue
+	} else {
+		if other.minValue < s.minValue {
+			s.minValue = other.minValue
+		}
+		if other.maxValue > s.maxValue {
+			s.maxValue = other.maxValue
+		}
+	}
+	for i := other.levels[0]; i < other.levels[1]; i++ {
+		s.internalUpdate(other.items[i])
+	}
+	if other.getNumLevels() >= 2 {
+		s.mergeHigherLevels(other, finalN)
+	}
+	s.n = finalN
+	if other.IsEstimationMode() && other.minK < s.minK {
+		s.minK = other.minK
+	}
+	s.sortedView = nil
+	return nil
+}
+
+// mergeHigherLevels merges the levels above level 0 of other into this
+// sketch, after the level 0 items of other were added to level 0.
+func (s *KllSketch[T]) mergeHigherLevels(other *KllSketch[T], finalN int64) {
+	tmpNumItems := s.GetNumRetained() + (other.levels[len(other.levels)-1] - other.levels[1])
+	workbuf := make([]T, tmpNumItems)
+	ub := kllUbOnNumLevels(finalN)
+	worklevels := make([]int32, ub+2)
+	outlevels := make([]int32, ub+2)
+
+	provisionalNumLevels := s.getNumLevels()
+	if other.getNumLevels() > provisionalNumLevels {
+		provisionalNumLevels = other.getNumLevels()
+	}
+	s.populateWorkArrays(other, workbuf, worklevels, provisionalNumLevels)
+
+	finalNumLevels, finalCapacity, finalPop := kllGeneralCompress(s.k, s.m, provisionalNumLevels, workbuf,
+		worklevels, outlevels, s.isLevelZeroSorted, s.getRandom())
+
+	// transfer the result back into this sketch, with the free space at the
+	// bottom
+	newItems := make([]T, finalCapacity)
+	freeSpaceAtBottom := finalCapacity - finalPop
+	copy(newItems[freeSpaceAtBottom:], workbuf[outlevels[0]:outlevels[0]+finalPop])
+	theShift := freeSpaceAtBottom - outlevels[0]
+	newLevels := make([]int32, finalNumLevels+1)
+	for lvl := range newLevels {
+		newLevels[lvl] = outlevels[lvl] + theShift
+	}
+	s.levels = newLevels
+	s.items = newItems
+}
+
+func (s *KllSketch[T]) populateWorkArrays(other *KllSketch[T], workbuf []T, worklevels []int32, provisionalNumLevels int32) {
+	worklevels[0] = 0
+	// the level 0 items of other are already in level 0 of this sketch
+	selfPopZero := s.getLevelSize(0)
+	copy(workbuf, s.items[s.levels[0]:s.levels[0]+selfPopZero])
+	worklevels[1] = worklevels[0] + selfPopZero
+
+	for lvl := int32(1); lvl < provisionalNumLevels; lvl++ {
+		selfPop := s.getLevelSize(lvl)
+		otherPop := other.getLevelSize(lvl)
+		worklevels[lvl+1] = worklevels[lvl] + selfPop + otherPop
+		if selfPop > 0 && otherPop == 0 {
+			copy(workbuf[worklevels[lvl]:], s.items[s.levels[lvl]:s.levels[lvl]+selfPop])
+		} else if selfPop == 0 && otherPop > 0 {
+			copy(workbuf[worklevels[lvl]:], other.items[other.levels[lvl]:other.levels[lvl]+otherPop])
+		} else if selfPop > 0 && otherPop > 0 {
+			kllMergeSortedArrays(s.items, s.levels[lvl], selfPop, other.items, other.levels[lvl], otherPop,
+				workbuf, worklevels[lvl])
+		}
+	}
+}
+
+func (s *KllSketch[T]) copy() *KllSketch[T] {
+	c := *s
+	c.levels = append([]int32{}, s.levels...)
+	c.items = append([]T{}, s.items...)
+	c.sortedView = nil
+	c.rand = nil
+	return &c
+}
+
+// QUERIES
+
+// GetSortedView returns the sorted view of this sketch. The view is built on
+// first use and cached until the sketch is next updated, so it must not be
+// called concurrently with updates.
+func (s *KllSketch[T]) GetSortedView() *SortedView[T] {
+	if s.sortedView == nil {
+		s.sortedView = s.newSortedView()
+	}
+	return s.sortedView
+}
+
+func (s *KllSketch[T]) newSortedView() *SortedView[T] {
+	numRetained := s.GetNumRetained()
+	items := make([]T, numRetained)
+	weights := make([]int64, numRetained)
+	copy(items, s.items[s.levels[0]:])
+	sortFloats(items[:s.getLevelSize(0)])
+
+	numLevels := s.getNumLevels()
+	runs := make([]int32, 0, numLevels+1)
+	var weight int64 = 1
+	for level := int32(0); level < numLevels; level++ {
+		start := s.levels[level] - s.levels[0]
+		end := s.levels[level+1] - s.levels[0]
+		for i := start; i < end; i++ {
+			weights[i] = weight
+		}
+		if start < end {
+			runs = append(runs, start)
+		}
+		weight <<= 1
+	}
+	runs = append(runs, numRetained)
+	tandemMergeSortRuns(items, weights, runs)
+
+	var cumWeight int64 = 0
+	for i := range weights {
+		cumWeight += weights[i]
+		weights[i] = cumWeight
+	}
+	util.Assert(cumWeight == s.n, "cumWeight == n")
+
+	return &SortedView[T]{
+		n:          s.n,
+		items:      items,
+		cumWeights: weights,
+	}
+}
+
+// GetQuantile returns the approximate quantile of the given normalized rank,
+// which must be in the range [0, 1]. An empty sketch returns NaN.
+func (s *KllSketch[T]) GetQuantile(rank float64, searchCrit QuantileSearchCriteria) (T, error) {
+	if err := checkNormalizedRankBounds(rank); err != nil {
+		return T(math.NaN()), err
+	}
+	if s.IsEmpty() {
+		return T(math.NaN()), nil
+	}
+	return s.GetSortedView().getQuantile(rank, searchCrit), nil
+}
+
+// GetQuantiles returns the approximate quantiles of the given normalized
+// ranks. An empty sketch returns nil.
+func (s *KllSketch[T]) GetQuantiles(ranks []float64, searchCrit QuantileSearchCriteria) ([]T, error) {
+	for _, rank := range ranks {
+		if err := checkNormalizedRankBounds(rank); err != nil {
+			return nil, err
+		}
+	}
+	if s.IsEmpty() {
+		return nil, nil
+	}
+	sortedView := s.GetSortedView()
+	quantiles := make([]T, len(ranks))
+	for i, rank := range ranks {
+		quantiles[i] = sortedView.getQuantile(rank, searchCrit)
+	}
+	return quantiles, nil
+}
+
+// GetRank returns the approximate normalized rank of the given value. An
+// empty sketch returns NaN.
+func (s *KllSketch[T]) GetRank(value T, searchCrit QuantileSearchCriteria) (float64, error) {
+	return s.GetSortedView().GetRank(value, searchCrit)
+}
+
+// GetCDF returns the approximate cumulative distribution function over the
+// intervals defined by splitPoints, which must be unique, monotonically
+// increasing and not NaN. An empty sketch returns nil.
+func (s *KllSketch[T]) GetCDF(splitPoints []T, searchCrit QuantileSearchCriteria) ([]float64, error) {
+	return s.GetSortedView().GetCDF(splitPoints, searchCrit)
+}
+
+// GetPMF returns the approximate probability mass function over the
+// len(splitPoints)+1 intervals defined by splitPoints. An empty sketch
+// returns nil.
+func (s *KllSketch[T]) GetPMF(splitPoints []T, searchCrit QuantileSearchCriteria) ([]float64, error) {
+	return s.GetSortedView().GetPMF(splitPoints, searchCrit)
+}
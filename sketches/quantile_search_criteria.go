@@ -0,0 +1,23 @@
+package sketches
+
+// QuantileSearchCriteria determines whether the weight of an item equal to
+// the searched value is included when computing ranks and quantiles.
+type QuantileSearchCriteria int
+
+const (
+	// INCLUSIVE counts items less than or equal to the searched value.
+	INCLUSIVE QuantileSearchCriteria = iota
+	// EXCLUSIVE counts only items strictly less than the searched value.
+	EXCLUSIVE
+)
+
+func (c QuantileSearchCriteria) String() string {
+	switch c {
+	case INCLUSIVE:
+		return "INCLUSIVE"
+	case EXCLUSIVE:
+		return "EXCLUSIVE"
+	default:
+		return "UNKNOWN"
+	}
+}
@@ -0,0 +1,123 @@
+package sketches
+
+import "math"
+
+// GetSortedView returns the sorted view of this sketch. The view is built on
+// first use and cached until the sketch is next updated, so it must not be
+// called concurrently with updates.
+func (s *DoublesSketchImpl) GetSortedView() *DoublesSketchSortedView {
+	if s.sortedView == nil {
+		s.sortedView = NewDoublesSketchSortedView(s)
+	}
+	return s.sortedView
+}
+
+func (s *DoublesSketchImpl) resetSortedView() {
+	s.sortedView = nil
+}
+
+// GetQuantile returns the approximate quantile of the given normalized rank,
+// which must be in the range [0, 1]. An empty sketch returns NaN.
+func (s *DoublesSketchImpl) GetQuantile(rank float64) (float64, error) {
+	if err := checkNormalizedRankBounds(rank); err != nil {
+		return math.NaN(), err
+	}
+	if s.IsEmpty() {
+		return math.NaN(), nil
+	}
+	return s.GetSortedView().getQuantile(rank, INCLUSIVE), nil
+}
+
+// GetQuantiles returns the approximate quantiles of the given normalized
+// ranks. An empty sketch returns nil.
+func (s *DoublesSketchImpl) GetQuantiles(ranks []float64) ([]float64, error) {
+	for _, rank := range ranks {
+		if err := checkNormalizedRankBounds(rank); err != nil {
+			return nil, err
+		}
+	}
+	if s.IsEmpty() {
+		return nil, nil
+	}
+	sortedView := s.GetSortedView()
+	quantiles := make([]float64, len(ranks))
+	for i, rank := range ranks {
+		quantiles[i] = sortedView.getQuantile(rank, INCLUSIVE)
+	}
+	return quantiles, nil
+}
+
+// GetEvenlySpacedQuantiles returns num quantiles at evenly spaced normalized
+// ranks from 0 to 1 inclusive. num must be at least 2.
+func (s *DoublesSketchImpl) GetEvenlySpacedQuantiles(num int) ([]float64, error) {
+	if num < 2 {
+		return nil, newSketchesArgumentError("num must be >= 2 (got %v)", num)
+	}
+	return s.GetQuantiles(evenlySpacedRanks(num))
+}
+
+// GetRank returns the approximate normalized rank of the given value. With
+// INCLUSIVE search criteria the weight of items equal to value is included.
+// An empty sketch returns NaN.
+func (s *DoublesSketchImpl) GetRank(value float64, searchCrit QuantileSearchCriteria) (float64, error) {
+	if s.IsEmpty() {
+		return math.NaN(), nil
+	}
+	return s.GetSortedView().getRank(value, searchCrit), nil
+}
+
+// GetCDF returns the approximate cumulative distribution function over the
+// intervals defined by splitPoints, which must be unique, monotonically
+// increasing and not NaN. The last entry of the result is always 1.
+// An empty sketch returns nil.
+func (s *DoublesSketchImpl) GetCDF(splitPoints []float64, searchCrit QuantileSearchCriteria) ([]float64, error) {
+	if err := checkSplitPoints(splitPoints); err != nil {
+		return nil, err
+	}
+	if s.IsEmpty() {
+		return nil, nil
+	}
+	return s.GetSortedView().getCDF(splitPoints, searchCrit), nil
+}
+
+// GetPMF returns the approximate probability mass function over the
+// len(splitPoints)+1 intervals defined by splitPoints, which must be unique,
+// monotonically increasing and not NaN. An empty sketch returns nil.
+func (s *DoublesSketchImpl) GetPMF(splitPoints []float64, searchCrit QuantileSearchCriteria) ([]float64, error) {
+	if err := checkSplitPoints(splitPoints); err != nil {
+		return nil, err
+	}
+	if s.IsEmpty() {
+		return nil, nil
+	}
+	return s.GetSortedView().getPMF(splitPoints, searchCrit), nil
+}
+
+func evenlySpacedRanks(num int) []float64 {
+	ranks := make([]float64, num)
+	delta := 1.0 / float64(num-1)
+	for i := 1; i < num-1; i++ {
+		ranks[i] = float64(i) * delta
+	}
+	ranks[num-1] = 1.0
+	return ranks
+}
+
+func checkNormalizedRankBounds(rank float64) error {
+	if !(rank >= 0.0 && rank <= 1.0) {
+		return newSketchesArgumentError("a normalized rank must be >= 0 and <= 1 (got %v)", rank)
+	}
+	return nil
+}
+
+func checkSplitPoints[T FloatItem](splitPoints []T) error {
+	if len(splitPoints) == 1 && math.IsNaN(float64(splitPoints[0])) {
+		return newSketchesArgumentError("split points must be unique, monotonically increasing and not NaN")
+	}
+	for i := 0; i < len(splitPoints)-1; i++ {
+		if !(splitPoints[i] < splitPoints[i+1]) {
+			return newSketchesArgumentError("split points must be unique, monotonically increasing and not NaN")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package sketches
+
+import (
+	"errors"
+	"math"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QuantilesDoublesSketch queries", func() {
+	It("Returns NaN quantiles for an empty sketch", func() {
+		sketch, err := NewDoublesSketch(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		quantile, err := sketch.GetQuantile(0.5)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(math.IsNaN(quantile)).To(BeTrue())
+		quantiles, err := sketch.GetQuantiles([]float64{0, 0.5, 1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quantiles).To(BeNil())
+	})
+
+	It("Rejects ranks outside of [0, 1]", func() {
+		sketch, err := NewDoublesSketch(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = sketch.GetQuantile(-0.1)
+		Expect(err).To(HaveOccurred())
+		_, err = sketch.GetQuantiles([]float64{0.5, 1.1})
+		Expect(err).To(HaveOccurred())
+		_, err = sketch.GetQuantile(math.NaN())
+		Expect(err).To(HaveOccurred())
+		_, err = sketch.GetEvenlySpacedQuantiles(1)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Returns exact quantiles in exact mode", func() {
+		sketch, err := NewDoublesSketch(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 1; i <= 10; i++ {
+			Expect(sketch.Update(float64(i))).To(Succeed())
+		}
+		quantile, err := sketch.GetQuantile(0.3)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quantile).To(Equal(3.0))
+
+		quantiles, err := sketch.GetQuantiles([]float64{0, 0.5, 0.55, 1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quantiles).To(Equal([]float64{1, 5, 6, 10}))
+
+		quantiles, err = sketch.GetEvenlySpacedQuantiles(3)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quantiles).To(Equal([]float64{1, 5, 10}))
+	})
+
+	It("Returns the same quantiles from the compact sketch", func() {
+		sketch, err := NewDoublesSketch(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < 10000; i++ {
+			Expect(sketch.Update(float64(i))).To(Succeed())
+		}
+		expected, err := sketch.GetEvenlySpacedQuantiles(11)
+		Expect(err).ToNot(HaveOccurred())
+		actual, err := sketch.Compact().GetEvenlySpacedQuantiles(11)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(Equal(expected))
+	})
+
+	It("Returns approximate quantiles within the rank error in estimation mode", func() {
+		n := 100000
+		sketch, err := NewDoublesSketch(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < n; i++ {
+			Expect(sketch.Update(float64(i))).To(Succeed())
+		}
+		for _, rank := range []float64{0.01, 0.1, 0.5, 0.9, 0.99} {
+			quantile, err := sketch.GetQuantile(rank)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(quantile / float64(n)).To(BeNumerically("~", rank, 0.02))
+		}
+	})
+
+	It("Returns ranks with inclusive and exclusive search criteria", func() {
+		sketch, err := NewDoublesSketch(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		rank, err := sketch.GetRank(1, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(math.IsNaN(rank)).To(BeTrue())
+
+		for i := 1; i <= 10; i++ {
+			Expect(sketch.Update(float64(i))).To(Succeed())
+		}
+		rank, err = sketch.GetRank(5, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rank).To(Equal(0.5))
+		rank, err = sketch.GetRank(5, EXCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rank).To(Equal(0.4))
+		rank, err = sketch.GetRank(0, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rank).To(Equal(0.0))
+		rank, err = sketch.GetRank(11, EXCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rank).To(Equal(1.0))
+	})
+
+	It("Returns the CDF and PMF over split points", func() {
+		sketch, err := NewDoublesSketch(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 1; i <= 10; i++ {
+			Expect(sketch.Update(float64(i))).To(Succeed())
+		}
+		cdf, err := sketch.GetCDF([]float64{2, 5}, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cdf).To(Equal([]float64{0.2, 0.5, 1}))
+		pmf, err := sketch.GetPMF([]float64{2, 5}, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pmf[0]).To(BeNumerically("~", 0.2, 1e-12))
+		Expect(pmf[1]).To(BeNumerically("~", 0.3, 1e-12))
+		Expect(pmf[2]).To(BeNumerically("~", 0.5, 1e-12))
+		pmf, err = sketch.GetPMF([]float64{2, 5}, EXCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pmf[0]).To(BeNumerically("~", 0.1, 1e-12))
+		Expect(pmf[1]).To(BeNumerically("~", 0.3, 1e-12))
+		Expect(pmf[2]).To(BeNumerically("~", 0.6, 1e-12))
+	})
+
+	It("Rejects invalid split points", func() {
+		sketch, err := NewDoublesSketch(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		var argErr *SketchesArgumentError
+		for _, splitPoints := range [][]float64{{2, 1}, {1, 1}, {math.NaN()}, {1, math.NaN()}} {
+			_, err = sketch.GetCDF(splitPoints, INCLUSIVE)
+			Expect(errors.As(err, &argErr)).To(BeTrue())
+			_, err = sketch.GetPMF(splitPoints, EXCLUSIVE)
+			Expect(errors.As(err, &argErr)).To(BeTrue())
+		}
+	})
+
+	It("Answers CDF and PMF queries on an empty sketch without a sorted view", func() {
+		sketch, err := NewDoublesSketch(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		cdf, err := sketch.GetCDF([]float64{1, 2}, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cdf).To(BeNil())
+		pmf, err := sketch.GetPMF([]float64{1, 2}, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pmf).To(BeNil())
+		Expect(sketch.sortedView).To(BeNil())
+
+		var argErr *SketchesArgumentError
+		_, err = sketch.GetPMF([]float64{2, 1}, INCLUSIVE)
+		Expect(errors.As(err, &argErr)).To(BeTrue())
+		Expect(sketch.sortedView).To(BeNil())
+	})
+
+	It("Rejects an invalid k with an argument error", func() {
+		var argErr *SketchesArgumentError
+		_, err := NewDoublesSketch(100)
+		Expect(errors.As(err, &argErr)).To(BeTrue())
+		_, err = NewDoublesUnion(100)
+		Expect(errors.As(err, &argErr)).To(BeTrue())
+		_, err = NewDoublesSketchBuilder().SetK(100).Build()
+		Expect(errors.As(err, &argErr)).To(BeTrue())
+		_, err = NewDoublesSketchBuilder().SetK(100).BuildUnion()
+		Expect(errors.As(err, &argErr)).To(BeTrue())
+		_, err = NewDirectUpdateDoublesSketch(100, make([]byte, 1024), nil)
+		Expect(errors.As(err, &argErr)).To(BeTrue())
+	})
+})
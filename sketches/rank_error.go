@@ -0,0 +1,68 @@
+package sketches
+
+import "math"
+
+// GetNormalizedRankError returns the approximate rank error of a sketch with
+// the given k, as a fraction of n, at 99% confidence. With pmf true it returns
+// the "double-sided" error that applies to each bucket of GetPMF, otherwise the
+// "single-sided" error that applies to GetRank, GetQuantile and GetCDF. The
+// constants are the empirical fit over all valid k used by DataSketches Java.
+func GetNormalizedRankError(k int32, pmf bool) float64 {
+	if pmf {
+		return 1.854 / math.Pow(float64(k), 0.9657)
+	}
+	return 1.576 / math.Pow(float64(k), 0.9726)
+}
+
+// GetKFromEpsilon returns the smallest valid k whose normalized rank error is
+// at most epsilon. It is the inverse of GetNormalizedRankError.
+func GetKFromEpsilon(epsilon float64, pmf bool) (int32, error) {
+	if !(epsilon > 0 && epsilon < 1) {
+		return 0, newSketchesArgumentError("epsilon must be > 0 and < 1 (got %v)", epsilon)
+	}
+	for k := MIN_K; k <= MAX_K; k <<= 1 {
+		if GetNormalizedRankError(k, pmf) <= epsilon {
+			return k, nil
+		}
+	}
+	return 0, newSketchesArgumentError("epsilon must be >= %v, the error of k = %v (got %v)",
+		GetNormalizedRankError(MAX_K, pmf), MAX_K, epsilon)
+}
+
+// GetNormalizedRankError returns the normalized rank error of this sketch. See
+// the package-level GetNormalizedRankError.
+func (s *DoublesSketchImpl) GetNormalizedRankError(pmf bool) float64 {
+	return GetNormalizedRankError(s.GetK(), pmf)
+}
+
+// GetQuantileLowerBound returns the quantile of the given normalized rank
+// minus the rank error, a lower bound of the true quantile at 99% confidence.
+// An empty sketch returns NaN.
+func (s *DoublesSketchImpl) GetQuantileLowerBound(rank float64) (float64, error) {
+	if err := checkNormalizedRankBounds(rank); err != nil {
+		return math.NaN(), err
+	}
+	return s.GetQuantile(s.GetRankLowerBound(rank))
+}
+
+// GetQuantileUpperBound returns the quantile of the given normalized rank
+// plus the rank error, an upper bound of the true quantile at 99% confidence.
+// An empty sketch returns NaN.
+func (s *DoublesSketchImpl) GetQuantileUpperBound(rank float64) (float64, error) {
+	if err := checkNormalizedRankBounds(rank); err != nil {
+		return math.NaN(), err
+	}
+	return s.GetQuantile(s.GetRankUpperBound(rank))
+}
+
+// GetRankLowerBound returns the given normalized rank minus the rank error,
+// but not less than 0.
+func (s *DoublesSketchImpl) GetRankLowerBound(rank float64) float64 {
+	return math.Max(0.0, rank-s.GetNormalizedRankError(false))
+}
+
+// GetRankUpperBound returns the given normalized rank plus the rank error, but
+// not more than 1.
+func (s *DoublesSketchImpl) GetRankUpperBound(rank float64) float64 {
+	return math.Min(1.0, rank+s.GetNormalizedRankError(false))
+}
@@ -0,0 +1,59 @@
+package sketches
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rank error", func() {
+	It("Matches the Java empirical error", func() {
+		Expect(GetNormalizedRankError(128, false)).To(BeNumerically("~", 0.014063, 1e-6))
+		Expect(GetNormalizedRankError(128, true)).To(BeNumerically("~", 0.017107, 1e-6))
+		Expect(GetNormalizedRankError(MIN_K, false)).To(BeNumerically(">", GetNormalizedRankError(MAX_K, false)))
+	})
+
+	It("Picks the smallest k for an epsilon", func() {
+		k, err := GetKFromEpsilon(0.01, false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(k).To(Equal(int32(256)))
+		Expect(GetNormalizedRankError(k, false)).To(BeNumerically("<=", 0.01))
+		Expect(GetNormalizedRankError(k/2, false)).To(BeNumerically(">", 0.01))
+
+		k, err = GetKFromEpsilon(GetNormalizedRankError(DEFAULT_K, true), true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(k).To(Equal(DEFAULT_K))
+
+		_, err = GetKFromEpsilon(0, false)
+		Expect(err).To(HaveOccurred())
+		_, err = GetKFromEpsilon(1e-6, false)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Bounds the true quantile and rank", func() {
+		n := 100000
+		sketch, err := NewDoublesSketchBuilder().SetRandomSeed(1).Build()
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < n; i++ {
+			Expect(sketch.Update(float64(i))).To(Succeed())
+		}
+		Expect(sketch.GetNormalizedRankError(false)).To(Equal(GetNormalizedRankError(int32(defaultK), false)))
+
+		for _, rank := range []float64{0.01, 0.25, 0.5, 0.99} {
+			lower, err := sketch.GetQuantileLowerBound(rank)
+			Expect(err).ToNot(HaveOccurred())
+			upper, err := sketch.GetQuantileUpperBound(rank)
+			Expect(err).ToNot(HaveOccurred())
+			trueQuantile := rank * float64(n-1)
+			Expect(lower).To(BeNumerically("<=", trueQuantile))
+			Expect(upper).To(BeNumerically(">=", trueQuantile))
+
+			Expect(sketch.GetRankLowerBound(rank)).To(BeNumerically(">=", 0))
+			Expect(sketch.GetRankUpperBound(rank)).To(BeNumerically("<=", 1))
+			Expect(sketch.GetRankLowerBound(rank)).To(BeNumerically("<=", rank))
+			Expect(sketch.GetRankUpperBound(rank)).To(BeNumerically(">=", rank))
+		}
+
+		_, err = sketch.GetQuantileLowerBound(1.5)
+		Expect(err).To(HaveOccurred())
+	})
+})
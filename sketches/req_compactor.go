@@ -0,0 +1,208 @@
+package sketches
+
+import (
+	"math"
+	"math/bits"
+	"math/rand"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// REQ sketch parameters, as in DataSketches Java and C++
+const (
+	REQ_DEFAULT_K int32 = 12
+	REQ_MIN_K     int32 = 4
+	REQ_MAX_K     int32 = 1024
+
+	REQ_INIT_NUMBER_OF_SECTIONS int32 = 3
+	REQ_NOM_CAP_MULT            int32 = 2
+
+	REQ_FAMILY_ID int32 = 17
+	// REQ_MAX_NUM_LEVELS bounds the number of compactors of a valid sketch, as
+	// n cannot exceed 2^63
+	REQ_MAX_NUM_LEVELS int32 = 63
+)
+
+// reqMaxNumSections is the most sections a compactor can have: doubling 48
+// sections takes 2^47 compactions of one compactor, which no sketch reaches.
+const reqMaxNumSections int32 = 48
+
+// reqCompactor is one level of a ReqSketch. All its items have weight
+// 2^lgWeight. The items are split into numSections sections of sectionSize
+// items, plus the half of the nominal capacity that is never compacted. Each
+// compaction compacts the sections at the less accurate end of the sorted
+// items: the lowest items in high rank accuracy mode, otherwise the highest.
+// The number of sections compacted is one more than the number of trailing
+// ones of state, the count of compactions so far, so that sections nearer to
+// the accurate end are compacted exponentially less often.
+type reqCompactor struct {
+	lgWeight       uint8
+	hra            bool
+	coin           bool
+	state          uint64
+	sectionSizeFlt float32
+	sectionSize    int32
+	numSections    uint8
+	items          []float32
+	sorted         bool
+}
+
+func newReqCompactor(lgWeight uint8, hra bool, sectionSize int32) *reqCompactor {
+	c := &reqCompactor{
+		lgWeight:       lgWeight,
+		hra:            hra,
+		sectionSizeFlt: float32(sectionSize),
+		sectionSize:    sectionSize,
+		numSections:    uint8(REQ_INIT_NUMBER_OF_SECTIONS),
+		sorted:         true,
+	}
+	c.items = make([]float32, 0, 2*c.getNomCapacity())
+	return c
+}
+
+func (c *reqCompactor) getNomCapacity() int32 {
+	return REQ_NOM_CAP_MULT * int32(c.numSections) * c.sectionSize
+}
+
+func (c *reqCompactor) append(item float32) {
+	c.items = append(c.items, item)
+	c.sorted = false
+}
+
+func (c *reqCompactor) sort() {
+	if !c.sorted {
+		sortFloats(c.items)
+		c.sorted = true
+	}
+}
+
+// mergeSortIn merges the given sorted items into the sorted items of this
+// compactor.
+func (c *reqCompactor) mergeSortIn(items []float32) {
+	util.Assert(c.sorted, "c.sorted")
+	i := len(c.items) - 1
+	j := len(items) - 1
+	c.items = append(c.items, items...)
+	for dst := len(c.items) - 1; j >= 0; dst-- {
+		if i >= 0 && c.items[i] > items[j] {
+			c.items[dst] = c.items[i]
+			i--
+		} else {
+			c.items[dst] = items[j]
+			j--
+		}
+	}
+}
+
+// compact compacts the sorted items of this compactor. It returns the items
+// promoted to the next level, and the changes of the number of items retained
+// and of the nominal capacity of the sketch.
+func (c *reqCompactor) compact(rnd *rand.Rand) (promoted []float32, deltaRetItems int32, deltaNomSize int32) {
+	util.Assert(c.sorted, "c.sorted")
+	startRetItems := int32(len(c.items))
+	startNomCap := c.getNomCapacity()
+	secsToCompact := util.Intmin(int32(bits.TrailingZeros64(^c.state))+1, int32(c.numSections))
+	start, end := c.computeCompactionRange(secsToCompact)
+	util.Assert(end-start >= 2, "end - start >= 2")
+
+	if c.state&1 == 1 {
+		// every other compaction takes the other half, so that the errors of
+		// consecutive compactions cancel out
+		c.coin = !c.coin
+	} else {
+		c.coin = rnd.Intn(2) == 1
+	}
+	offset := start
+	if c.coin {
+		offset++
+	}
+	promoted = make([]float32, 0, (end-start)/2)
+	for i := offset; i < end; i += 2 {
+		promoted = append(promoted, c.items[i])
+	}
+	if c.hra {
+		c.items = c.items[:copy(c.items, c.items[end:])]
+	} else {
+		c.items = c.items[:start]
+	}
+
+	c.state++
+	c.ensureEnoughSections()
+	deltaRetItems = int32(len(c.items)) - startRetItems + int32(len(promoted))
+	deltaNomSize = c.getNomCapacity() - startNomCap
+	return promoted, deltaRetItems, deltaNomSize
+}
+
+// computeCompactionRange returns the even-sized range of the sorted items to
+// compact.
+func (c *reqCompactor) computeCompactionRange(secsToCompact int32) (int32, int32) {
+	numItems := int32(len(c.items))
+	nonCompact := c.getNomCapacity()/2 + (int32(c.numSections)-secsToCompact)*c.sectionSize
+	if (numItems-nonCompact)&1 == 1 {
+		nonCompact++
+	}
+	if c.hra {
+		return 0, numItems - nonCompact
+	}
+	return nonCompact, numItems
+}
+
+// ensureEnoughSections doubles the number of sections and shrinks them by
+// sqrt(2) once the compactor has done 2^(numSections-1) compactions, as long
+// as the sections stay at least REQ_MIN_K items and there are at most
+// reqMaxNumSections of them. It returns true if it did.
+func (c *reqCompactor) ensureEnoughSections() bool {
+	// the cap keeps the shift below 64 and numSections within a byte
+	if int32(c.numSections)<<1 > reqMaxNumSections {
+		return false
+	}
+	if c.state < 1<<(c.numSections-1) || c.sectionSize <= REQ_MIN_K {
+		return false
+	}
+	sectionSizeFlt := float32(float64(c.sectionSizeFlt) / math.Sqrt2)
+	sectionSize := reqNearestEven(sectionSizeFlt)
+	if sectionSize < REQ_MIN_K {
+		return false
+	}
+	c.sectionSizeFlt = sectionSizeFlt
+	c.sectionSize = sectionSize
+	c.numSections <<= 1
+	return true
+}
+
+// merge merges the items and the compaction state of the other compactor,
+// which must have the same weight, into this one. The other compactor is not
+// modified.
+func (c *reqCompactor) merge(other *reqCompactor) {
+	util.Assert(c.lgWeight == other.lgWeight, "c.lgWeight == other.lgWeight")
+	c.state |= other.state
+	for c.ensureEnoughSections() {
+	}
+	c.sort()
+	otherItems := make([]float32, len(other.items))
+	copy(otherItems, other.items)
+	if !other.sorted {
+		sortFloats(otherItems)
+	}
+	c.mergeSortIn(otherItems)
+}
+
+func (c *reqCompactor) copy() *reqCompactor {
+	compactorCopy := *c
+	compactorCopy.items = make([]float32, len(c.items), cap(c.items))
+	copy(compactorCopy.items, c.items)
+	return &compactorCopy
+}
+
+func reqNearestEven(value float32) int32 {
+	return int32(math.Round(float64(value)/2)) << 1
+}
+
+// checkReqK returns an error unless k is even and between REQ_MIN_K and
+// REQ_MAX_K.
+func checkReqK(k int32) error {
+	if k&1 == 1 || k < REQ_MIN_K || k > REQ_MAX_K {
+		return newSketchesArgumentError("k must be even and >= %v and <= %v (got %v)", REQ_MIN_K, REQ_MAX_K, k)
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package sketches
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// REQ byte addresses and bit masks. The first 6 bytes follow the preamble of
+// the classic quantiles sketches, except that PREAMBLE_LONGS_BYTE holds the
+// number of preamble ints instead of longs.
+const (
+	REQ_NUM_COMPACTORS_BYTE = 6
+	REQ_NUM_RAW_ITEMS_BYTE  = 7
+
+	//After Preamble:
+	REQ_DATA_START            = 8  // raw items, or the only compactor
+	REQ_MIN_FLOAT             = 16 // after n in estimation mode
+	REQ_MAX_FLOAT             = 20
+	REQ_DATA_START_ESTIMATION = 24 // the compactors in estimation mode
+	REQ_COMPACTOR_DATA_START  = 20 // the items of a serialized compactor
+
+	REQ_PREAMBLE_INTS_SHORT int32 = 2 // empty, raw items and exact sketches
+	REQ_PREAMBLE_INTS_FULL  int32 = 4
+	REQ_SER_VER             int32 = 1
+
+	// REQ_MAX_RAW_ITEMS is the largest n that is serialized as raw items.
+	REQ_MAX_RAW_ITEMS = 4
+
+	// flag bit masks
+	REQ_EMPTY_FLAG_MASK             = 4
+	REQ_HRA_FLAG_MASK               = 8
+	REQ_RAW_ITEMS_FLAG_MASK         = 16
+	REQ_LEVEL_ZERO_SORTED_FLAG_MASK = 32
+)
+
+// Serialized compactor byte addresses, relative to the start of the compactor
+const (
+	reqCompactorStateLong    = 0
+	reqCompactorSectionSize  = 8
+	reqCompactorLgWeightByte = 12
+	reqCompactorNumSectsByte = 13
+	reqCompactorNumItemsInt  = 16
+)
+
+func (s *ReqSketch) isRawItems() bool {
+	return s.n <= REQ_MAX_RAW_ITEMS
+}
+
+// GetSerializedSizeBytes returns the number of bytes Serialize will produce.
+func (s *ReqSketch) GetSerializedSizeBytes() int {
+	if s.IsEmpty() {
+		return REQ_DATA_START
+	}
+	if s.isRawItems() {
+		return REQ_DATA_START + int(s.n)*4
+	}
+	size := REQ_DATA_START
+	if s.IsEstimationMode() {
+		size = REQ_DATA_START_ESTIMATION
+	}
+	return size + len(s.compactors)*REQ_COMPACTOR_DATA_START + int(s.numRetained)*4
+}
+
+// Serialize serializes the sketch in a compact, always little-endian layout
+// modeled on the REQ format of DataSketches Java and C++. It is not tested
+// against sketches written by those libraries, so binary compatibility with
+// them is not guaranteed. Up to REQ_MAX_RAW_ITEMS items are
+// serialized as they are; a sketch with a single compactor is serialized
+// without n, min and max, which are implied by its items.
+func (s *ReqSketch) Serialize() ([]byte, error) {
+	out := make([]byte, s.GetSerializedSizeBytes())
+	byteOrder := binary.LittleEndian
+
+	preInts := REQ_PREAMBLE_INTS_SHORT
+	if !s.IsEmpty() && !s.isRawItems() && s.IsEstimationMode() {
+		preInts = REQ_PREAMBLE_INTS_FULL
+	}
+	var flags byte = 0
+	if s.IsEmpty() {
+		flags |= REQ_EMPTY_FLAG_MASK
+	}
+	if s.hra {
+		flags |= REQ_HRA_FLAG_MASK
+	}
+	if s.isRawItems() {
+		flags |= REQ_RAW_ITEMS_FLAG_MASK
+	}
+	if s.compactors[0].sorted {
+		flags |= REQ_LEVEL_ZERO_SORTED_FLAG_MASK
+	}
+
+	out[PREAMBLE_LONGS_BYTE] = byte(preInts)
+	out[SER_VER_BYTE] = byte(REQ_SER_VER)
+	out[FAMILY_BYTE] = byte(REQ_FAMILY_ID)
+	out[FLAGS_BYTE] = flags
+	byteOrder.PutUint16(out[K_SHORT:], uint16(s.k))
+
+	if s.IsEmpty() {
+		return out, nil
+	}
+	out[REQ_NUM_COMPACTORS_BYTE] = byte(len(s.compactors))
+	if s.isRawItems() {
+		out[REQ_NUM_RAW_ITEMS_BYTE] = byte(s.n)
+		if err := util.BinaryPutFloat32Slice(out[REQ_DATA_START:], byteOrder, s.compactors[0].items); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	offset := REQ_DATA_START
+	if s.IsEstimationMode() {
+		byteOrder.PutUint64(out[N_LONG:], uint64(s.n))
+		util.BinaryPutFloat32(out[REQ_MIN_FLOAT:], byteOrder, s.minValue)
+		util.BinaryPutFloat32(out[REQ_MAX_FLOAT:], byteOrder, s.maxValue)
+		offset = REQ_DATA_START_ESTIMATION
+	}
+	for _, c := range s.compactors {
+		n, err := c.serialize(out[offset:])
+		if err != nil {
+			return nil, err
+		}
+		offset += n
+	}
+	return out, nil
+}
+
+// serialize writes the compactor to out, which must be large enough, and
+// returns the number of bytes written.
+func (c *reqCompactor) serialize(out []byte) (int, error) {
+	byteOrder := binary.LittleEndian
+	byteOrder.PutUint64(out[reqCompactorStateLong:], c.state)
+	util.BinaryPutFloat32(out[reqCompactorSectionSize:], byteOrder, c.sectionSizeFlt)
+	out[reqCompactorLgWeightByte] = c.lgWeight
+	out[reqCompactorNumSectsByte] = c.numSections
+	byteOrder.PutUint32(out[reqCompactorNumItemsInt:], uint32(len(c.items)))
+	if err := util.BinaryPutFloat32Slice(out[REQ_COMPACTOR_DATA_START:], byteOrder, c.items); err != nil {
+		return 0, err
+	}
+	return REQ_COMPACTOR_DATA_START + len(c.items)*4, nil
+}
+
+// HeapifyReqSketch returns a new sketch from bytes written by Serialize.
+func HeapifyReqSketch(srcBytes []byte) (*ReqSketch, error) {
+	if len(srcBytes) < REQ_DATA_START {
+		return nil, newCorruptSketchError("source length < %v: %v", REQ_DATA_START, len(srcBytes))
+	}
+	byteOrder := binary.LittleEndian
+	preInts := int32(srcBytes[PREAMBLE_LONGS_BYTE])
+	serVer := int32(srcBytes[SER_VER_BYTE])
+	familyID := int32(srcBytes[FAMILY_BYTE])
+	flags := srcBytes[FLAGS_BYTE]
+	k := int32(byteOrder.Uint16(srcBytes[K_SHORT:]))
+	numCompactors := int32(srcBytes[REQ_NUM_COMPACTORS_BYTE])
+	numRawItems := int32(srcBytes[REQ_NUM_RAW_ITEMS_BYTE])
+
+	if familyID != REQ_FAMILY_ID {
+		return nil, fmt.Errorf("%w: expected %v, got %v", ErrFamilyMismatch, REQ_FAMILY_ID, familyID)
+	}
+	if serVer != REQ_SER_VER {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedSerVer, serVer)
+	}
+	if err := checkReqK(k); err != nil {
+		return nil, newCorruptSketchError("%v", err)
+	}
+	knownFlags := byte(REQ_EMPTY_FLAG_MASK | REQ_HRA_FLAG_MASK | REQ_RAW_ITEMS_FLAG_MASK | REQ_LEVEL_ZERO_SORTED_FLAG_MASK)
+	if flags&^knownFlags != 0 {
+		return nil, newCorruptSketchError("unknown flags: %b", flags)
+	}
+	if numCompactors > REQ_MAX_NUM_LEVELS {
+		return nil, newCorruptSketchError("number of compactors must be <= %v (got %v)", REQ_MAX_NUM_LEVELS, numCompactors)
+	}
+	empty := flags&REQ_EMPTY_FLAG_MASK > 0
+	hra := flags&REQ_HRA_FLAG_MASK > 0
+	rawItems := flags&REQ_RAW_ITEMS_FLAG_MASK > 0
+	levelZeroSorted := flags&REQ_LEVEL_ZERO_SORTED_FLAG_MASK > 0
+	estimation := numCompactors > 1
+	expectedPreInts := REQ_PREAMBLE_INTS_SHORT
+	if estimation {
+		expectedPreInts = REQ_PREAMBLE_INTS_FULL
+	}
+	if preInts != expectedPreInts {
+		return nil, newCorruptSketchError("preamble ints %v do not match %v compactors", preInts, numCompactors)
+	}
+
+	sketch := newReqSketch(k, hra)
+	switch {
+	case estimation:
+		if empty || rawItems {
+			return nil, newCorruptSketchError("flags %b do not match %v compactors", flags, numCompactors)
+		}
+		return heapifyReqCompactors(sketch, srcBytes, numCompactors, levelZeroSorted)
+	case empty:
+		if numRawItems != 0 {
+			return nil, newCorruptSketchError("an empty sketch must have no raw items (got %v)", numRawItems)
+		}
+		return sketch, nil
+	case rawItems:
+		if numRawItems < 1 || numRawItems > REQ_MAX_RAW_ITEMS {
+			return nil, newCorruptSketchError("number of raw items must be >= 1 and <= %v (got %v)", REQ_MAX_RAW_ITEMS, numRawItems)
+		}
+		if requiredBytes := REQ_DATA_START + int(numRawItems)*4; len(srcBytes) < requiredBytes {
+			return nil, newCorruptSketchError("source length < %v: %v", requiredBytes, len(srcBytes))
+		}
+		items := make([]float32, numRawItems)
+		util.BinaryGetFloat32Slice(items, srcBytes[REQ_DATA_START:], byteOrder)
+		for _, item := range items {
+			if err := sketch.Update(item); err != nil {
+				return nil, err
+			}
+		}
+		if sketch.GetN() != int64(numRawItems) {
+			return nil, newCorruptSketchError("raw items must not be NaN")
+		}
+		sketch.compactors[0].sorted = levelZeroSorted
+		if err := sketch.checkItems(); err != nil {
+			return nil, err
+		}
+		return sketch, nil
+	default:
+		if numCompactors != 1 {
+			return nil, newCorruptSketchError("a sketch that is not empty must have compactors")
+		}
+		return heapifyReqCompactors(sketch, srcBytes, numCompactors, levelZeroSorted)
+	}
+}
+
+// heapifyReqCompactors reads the compactors of a sketch in exact or
+// estimation mode into the given empty sketch.
+func heapifyReqCompactors(sketch *ReqSketch, srcBytes []byte, numCompactors int32, levelZeroSorted bool) (*ReqSketch, error) {
+	byteOrder := binary.LittleEndian
+	estimation := numCompactors > 1
+	offset := REQ_DATA_START
+	if estimation {
+		if len(srcBytes) < REQ_DATA_START_ESTIMATION {
+			return nil, newCorruptSketchError("source length < %v: %v", REQ_DATA_START_ESTIMATION, len(srcBytes))
+		}
+		sketch.n = int64(byteOrder.Uint64(srcBytes[N_LONG:]))
+		if sketch.n <= REQ_MAX_RAW_ITEMS {
+			return nil, newCorruptSketchError("a sketch in estimation mode must have n > %v: %v", REQ_MAX_RAW_ITEMS, sketch.n)
+		}
+		sketch.minValue = util.BinaryGetFloat32(srcBytes[REQ_MIN_FLOAT:], byteOrder)
+		sketch.maxValue = util.BinaryGetFloat32(srcBytes[REQ_MAX_FLOAT:], byteOrder)
+		offset = REQ_DATA_START_ESTIMATION
+	}
+
+	sketch.compactors = make([]*reqCompactor, numCompactors)
+	for h := range sketch.compactors {
+		c, n, err := heapifyReqCompactor(srcBytes[offset:], sketch.hra)
+		if err != nil {
+			return nil, fmt.Errorf("%w at compactor %v", err, h)
+		}
+		if int(c.lgWeight) != h {
+			return nil, newCorruptSketchError("compactor %v has lg weight %v", h, c.lgWeight)
+		}
+		c.sorted = h > 0 || levelZeroSorted
+		sketch.compactors[h] = c
+		offset += n
+	}
+	sketch.numRetained = sketch.computeNumRetained()
+	sketch.maxNomSize = sketch.computeMaxNomSize()
+
+	if !estimation {
+		items := sketch.compactors[0].items
+		if len(items) <= REQ_MAX_RAW_ITEMS {
+			return nil, newCorruptSketchError("a sketch with %v items must be serialized as raw items", len(items))
+		}
+		sketch.n = int64(len(items))
+		sketch.minValue = items[0]
+		sketch.maxValue = items[0]
+		for _, item := range items {
+			if item < sketch.minValue {
+				sketch.minValue = item
+			}
+			if item > sketch.maxValue {
+				sketch.maxValue = item
+			}
+		}
+	}
+	if err := sketch.checkItems(); err != nil {
+		return nil, err
+	}
+	if sketch.numRetained >= sketch.maxNomSize {
+		return nil, newCorruptSketchError("%v retained items exceed the capacity %v", sketch.numRetained, sketch.maxNomSize)
+	}
+	return sketch, nil
+}
+
+// heapifyReqCompactor reads a compactor from the start of srcBytes and returns
+// it with the number of bytes read.
+func heapifyReqCompactor(srcBytes []byte, hra bool) (*reqCompactor, int, error) {
+	if len(srcBytes) < REQ_COMPACTOR_DATA_START {
+		return nil, 0, newCorruptSketchError("source length < %v: %v", REQ_COMPACTOR_DATA_START, len(srcBytes))
+	}
+	byteOrder := binary.LittleEndian
+	state := byteOrder.Uint64(srcBytes[reqCompactorStateLong:])
+	sectionSizeFlt := util.BinaryGetFloat32(srcBytes[reqCompactorSectionSize:], byteOrder)
+	lgWeight := srcBytes[reqCompactorLgWeightByte]
+	numSections := srcBytes[reqCompactorNumSectsByte]
+	numItems := int64(byteOrder.Uint32(srcBytes[reqCompactorNumItemsInt:]))
+
+	if !(sectionSizeFlt >= float32(REQ_MIN_K) && sectionSizeFlt <= float32(REQ_MAX_K)) {
+		return nil, 0, newCorruptSketchError("section size must be >= %v and <= %v (got %v)", REQ_MIN_K, REQ_MAX_K, sectionSizeFlt)
+	}
+	sectionSize := reqNearestEven(sectionSizeFlt)
+	multiple := numSections / byte(REQ_INIT_NUMBER_OF_SECTIONS)
+	if int32(numSections) > reqMaxNumSections || numSections%byte(REQ_INIT_NUMBER_OF_SECTIONS) != 0 || bits.OnesCount8(multiple) != 1 {
+		return nil, 0, newCorruptSketchError("number of sections must be 3 times a power of 2 and <= %v (got %v)", reqMaxNumSections, numSections)
+	}
+	if sectionSize < REQ_MIN_K {
+		return nil, 0, newCorruptSketchError("section size must be >= %v (got %v)", REQ_MIN_K, sectionSize)
+	}
+	if requiredBytes := int64(REQ_COMPACTOR_DATA_START) + numItems*4; int64(len(srcBytes)) < requiredBytes {
+		return nil, 0, newCorruptSketchError("source length < %v: %v", requiredBytes, len(srcBytes))
+	}
+
+	c := &reqCompactor{
+		lgWeight:       lgWeight,
+		hra:            hra,
+		state:          state,
+		sectionSizeFlt: sectionSizeFlt,
+		sectionSize:    sectionSize,
+		numSections:    numSections,
+	}
+	// compactions are lazy, so a compactor may hold more items than its
+	// nominal capacity as long as the sketch does not
+	c.items = make([]float32, numItems)
+	util.BinaryGetFloat32Slice(c.items, srcBytes[REQ_COMPACTOR_DATA_START:], byteOrder)
+	return c, REQ_COMPACTOR_DATA_START + int(numItems)*4, nil
+}
+
+// checkItems checks that min <= max, that all items are within [min, max],
+// that all compactors that must be sorted are, and that the total weight of
+// the items is n.
+func (s *ReqSketch) checkItems() error {
+	if !(s.minValue <= s.maxValue) {
+		return newCorruptSketchError("min must be <= max (got %v and %v)", s.minValue, s.maxValue)
+	}
+	var weight uint64 = 0
+	for h, c := range s.compactors {
+		for i, item := range c.items {
+			if !(item >= s.minValue && item <= s.maxValue) {
+				return newCorruptSketchError("item %v is not within [%v, %v] at compactor %v", item, s.minValue, s.maxValue, h)
+			}
+			if c.sorted && i > 0 && item < c.items[i-1] {
+				return newCorruptSketchError("items are not sorted at compactor %v", h)
+			}
+		}
+		hi, lo := bits.Mul64(uint64(len(c.items)), uint64(1)<<c.lgWeight)
+		sum, carry := bits.Add64(weight, lo, 0)
+		if hi != 0 || carry != 0 {
+			return newCorruptSketchError("the total weight of the compactors overflows")
+		}
+		weight = sum
+	}
+	if weight != uint64(s.n) {
+		return newCorruptSketchError("the total weight of the compactors %v does not match n %v", weight, s.n)
+	}
+	return nil
+}
@@ -0,0 +1,422 @@
+package sketches
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// Factors of the relative and the fixed part of the rank error of a REQ
+// sketch, as in DataSketches Java
+var (
+	reqRelRseFactor = math.Sqrt(0.0512 / float64(REQ_INIT_NUMBER_OF_SECTIONS))
+	reqFixRseFactor = 0.084
+)
+
+// ReqSketch is a relative error quantiles (REQ) sketch of float32 items. Unlike
+// the additive error of DoublesSketch and KllFloatsSketch, its rank error is
+// proportional to the distance of the rank from one end of the distribution:
+// in high rank accuracy (HRA) mode the error of rank r is proportional to
+// 1-r, which makes it suited to tail quantiles like p99.9 and p99.99, while
+// in low rank accuracy (LRA) mode it is proportional to r.
+//
+// The sketch is a stack of compactors, where compactor h holds items of weight
+// 2^h. A compactor that reaches its nominal capacity promotes every other item
+// of its least accurate sections to the compactor above it.
+type ReqSketch struct {
+	k           int32
+	hra         bool
+	n           int64
+	minValue    float32
+	maxValue    float32
+	numRetained int32
+	maxNomSize  int32
+	compactors  []*reqCompactor
+
+	sortedView *FloatsSketchSortedView
+	rand       *rand.Rand
+}
+
+// NewReqSketch returns an empty REQ sketch. k must be even and between
+// REQ_MIN_K and REQ_MAX_K; REQ_DEFAULT_K is a good default. hra selects high
+// rank accuracy mode, which DataSketches uses by default.
+func NewReqSketch(k int, hra bool) (*ReqSketch, error) {
+	if err := checkReqK(int32(k)); err != nil {
+		return nil, err
+	}
+	return newReqSketch(int32(k), hra), nil
+}
+
+func newReqSketch(k int32, hra bool) *ReqSketch {
+	s := &ReqSketch{
+		k:        k,
+		hra:      hra,
+		minValue: float32(math.NaN()),
+		maxValue: float32(math.NaN()),
+	}
+	s.grow()
+	return s
+}
+
+func (s *ReqSketch) GetK() int32 {
+	return s.k
+}
+
+// IsHighRankAccuracy returns true if the sketch is in high rank accuracy mode.
+func (s *ReqSketch) IsHighRankAccuracy() bool {
+	return s.hra
+}
+
+func (s *ReqSketch) GetN() int64 {
+	return s.n
+}
+
+func (s *ReqSketch) IsEmpty() bool {
+	return s.n == 0
+}
+
+// IsEstimationMode returns true if the sketch has compacted items, and is
+// therefore no longer exact.
+func (s *ReqSketch) IsEstimationMode() bool {
+	return len(s.compactors) > 1
+}
+
+// GetNumRetained returns the number of items retained by the sketch.
+func (s *ReqSketch) GetNumRetained() int32 {
+	return s.numRetained
+}
+
+// GetMinValue returns the smallest item seen, or NaN if the sketch is empty.
+func (s *ReqSketch) GetMinValue() float32 {
+	return s.minValue
+}
+
+// GetMaxValue returns the largest item seen, or NaN if the sketch is empty.
+func (s *ReqSketch) GetMaxValue() float32 {
+	return s.maxValue
+}
+
+func (s *ReqSketch) getNumLevels() int {
+	return len(s.compactors)
+}
+
+func (s *ReqSketch) getRandom() *rand.Rand {
+	if s.rand == nil {
+		s.rand = rand.New(util.NewSplitMix64Source(rand.Int63()))
+	}
+	return s.rand
+}
+
+// Reset returns the sketch to its empty state, keeping k and the mode.
+func (s *ReqSketch) Reset() {
+	rnd := s.rand
+	*s = *newReqSketch(s.k, s.hra)
+	s.rand = rnd
+}
+
+// grow adds an empty compactor on top of the others.
+func (s *ReqSketch) grow() {
+	lgWeight := uint8(len(s.compactors))
+	s.compactors = append(s.compactors, newReqCompactor(lgWeight, s.hra, s.k))
+	s.maxNomSize = s.computeMaxNomSize()
+}
+
+func (s *ReqSketch) computeMaxNomSize() int32 {
+	var maxNomSize int32 = 0
+	for _, c := range s.compactors {
+		maxNomSize += c.getNomCapacity()
+	}
+	return maxNomSize
+}
+
+func (s *ReqSketch) computeNumRetained() int32 {
+	var numRetained int32 = 0
+	for _, c := range s.compactors {
+		numRetained += int32(len(c.items))
+	}
+	return numRetained
+}
+
+// UPDATES
+
+// Update updates the sketch with the given item. NaNs are ignored.
+func (s *ReqSketch) Update(dataItem float32) error {
+	if math.IsNaN(float64(dataItem)) {
+		return nil
+	}
+	if s.IsEmpty() {
+		s.minValue = dataItem
+		s.maxValue = dataItem
+	} else {
+		if dataItem < s.minValue {
+			s.minValue = dataItem
+		}
+		if dataItem > s.maxValue {
+			s.maxValue = dataItem
+		}
+	}
+	c := s.compactors[0]
+	c.append(dataItem)
+	s.numRetained++
+	s.n++
+	if s.numRetained >= s.maxNomSize {
+		c.sort()
+		s.compress()
+	}
+	s.sortedView = nil
+	return nil
+}
+
+// compress compacts every compactor that is at its nominal capacity into the
+// one above it, adding a compactor on top if needed.
+func (s *ReqSketch) compress() {
+	for h := 0; h < len(s.compactors); h++ {
+		c := s.compactors[h]
+		if int32(len(c.items)) < c.getNomCapacity() {
+			continue
+		}
+		if h+1 >= len(s.compactors) {
+			s.grow()
+		}
+		promoted, deltaRetItems, deltaNomSize := c.compact(s.getRandom())
+		s.compactors[h+1].mergeSortIn(promoted)
+		s.numRetained += deltaRetItems
+		s.maxNomSize += deltaNomSize
+	}
+	s.sortedView = nil
+}
+
+// Merge merges the other sketch, which must be in the same rank accuracy
+// mode, into this one. The other sketch is not modified. The k of this sketch
+// is kept.
+func (s *ReqSketch) Merge(other *ReqSketch) error {
+	if other.hra != s.hra {
+		return newSketchesArgumentError("both sketches must have the same rank accuracy mode")
+	}
+	if other.IsEmpty() {
+		return nil
+	}
+	if other == s {
+		other = s.copy()
+	}
+
+	if s.IsEmpty() || other.minValue < s.minValue {
+		s.minValue = other.minValue
+	}
+	if s.IsEmpty() || other.maxValue > s.maxValue {
+		s.maxValue = other.maxValue
+	}
+	s.n += other.n
+	for len(s.compactors) < len(other.compactors) {
+		s.grow()
+	}
+	for h, c := range other.compactors {
+		s.compactors[h].merge(c)
+	}
+	s.maxNomSize = s.computeMaxNomSize()
+	s.numRetained = s.computeNumRetained()
+	if s.numRetained >= s.maxNomSize {
+		s.compress()
+	}
+	util.Assert(s.numRetained < s.maxNomSize, "s.numRetained < s.maxNomSize")
+	s.sortedView = nil
+	return nil
+}
+
+func (s *ReqSketch) copy() *ReqSketch {
+	sketchCopy := *s
+	sketchCopy.compactors = make([]*reqCompactor, len(s.compactors))
+	for h, c := range s.compactors {
+		sketchCopy.compactors[h] = c.copy()
+	}
+	sketchCopy.sortedView = nil
+	sketchCopy.rand = nil
+	return &sketchCopy
+}
+
+// QUERIES
+
+// GetSortedView returns the sorted view of this sketch. The view is built on
+// first use and cached until the sketch is next updated, so it must not be
+// called concurrently with updates.
+func (s *ReqSketch) GetSortedView() *FloatsSketchSortedView {
+	if s.sortedView == nil {
+		s.sortedView = s.newSortedView()
+	}
+	return s.sortedView
+}
+
+func (s *ReqSketch) newSortedView() *FloatsSketchSortedView {
+	numRetained := s.numRetained
+	items := make([]float32, numRetained)
+	weights := make([]int64, numRetained)
+
+	runs := make([]int32, 0, len(s.compactors)+1)
+	var offset int32 = 0
+	for _, c := range s.compactors {
+		start := offset
+		offset += int32(copy(items[start:], c.items))
+		if !c.sorted {
+			sortFloats(items[start:offset])
+		}
+		weight := int64(1) << c.lgWeight
+		for i := start; i < offset; i++ {
+			weights[i] = weight
+		}
+		if start < offset {
+			runs = append(runs, start)
+		}
+	}
+	util.Assert(offset == numRetained, "offset == numRetained")
+	runs = append(runs, numRetained)
+	tandemMergeSortRuns(items, weights, runs)
+
+	var cumWeight int64 = 0
+	for i := range weights {
+		cumWeight += weights[i]
+		weights[i] = cumWeight
+	}
+	util.Assert(cumWeight == s.n, "cumWeight == n")
+
+	return &FloatsSketchSortedView{
+		n:          s.n,
+		items:      items,
+		cumWeights: weights,
+	}
+}
+
+// GetQuantile returns the approximate quantile of the given normalized rank,
+// which must be in the range [0, 1]. An empty sketch returns NaN.
+func (s *ReqSketch) GetQuantile(rank float64, searchCrit QuantileSearchCriteria) (float32, error) {
+	if err := checkNormalizedRankBounds(rank); err != nil {
+		return float32(math.NaN()), err
+	}
+	if s.IsEmpty() {
+		return float32(math.NaN()), nil
+	}
+	return s.GetSortedView().getQuantile(rank, searchCrit), nil
+}
+
+// GetQuantiles returns the approximate quantiles of the given normalized
+// ranks. An empty sketch returns nil.
+func (s *ReqSketch) GetQuantiles(ranks []float64, searchCrit QuantileSearchCriteria) ([]float32, error) {
+	for _, rank := range ranks {
+		if err := checkNormalizedRankBounds(rank); err != nil {
+			return nil, err
+		}
+	}
+	if s.IsEmpty() {
+		return nil, nil
+	}
+	sortedView := s.GetSortedView()
+	quantiles := make([]float32, len(ranks))
+	for i, rank := range ranks {
+		quantiles[i] = sortedView.getQuantile(rank, searchCrit)
+	}
+	return quantiles, nil
+}
+
+// GetRank returns the approximate normalized rank of the given value. An
+// empty sketch returns NaN.
+func (s *ReqSketch) GetRank(value float32, searchCrit QuantileSearchCriteria) (float64, error) {
+	return s.GetSortedView().GetRank(value, searchCrit)
+}
+
+// GetCDF returns the approximate cumulative distribution function over the
+// intervals defined by splitPoints, which must be unique, monotonically
+// increasing and not NaN. An empty sketch returns nil.
+func (s *ReqSketch) GetCDF(splitPoints []float32, searchCrit QuantileSearchCriteria) ([]float64, error) {
+	return s.GetSortedView().GetCDF(splitPoints, searchCrit)
+}
+
+// GetPMF returns the approximate probability mass function over the
+// len(splitPoints)+1 intervals defined by splitPoints. An empty sketch
+// returns nil.
+func (s *ReqSketch) GetPMF(splitPoints []float32, searchCrit QuantileSearchCriteria) ([]float64, error) {
+	return s.GetSortedView().GetPMF(splitPoints, searchCrit)
+}
+
+// RANK ERROR
+
+// GetRankLowerBound returns a lower bound of the true rank of an item whose
+// estimated rank is the given normalized rank, at the confidence of the
+// given number of standard deviations: 1, 2 and 3 give about 68%, 95% and
+// 99.7%. It returns rank itself where the sketch is exact, and is never less
+// than 0.
+func (s *ReqSketch) GetRankLowerBound(rank float64, numStdDev int) float64 {
+	return math.Max(0, reqGetRankLB(s.k, s.getNumLevels(), rank, numStdDev, s.hra, s.n))
+}
+
+// GetRankUpperBound returns an upper bound of the true rank of an item whose
+// estimated rank is the given normalized rank. See GetRankLowerBound. It is
+// never more than 1.
+func (s *ReqSketch) GetRankUpperBound(rank float64, numStdDev int) float64 {
+	return math.Min(1, reqGetRankUB(s.k, s.getNumLevels(), rank, numStdDev, s.hra, s.n))
+}
+
+// GetQuantileLowerBound returns the quantile of the lower bound of the given
+// normalized rank. An empty sketch returns NaN.
+func (s *ReqSketch) GetQuantileLowerBound(rank float64, numStdDev int) (float32, error) {
+	if err := checkNormalizedRankBounds(rank); err != nil {
+		return float32(math.NaN()), err
+	}
+	return s.GetQuantile(s.GetRankLowerBound(rank, numStdDev), INCLUSIVE)
+}
+
+// GetQuantileUpperBound returns the quantile of the upper bound of the given
+// normalized rank. An empty sketch returns NaN.
+func (s *ReqSketch) GetQuantileUpperBound(rank float64, numStdDev int) (float32, error) {
+	if err := checkNormalizedRankBounds(rank); err != nil {
+		return float32(math.NaN()), err
+	}
+	return s.GetQuantile(s.GetRankUpperBound(rank, numStdDev), INCLUSIVE)
+}
+
+// GetReqRSE returns the approximate relative standard error of the given
+// normalized rank for a REQ sketch with the given k, mode and n, i.e. the
+// one standard deviation rank error as a fraction of n.
+func GetReqRSE(k int32, rank float64, hra bool, n int64) float64 {
+	// assuming more than one level is more conservative
+	return reqGetRankUB(k, 2, rank, 1, hra, n) - rank
+}
+
+func reqGetRankLB(k int32, numLevels int, rank float64, numStdDev int, hra bool, n int64) float64 {
+	if reqIsExactRank(k, numLevels, rank, hra, n) {
+		return rank
+	}
+	relative, fixed := reqRankErrors(k, rank, hra)
+	return math.Max(rank-float64(numStdDev)*relative, rank-float64(numStdDev)*fixed)
+}
+
+func reqGetRankUB(k int32, numLevels int, rank float64, numStdDev int, hra bool, n int64) float64 {
+	if reqIsExactRank(k, numLevels, rank, hra, n) {
+		return rank
+	}
+	relative, fixed := reqRankErrors(k, rank, hra)
+	return math.Min(rank+float64(numStdDev)*relative, rank+float64(numStdDev)*fixed)
+}
+
+// reqRankErrors returns the relative and the fixed standard error of the
+// given rank. The smaller one applies.
+func reqRankErrors(k int32, rank float64, hra bool) (float64, float64) {
+	distance := rank
+	if hra {
+		distance = 1 - rank
+	}
+	return reqRelRseFactor / float64(k) * distance, reqFixRseFactor / float64(k)
+}
+
+// reqIsExactRank returns true if the given rank is within the items that no
+// compactor has compacted yet.
+func reqIsExactRank(k int32, numLevels int, rank float64, hra bool, n int64) bool {
+	baseCap := int64(k * REQ_INIT_NUMBER_OF_SECTIONS)
+	if numLevels == 1 || n <= baseCap {
+		return true
+	}
+	exactRankThresh := float64(baseCap) / float64(n)
+	if hra {
+		return rank >= 1-exactRankThresh
+	}
+	return rank <= exactRankThresh
+}
@@ -0,0 +1,329 @@
+package sketches
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func newReqSketchWithItems(k int, hra bool, items []int) *ReqSketch {
+	sketch, err := NewReqSketch(k, hra)
+	Expect(err).ToNot(HaveOccurred())
+	for _, item := range items {
+		Expect(sketch.Update(float32(item))).To(Succeed())
+	}
+	return sketch
+}
+
+func newReqSketchWithRange(k int, hra bool, from, to int) *ReqSketch {
+	items := make([]int, 0, to-from)
+	for i := from; i < to; i++ {
+		items = append(items, i)
+	}
+	return newReqSketchWithItems(k, hra, items)
+}
+
+// expectReqRanksWithin checks that the estimated ranks of the items 0 to n-1
+// at the given ranks are within the 3 standard deviation bounds.
+func expectReqRanksWithin(sketch *ReqSketch, n int, ranks []float64) {
+	Expect(sketch.GetN()).To(Equal(int64(n)))
+	Expect(sketch.GetMinValue()).To(Equal(float32(0)))
+	Expect(sketch.GetMaxValue()).To(Equal(float32(n - 1)))
+	for _, rank := range ranks {
+		estimatedRank, err := sketch.GetRank(float32(int(rank*float64(n))), EXCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(estimatedRank).To(BeNumerically(">=", sketch.GetRankLowerBound(rank, 3)), "rank %v", rank)
+		Expect(estimatedRank).To(BeNumerically("<=", sketch.GetRankUpperBound(rank, 3)), "rank %v", rank)
+	}
+}
+
+var _ = Describe("ReqSketch", func() {
+	It("Rejects an invalid k", func() {
+		for _, k := range []int{2, 13, 2048} {
+			_, err := NewReqSketch(k, true)
+			Expect(err).To(BeAssignableToTypeOf(&SketchesArgumentError{}), "k %v", k)
+		}
+	})
+
+	It("Handles an empty sketch", func() {
+		sketch := newReqSketchWithRange(int(REQ_DEFAULT_K), true, 0, 0)
+		Expect(sketch.IsEmpty()).To(BeTrue())
+		quantile, err := sketch.GetQuantile(0.5, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(math.IsNaN(float64(quantile))).To(BeTrue())
+		Expect(math.IsNaN(float64(sketch.GetMinValue()))).To(BeTrue())
+		Expect(sketch.Update(float32(math.NaN()))).To(Succeed())
+		Expect(sketch.IsEmpty()).To(BeTrue())
+		_, err = sketch.GetQuantile(1.5, INCLUSIVE)
+		Expect(err).To(HaveOccurred())
+	})
+
+	for _, hra := range []bool{true, false} {
+		hra := hra
+
+		It("Compacts the least accurate section once the first compactor is full", func() {
+			k := int(REQ_DEFAULT_K)
+			nomCap := 2 * int(REQ_INIT_NUMBER_OF_SECTIONS) * k
+			sketch := newReqSketchWithRange(k, hra, 0, nomCap-1)
+			Expect(sketch.IsEstimationMode()).To(BeFalse())
+			for i := 0; i < nomCap-1; i++ {
+				rank, err := sketch.GetRank(float32(i), EXCLUSIVE)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rank).To(Equal(float64(i) / float64(nomCap-1)))
+			}
+
+			// the first compaction compacts one section of k items, at the low
+			// end in high rank accuracy mode and at the high end otherwise
+			Expect(sketch.Update(float32(nomCap - 1))).To(Succeed())
+			Expect(sketch.IsEstimationMode()).To(BeTrue())
+			Expect(sketch.GetNumRetained()).To(Equal(int32(nomCap - k/2)))
+			Expect(sketch.compactors[0].state).To(Equal(uint64(1)))
+			kept := sketch.compactors[0].items
+			promoted := sketch.compactors[1].items
+			Expect(promoted).To(HaveLen(k / 2))
+			exactFrom, exactTo := k, nomCap
+			if hra {
+				Expect(kept[0]).To(Equal(float32(k)))
+				Expect(promoted[k/2-1]).To(BeNumerically("<", k))
+			} else {
+				Expect(kept[len(kept)-1]).To(Equal(float32(nomCap - k - 1)))
+				Expect(promoted[0]).To(BeNumerically(">=", nomCap-k))
+				exactFrom, exactTo = 0, nomCap-k+1
+			}
+			Expect(kept).To(HaveLen(nomCap - k))
+			// ranks stay exact at the accurate end
+			for i := exactFrom; i < exactTo; i++ {
+				rank, err := sketch.GetRank(float32(i), EXCLUSIVE)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rank).To(Equal(float64(i)/float64(nomCap)), "item %v", i)
+			}
+		})
+	}
+
+	It("Doubles the sections of a compactor after 2^(numSections-1) compactions", func() {
+		sketch, err := NewReqSketch(int(REQ_DEFAULT_K), true)
+		Expect(err).ToNot(HaveOccurred())
+		c := sketch.compactors[0]
+		update := func(untilState uint64) {
+			for i := 0; c.state < untilState; i++ {
+				Expect(sketch.Update(float32(i))).To(Succeed())
+			}
+		}
+
+		update(3)
+		Expect(c.numSections).To(Equal(uint8(3)))
+		update(4)
+		Expect(c.numSections).To(Equal(uint8(6)))
+		Expect(c.sectionSize).To(Equal(int32(8)))
+		Expect(c.getNomCapacity()).To(Equal(int32(96)))
+		update(32)
+		Expect(c.numSections).To(Equal(uint8(12)))
+		Expect(c.sectionSize).To(Equal(int32(6)))
+		Expect(sketch.maxNomSize).To(Equal(sketch.computeMaxNomSize()))
+		Expect(sketch.GetNumRetained()).To(Equal(sketch.computeNumRetained()))
+	})
+
+	It("Is accurate at the high ranks in high rank accuracy mode", func() {
+		n := 1000000
+		sketch := newReqSketchWithItems(int(REQ_DEFAULT_K), true, rand.New(rand.NewSource(1)).Perm(n))
+		Expect(sketch.IsEstimationMode()).To(BeTrue())
+		Expect(sketch.GetNumRetained()).To(BeNumerically("<", n/100))
+		expectReqRanksWithin(sketch, n, []float64{0.01, 0.5, 0.99, 0.999, 0.9999})
+		// the error shrinks towards the accurate end
+		Expect(GetReqRSE(REQ_DEFAULT_K, 0.9999, true, int64(n))).To(BeNumerically("<", GetReqRSE(REQ_DEFAULT_K, 0.5, true, int64(n))/1000))
+		Expect(sketch.GetRankUpperBound(0.9999, 3) - 0.9999).To(BeNumerically("<", 1e-5))
+		quantile, err := sketch.GetQuantile(0.9999, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(float64(quantile) / float64(n)).To(BeNumerically("~", 0.9999, 1e-5))
+	})
+
+	It("Is accurate at the low ranks in low rank accuracy mode", func() {
+		n := 1000000
+		sketch := newReqSketchWithItems(int(REQ_DEFAULT_K), false, rand.New(rand.NewSource(2)).Perm(n))
+		expectReqRanksWithin(sketch, n, []float64{0.0001, 0.001, 0.01, 0.5, 0.99})
+		Expect(sketch.GetRankLowerBound(0.0001, 3)).To(BeNumerically(">", 0.0001-1e-5))
+		quantile, err := sketch.GetQuantile(0.0001, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(float64(quantile) / float64(n)).To(BeNumerically("~", 0.0001, 1e-5))
+	})
+
+	It("Merges sketches", func() {
+		sketch1 := newReqSketchWithRange(int(REQ_DEFAULT_K), true, 0, 50000)
+		sketch2 := newReqSketchWithRange(24, true, 50000, 100000)
+		Expect(sketch1.Merge(sketch2)).To(Succeed())
+		Expect(sketch2.GetN()).To(Equal(int64(50000)))
+		expectReqRanksWithin(sketch1, 100000, []float64{0.01, 0.5, 0.99, 0.999})
+
+		Expect(sketch1.Merge(newReqSketchWithRange(int(REQ_DEFAULT_K), false, 0, 10))).ToNot(Succeed())
+		Expect(sketch1.Merge(newReqSketchWithRange(int(REQ_DEFAULT_K), true, 0, 0))).To(Succeed())
+		Expect(sketch1.GetN()).To(Equal(int64(100000)))
+
+		Expect(sketch1.Merge(sketch1)).To(Succeed())
+		Expect(sketch1.GetN()).To(Equal(int64(200000)))
+		quantile, err := sketch1.GetQuantile(0.5, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(float64(quantile) / 100000).To(BeNumerically("~", 0.5, 0.01))
+
+		sketch1.Reset()
+		Expect(sketch1.IsEmpty()).To(BeTrue())
+		Expect(sketch1.GetNumRetained()).To(Equal(int32(0)))
+	})
+
+	for _, n := range []int{0, 3, 4, 5, 100, 100000} {
+		for _, hra := range []bool{true, false} {
+			n, hra := n, hra
+
+			It("Round-trips through serialization", func() {
+				sketch := newReqSketchWithRange(int(REQ_DEFAULT_K), hra, 0, n)
+				serializedBytes, err := sketch.Serialize()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serializedBytes).To(HaveLen(sketch.GetSerializedSizeBytes()))
+
+				heapified, err := HeapifyReqSketch(serializedBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(heapified.GetN()).To(Equal(int64(n)))
+				Expect(heapified.IsHighRankAccuracy()).To(Equal(hra))
+				Expect(heapified.GetNumRetained()).To(Equal(sketch.GetNumRetained()))
+				reserializedBytes, err := heapified.Serialize()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(reserializedBytes).To(Equal(serializedBytes))
+				if n > 0 {
+					expected, err := sketch.GetQuantile(0.5, INCLUSIVE)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(heapified.GetQuantile(0.5, INCLUSIVE)).To(Equal(expected))
+				}
+			})
+		}
+	}
+
+	It("Serializes exact mode sketches", func() {
+		empty, err := newReqSketchWithRange(int(REQ_DEFAULT_K), true, 0, 0).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(empty).To(Equal([]byte{2, 1, 17, 60, 12, 0, 0, 0}))
+
+		raw, err := newReqSketchWithRange(int(REQ_DEFAULT_K), true, 1, 3).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		expected := []byte{2, 1, 17, 24, 12, 0, 1, 2}
+		expected = append(expected, float32Bytes(1)...)
+		expected = append(expected, float32Bytes(2)...)
+		Expect(raw).To(Equal(expected))
+
+		exact, err := newReqSketchWithItems(int(REQ_DEFAULT_K), false, []int{5, 4, 3, 2, 1}).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		expected = []byte{2, 1, 17, 0, 12, 0, 1, 0}
+		// state, section size, lg weight, number of sections and item count
+		expected = append(expected, 0, 0, 0, 0, 0, 0, 0, 0)
+		expected = append(expected, float32Bytes(12)...)
+		expected = append(expected, 0, 3, 0, 0, 5, 0, 0, 0)
+		for _, item := range []float32{5, 4, 3, 2, 1} {
+			expected = append(expected, float32Bytes(item)...)
+		}
+		Expect(exact).To(Equal(expected))
+	})
+
+	for _, hra := range []bool{true, false} {
+		hra := hra
+
+		It("Lays out the compactors of an estimation mode sketch", func() {
+			n := 10000
+			sketch := newReqSketchWithItems(int(REQ_DEFAULT_K), hra, rand.New(rand.NewSource(3)).Perm(n))
+			serializedBytes, err := sketch.Serialize()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serializedBytes[:K_SHORT+2]).To(Equal([]byte{4, 1, 17, serializedBytes[FLAGS_BYTE], 12, 0}))
+			Expect(serializedBytes[FLAGS_BYTE]&REQ_HRA_FLAG_MASK > 0).To(Equal(hra))
+			Expect(serializedBytes[FLAGS_BYTE] & (REQ_EMPTY_FLAG_MASK | REQ_RAW_ITEMS_FLAG_MASK)).To(BeZero())
+			Expect(binary.LittleEndian.Uint64(serializedBytes[N_LONG:])).To(Equal(uint64(n)))
+			Expect(util.BinaryGetFloat32(serializedBytes[REQ_MIN_FLOAT:], binary.LittleEndian)).To(Equal(float32(0)))
+			Expect(util.BinaryGetFloat32(serializedBytes[REQ_MAX_FLOAT:], binary.LittleEndian)).To(Equal(float32(n - 1)))
+
+			numCompactors := int(serializedBytes[REQ_NUM_COMPACTORS_BYTE])
+			Expect(numCompactors).To(BeNumerically(">", 2))
+			offset := REQ_DATA_START_ESTIMATION
+			var weight int64
+			for h := 0; h < numCompactors; h++ {
+				compactorBytes := serializedBytes[offset:]
+				Expect(compactorBytes[reqCompactorLgWeightByte]).To(Equal(byte(h)))
+				numSections := int(compactorBytes[reqCompactorNumSectsByte])
+				sectionSize := util.BinaryGetFloat32(compactorBytes[reqCompactorSectionSize:], binary.LittleEndian)
+				Expect(numSections).To(BeNumerically(">=", REQ_INIT_NUMBER_OF_SECTIONS))
+				Expect(sectionSize).To(BeNumerically("<=", REQ_DEFAULT_K))
+				items := make([]float32, binary.LittleEndian.Uint32(compactorBytes[reqCompactorNumItemsInt:]))
+				util.BinaryGetFloat32Slice(items, compactorBytes[REQ_COMPACTOR_DATA_START:], binary.LittleEndian)
+				if h > 0 {
+					Expect(sort.SliceIsSorted(items, func(i, j int) bool { return items[i] < items[j] })).To(BeTrue())
+				} else {
+					// the half of the nominal capacity of the first compactor
+					// at the accurate end is never compacted
+					sortFloats(items)
+					nomHalf := numSections * int(reqNearestEven(sectionSize))
+					for i := 0; i < nomHalf; i++ {
+						if hra {
+							Expect(items[len(items)-1-i]).To(Equal(float32(n - 1 - i)))
+						} else {
+							Expect(items[i]).To(Equal(float32(i)))
+						}
+					}
+				}
+				weight += int64(len(items)) << uint(h)
+				offset += REQ_COMPACTOR_DATA_START + 4*len(items)
+			}
+			Expect(weight).To(Equal(int64(n)))
+			Expect(offset).To(Equal(len(serializedBytes)))
+		})
+	}
+
+	It("Rejects invalid input", func() {
+		serializedBytes, err := newReqSketchWithRange(int(REQ_DEFAULT_K), true, 0, 100000).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		corrupt := func(modify func([]byte)) []byte {
+			corrupted := append([]byte{}, serializedBytes...)
+			modify(corrupted)
+			return corrupted
+		}
+		expectError := func(srcBytes []byte, target error) {
+			_, err := HeapifyReqSketch(srcBytes)
+			Expect(errors.Is(err, target)).To(BeTrue(), "%v", err)
+		}
+		expectError(serializedBytes[:len(serializedBytes)-4], ErrCorruptSketch)
+		expectError(corrupt(func(b []byte) { b[FAMILY_BYTE] = byte(KLL_FAMILY_ID) }), ErrFamilyMismatch)
+		expectError(corrupt(func(b []byte) { b[SER_VER_BYTE] = 2 }), ErrUnsupportedSerVer)
+		expectError(corrupt(func(b []byte) { b[K_SHORT] = 13 }), ErrCorruptSketch)
+		expectError(corrupt(func(b []byte) { b[PREAMBLE_LONGS_BYTE] = 2 }), ErrCorruptSketch)
+		expectError(corrupt(func(b []byte) { b[FLAGS_BYTE] |= 1 }), ErrCorruptSketch)
+		expectError(corrupt(func(b []byte) { binary.LittleEndian.PutUint64(b[N_LONG:], 99999) }), ErrCorruptSketch)
+		expectError(corrupt(func(b []byte) { copy(b[len(b)-4:], float32Bytes(-1)) }), ErrCorruptSketch)
+		expectError(corrupt(func(b []byte) { b[REQ_DATA_START_ESTIMATION+reqCompactorNumSectsByte] = 5 }), ErrCorruptSketch)
+	})
+
+	It("Caps the number of sections of a compactor", func() {
+		serializedBytes, err := newReqSketchWithRange(int(REQ_DEFAULT_K), true, 0, 10).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		numSectionsByte := REQ_DATA_START + reqCompactorNumSectsByte
+		serializedBytes[numSectionsByte] = 96
+		_, err = HeapifyReqSketch(serializedBytes)
+		Expect(errors.Is(err, ErrCorruptSketch)).To(BeTrue(), "%v", err)
+
+		// a state past 2^47 compactions must not double 48 sections
+		serializedBytes[numSectionsByte] = byte(reqMaxNumSections)
+		binary.LittleEndian.PutUint64(serializedBytes[REQ_DATA_START+reqCompactorStateLong:], math.MaxUint64>>1)
+		sketch, err := HeapifyReqSketch(serializedBytes)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 10; i < 200000; i++ {
+			Expect(sketch.Update(float32(i))).To(Succeed())
+		}
+		Expect(int32(sketch.compactors[0].numSections)).To(Equal(reqMaxNumSections))
+		Expect(sketch.compactors[0].getNomCapacity()).To(BeNumerically(">", 0))
+		reserializedBytes, err := sketch.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		heapified, err := HeapifyReqSketch(reserializedBytes)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(heapified.GetN()).To(Equal(int64(200000)))
+	})
+})
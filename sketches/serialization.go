@@ -2,6 +2,8 @@ package sketches
 
 import (
 	"encoding/binary"
+	"fmt"
+	"math/rand"
 	"sort"
 
 	"github.com/fluxninja/datasketches-go/sketches/util"
@@ -31,18 +33,132 @@ const (
 
 type DoublesSketchImpl struct {
 	DoublesSketch
+
+	sortedView *DoublesSketchSortedView
+	rand       *rand.Rand
+	items      itemPolicies
+
+	// accessors reused by every compaction of a full base buffer, so that
+	// updates do not allocate in steady state
+	bbAccessor    DoublesSketchAccessor
+	tgtAccessor   DoublesSketchAccessor
+	levelAccessor DoublesSketchAccessor
+}
+
+func (s *DoublesSketchImpl) getUpdateAccessors() (DoublesSketchAccessor, DoublesSketchAccessor, DoublesSketchAccessor) {
+	if s.bbAccessor == nil {
+		s.bbAccessor = NewDoublesSketchAccessor(s, true)
+		s.tgtAccessor = NewDoublesSketchAccessor(s, true)
+		s.levelAccessor = NewDoublesSketchAccessor(s, true)
+	}
+	return s.bbAccessor, s.tgtAccessor, s.levelAccessor
 }
 
+// getRandom returns the generator used to pick which half of the items
+// survives a compaction. Sketches that were not given a random seed get
+// their own generator, seeded from the global source.
+func (s *DoublesSketchImpl) getRandom() *rand.Rand {
+	if s.rand == nil {
+		s.rand = rand.New(util.NewSplitMix64Source(rand.Int63()))
+	}
+	return s.rand
+}
+
+// Serialize serializes the sketch in its own compact or updatable format, in
+// little-endian byte order.
 func (s *DoublesSketchImpl) Serialize() ([]byte, error) {
 	return s.SerializeCustom(s.IsCompact())
 }
 
+// SerializeCustom serializes the sketch in little-endian byte order, the
+// canonical DataSketches format, whatever the host. Use
+// SerializeWithByteOrder for big-endian or host order.
 func (s *DoublesSketchImpl) SerializeCustom(compact bool) ([]byte, error) {
-	byteOrder := util.DetermineNativeByteOrder()
+	return s.SerializeWithByteOrder(compact, binary.LittleEndian)
+}
+
+// SerializeWithByteOrder serializes the sketch in the given byte order, which
+// must be binary.LittleEndian or binary.BigEndian. Little-endian is the
+// canonical DataSketches format; big-endian output sets BIG_ENDIAN_FLAG_MASK
+// so that it can be read back on any host.
+func (s *DoublesSketchImpl) SerializeWithByteOrder(compact bool, byteOrder binary.ByteOrder) ([]byte, error) {
+	if _, err := byteOrderFlag(byteOrder); err != nil {
+		return nil, err
+	}
 	return s.toByteArray(compact, compact, byteOrder)
 }
 
+// AppendSerialize appends the serialized sketch, as returned by Serialize, to
+// dst and returns the extended slice. It allocates only if dst lacks capacity.
+func (s *DoublesSketchImpl) AppendSerialize(dst []byte) ([]byte, error) {
+	return s.AppendSerializeWithByteOrder(dst, binary.LittleEndian)
+}
+
+// AppendSerializeWithByteOrder is AppendSerialize in the given byte order,
+// which must be binary.LittleEndian or binary.BigEndian.
+func (s *DoublesSketchImpl) AppendSerializeWithByteOrder(dst []byte, byteOrder binary.ByteOrder) ([]byte, error) {
+	if _, err := byteOrderFlag(byteOrder); err != nil {
+		return dst, err
+	}
+	compact := s.IsCompact()
+	start := len(dst)
+	size := s.GetSerializedSizeBytes(compact)
+	if cap(dst)-start < size {
+		newDst := make([]byte, start, start+size)
+		copy(newDst, dst)
+		dst = newDst
+	}
+	dst = dst[:start+size]
+	if err := s.writeByteArray(dst[start:], compact, compact, byteOrder); err != nil {
+		return dst[:start], err
+	}
+	return dst, nil
+}
+
+// SerializeInto writes the serialized sketch, as returned by Serialize, to
+// the start of dst and returns the number of bytes written. dst must have at
+// least GetSerializedSizeBytes(IsCompact()) bytes.
+func (s *DoublesSketchImpl) SerializeInto(dst []byte) (int, error) {
+	return s.SerializeIntoWithByteOrder(dst, binary.LittleEndian)
+}
+
+// SerializeIntoWithByteOrder is SerializeInto in the given byte order, which
+// must be binary.LittleEndian or binary.BigEndian.
+func (s *DoublesSketchImpl) SerializeIntoWithByteOrder(dst []byte, byteOrder binary.ByteOrder) (int, error) {
+	if _, err := byteOrderFlag(byteOrder); err != nil {
+		return 0, err
+	}
+	compact := s.IsCompact()
+	size := s.GetSerializedSizeBytes(compact)
+	if len(dst) < size {
+		return 0, fmt.Errorf("destination too small: %v < %v", len(dst), size)
+	}
+	if err := s.writeByteArray(dst[:size], compact, compact, byteOrder); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// GetSerializedSizeBytes returns the number of bytes the sketch serializes to
+// in the compact or updatable format.
+func (s *DoublesSketchImpl) GetSerializedSizeBytes(compact bool) int {
+	if compact {
+		return int(computeCompactStorageBytes(s.GetK(), s.GetN()))
+	}
+	return int(computeUpdateableStorageBytes(s.GetK(), s.GetN()))
+}
+
 func (s *DoublesSketchImpl) toByteArray(compact bool, ordered bool, byteOrder binary.ByteOrder) ([]byte, error) {
+	outByteArray := make([]byte, s.GetSerializedSizeBytes(compact))
+	if err := s.writeByteArray(outByteArray, compact, ordered, byteOrder); err != nil {
+		return nil, err
+	}
+	return outByteArray, nil
+}
+
+// writeByteArray serializes the sketch into outByteArray, which must have
+// exactly GetSerializedSizeBytes(compact) bytes.
+func (s *DoublesSketchImpl) writeByteArray(outByteArray []byte, compact bool, ordered bool, byteOrder binary.ByteOrder) error {
 	var preLongs int32 = 2
 	var extraSpaceForMinMax int32 = 2
 	var prePlusExtraBytes int32 = (preLongs + extraSpaceForMinMax) << 3
@@ -57,24 +173,25 @@ func (s *DoublesSketchImpl) toByteArray(compact bool, ordered bool, byteOrder bi
 	if ordered {
 		flags |= ORDERED_FLAG_MASK
 	}
+	byteOrderFlags, err := byteOrderFlag(byteOrder)
+	if err != nil {
+		return err
+	}
+	flags |= byteOrderFlags
 
 	var k int32 = s.GetK()
 	var n int64 = s.GetN()
 
 	var dsa = NewDoublesSketchAccessor(s, !compact)
 
-	var outBytes int32
-	if compact {
-		outBytes = computeCompactStorageBytes(k, n)
-	} else {
-		outBytes = computeUpdateableStorageBytes(k, n)
+	// a reused buffer may hold old data in the unused space of the levels
+	for i := range outByteArray {
+		outByteArray[i] = 0
 	}
 
-	var outByteArray = make([]byte, outBytes)
-
 	insertPre0(outByteArray, byteOrder, preLongs, flags, k)
 	if s.IsEmpty() {
-		return outByteArray, nil
+		return nil
 	}
 
 	byteOrder.PutUint64(outByteArray[N_LONG:], uint64(n))
@@ -86,13 +203,16 @@ func (s *DoublesSketchImpl) toByteArray(compact bool, ordered bool, byteOrder bi
 	var bbCount int32 = util.ComputeBaseBufferItems(k, n)
 
 	if bbCount > 0 {
-		var bbItemsArray []float64 = dsa.GetArray(0, bbCount)
+		var bbItemsArray []float64
 		if ordered {
+			bbItemsArray = dsa.GetArray(0, bbCount)
 			sort.Float64s(bbItemsArray)
+		} else {
+			bbItemsArray = viewItems(dsa, 0, bbCount)
 		}
 		err := util.BinaryPutFloat64Slice(outByteArray[memOffsetBytes:], byteOrder, bbItemsArray)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
@@ -107,16 +227,16 @@ func (s *DoublesSketchImpl) toByteArray(compact bool, ordered bool, byteOrder bi
 		dsa.SetLevel(level)
 		if dsa.NumItems() > 0 {
 			util.Assert(dsa.NumItems() == k, "dsa.NumItems() == k")
-			floats := dsa.GetArray(0, k)
+			floats := viewItems(dsa, 0, k)
 			err := util.BinaryPutFloat64Slice(outByteArray[memOffsetBytes:], byteOrder, floats)
 			if err != nil {
-				return nil, err
+				return err
 			}
 			memOffsetBytes += int64(k) << 3
 		}
 	}
 
-	return outByteArray, nil
+	return nil
 }
 
 func insertPre0(outBytes []byte, byteOrder binary.ByteOrder, preLongs, flags, k int32) {
@@ -127,6 +247,26 @@ func insertPre0(outBytes []byte, byteOrder binary.ByteOrder, preLongs, flags, k
 	byteOrder.PutUint16(outBytes[K_SHORT:], uint16(k))
 }
 
+// byteOrderFlag returns the preamble flag that records the given byte order.
+func byteOrderFlag(byteOrder binary.ByteOrder) (int32, error) {
+	switch byteOrder {
+	case binary.LittleEndian:
+		return 0, nil
+	case binary.BigEndian:
+		return BIG_ENDIAN_FLAG_MASK, nil
+	default:
+		return 0, fmt.Errorf("unsupported byte order: %v", byteOrder)
+	}
+}
+
+// flagByteOrder returns the byte order recorded in the preamble flags.
+func flagByteOrder(flags int32) binary.ByteOrder {
+	if flags&BIG_ENDIAN_FLAG_MASK > 0 {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
 func computeCompactStorageBytes(k int32, n int64) int32 {
 	if n == 0 {
 		return 8
@@ -0,0 +1,78 @@
+package sketches
+
+import (
+	"encoding/binary"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Buffer-reusing serialization", func() {
+	for _, n := range []int{0, 1, 1000, 100000} {
+		n := n
+
+		It("Matches Serialize", func() {
+			sketch := newSketchWithRange(defaultK, 0, n)
+			for _, source := range []DoublesSketch{sketch, sketch.Compact()} {
+				expected, err := source.Serialize()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(source.GetSerializedSizeBytes(source.IsCompact())).To(Equal(len(expected)))
+
+				prefix := []byte{1, 2, 3}
+				appended, err := source.AppendSerialize(prefix)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(appended[:3]).To(Equal(prefix))
+				Expect(appended[3:]).To(Equal(expected))
+
+				dirty := make([]byte, len(expected)+16)
+				for i := range dirty {
+					dirty[i] = 0xFF
+				}
+				written, err := source.SerializeInto(dirty)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(written).To(Equal(len(expected)))
+				Expect(dirty[:written]).To(Equal(expected))
+
+				reused, err := source.AppendSerialize(dirty[:0])
+				Expect(err).ToNot(HaveOccurred())
+				Expect(&reused[0]).To(Equal(&dirty[0]))
+				Expect(reused).To(Equal(expected))
+			}
+		})
+	}
+
+	It("Writes the given byte order", func() {
+		sketch := newSketchWithRange(defaultK, 0, 1000)
+		for _, byteOrder := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			expected, err := sketch.SerializeWithByteOrder(false, byteOrder)
+			Expect(err).ToNot(HaveOccurred())
+			appended, err := sketch.AppendSerializeWithByteOrder(nil, byteOrder)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(appended).To(Equal(expected))
+			buf := make([]byte, len(expected))
+			written, err := sketch.SerializeIntoWithByteOrder(buf, byteOrder)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf[:written]).To(Equal(expected))
+		}
+		_, err := sketch.AppendSerializeWithByteOrder(nil, nil)
+		Expect(err).To(HaveOccurred())
+		_, err = sketch.SerializeIntoWithByteOrder(make([]byte, 1<<16), nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Rejects a destination that is too small", func() {
+		sketch := newSketchWithRange(defaultK, 0, 1000)
+		_, err := sketch.SerializeInto(make([]byte, 16))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Allocates a bounded amount when reusing a buffer", func() {
+		sketch := newSketchWithRange(defaultK, 0, 1000000)
+		buf := make([]byte, sketch.GetSerializedSizeBytes(false))
+		allocs := testing.AllocsPerRun(10, func() {
+			_, _ = sketch.SerializeInto(buf)
+		})
+		Expect(allocs).To(BeNumerically("<=", 2))
+	})
+})
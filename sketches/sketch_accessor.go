@@ -8,17 +8,47 @@ import (
 
 const BB_LVL_IDX = -1
 
-type DoublesSketchAccessor interface {
-	SetLevel(level int32)
+type DoublesBufferAccessor interface {
 	NumItems() int32
 	GetArray(fromIdx int32, numItems int32) []float64
 	PutArray(srcArray []float64, srcIndex, dstIndex, numItems int32)
 	Get(index int32) float64
 	Set(index int32, value float64) float64
+}
+
+type DoublesSketchAccessor interface {
+	DoublesBufferAccessor
+	SetLevel(level int32)
 	Sort()
 	CopyAndSetLevel(level int32) DoublesSketchAccessor
 }
 
+// doublesSliceAccessor is implemented by accessors over a []float64, which can
+// expose their items without copying them.
+type doublesSliceAccessor interface {
+	itemSlice(fromIdx int32, numItems int32) []float64
+}
+
+// viewItems returns the given items of acc, sharing the underlying slice when
+// acc allows it. The result must not be modified.
+func viewItems(acc DoublesBufferAccessor, fromIdx int32, numItems int32) []float64 {
+	if sliceAcc, ok := acc.(doublesSliceAccessor); ok {
+		return sliceAcc.itemSlice(fromIdx, numItems)
+	}
+	return acc.GetArray(fromIdx, numItems)
+}
+
+// copyItems copies numItems items from src to dst without allocating.
+func copyItems(src DoublesBufferAccessor, srcIndex int32, dst DoublesBufferAccessor, dstIndex int32, numItems int32) {
+	if sliceAcc, ok := src.(doublesSliceAccessor); ok {
+		dst.PutArray(sliceAcc.itemSlice(srcIndex, numItems), 0, dstIndex, numItems)
+		return
+	}
+	for i := int32(0); i < numItems; i++ {
+		dst.Set(dstIndex+i, src.Get(srcIndex+i))
+	}
+}
+
 type AbstractDoublesSketchAccessor struct {
 	DoublesSketchAccessor
 
@@ -82,16 +112,77 @@ func (acc *AbstractDoublesSketchAccessor) countValidLevelsBelow(level int32) int
 
 func NewDoublesSketchAccessor(sketch DoublesSketch, forceSize bool) DoublesSketchAccessor {
 	if sketch.IsDirect() {
-		// TODO: FLUX-1797, implement NewDirectDoublesSketchAccessor
-		return NewHeapDoublesSketchAccessor(sketch, forceSize, BB_LVL_IDX)
+		return NewDirectDoublesSketchAccessor(sketch, forceSize, BB_LVL_IDX)
 	}
 	return NewHeapDoublesSketchAccessor(sketch, forceSize, BB_LVL_IDX)
 }
 
-type DirectDoublesSketchAccessor struct{}
+// DirectDoublesSketchAccessor reads and writes the items of a sketch that
+// lives in a byte slice. Its offsets are in bytes.
+type DirectDoublesSketchAccessor struct {
+	*AbstractDoublesSketchAccessor
+
+	direct directDoublesSketch
+	// sortBuf is reused by Sort
+	sortBuf []float64
+}
+
+func (acc *DirectDoublesSketchAccessor) CopyAndSetLevel(level int32) DoublesSketchAccessor {
+	return NewDirectDoublesSketchAccessor(acc.sketch, acc.forceSize, level)
+}
+
+func NewDirectDoublesSketchAccessor(sketch DoublesSketch, forceSize bool, level int32) *DirectDoublesSketchAccessor {
+	accessor := &DirectDoublesSketchAccessor{
+		AbstractDoublesSketchAccessor: &AbstractDoublesSketchAccessor{
+			sketch:    sketch,
+			forceSize: forceSize,
+		},
+		direct: asDirectDoublesSketch(sketch),
+	}
+	accessor.SetLevel(level)
+	return accessor
+}
+
+func (acc *DirectDoublesSketchAccessor) GetArray(fromIdx int32, numItems int32) []float64 {
+	stIdx := acc.offset + (fromIdx << 3)
+	x := make([]float64, numItems)
+	util.BinaryGetFloat64Slice(x, acc.direct.GetMemory()[stIdx:], acc.direct.getByteOrder())
+	return x
+}
+
+func (acc *DirectDoublesSketchAccessor) PutArray(srcArray []float64, srcIndex, dstIndex, numItems int32) {
+	var tgtIdx int32 = acc.offset + (dstIndex << 3)
+	mem := acc.direct.GetMemory()
+	byteOrder := acc.direct.getByteOrder()
+	for i := int32(0); i < numItems; i++ {
+		util.BinaryPutFloat64(mem[tgtIdx+(i<<3):], byteOrder, srcArray[srcIndex+i])
+	}
+}
 
-func NewDirectDoublesSketchAccessor() *DirectDoublesSketchAccessor {
-	return &DirectDoublesSketchAccessor{}
+func (acc *DirectDoublesSketchAccessor) Get(index int32) float64 {
+	return util.BinaryGetFloat64(acc.direct.GetMemory()[acc.offset+(index<<3):], acc.direct.getByteOrder())
+}
+
+func (acc *DirectDoublesSketchAccessor) Set(index int32, value float64) float64 {
+	idxOffset := acc.offset + (index << 3)
+	mem := acc.direct.GetMemory()
+	byteOrder := acc.direct.getByteOrder()
+	oldVal := util.BinaryGetFloat64(mem[idxOffset:], byteOrder)
+	util.BinaryPutFloat64(mem[idxOffset:], byteOrder, value)
+	return oldVal
+}
+
+func (acc *DirectDoublesSketchAccessor) Sort() {
+	if !acc.sketch.IsCompact() {
+		numItems := acc.NumItems()
+		if int32(cap(acc.sortBuf)) < numItems {
+			acc.sortBuf = make([]float64, numItems)
+		}
+		items := acc.sortBuf[:numItems]
+		util.BinaryGetFloat64Slice(items, acc.direct.GetMemory()[acc.offset:], acc.direct.getByteOrder())
+		sort.Float64s(items)
+		acc.PutArray(items, 0, 0, numItems)
+	}
 }
 
 type HeapDoublesSketchAccessor struct {
@@ -120,6 +211,11 @@ func (acc *HeapDoublesSketchAccessor) GetArray(fromIdx int32, numItems int32) []
 	return x
 }
 
+func (acc *HeapDoublesSketchAccessor) itemSlice(fromIdx int32, numItems int32) []float64 {
+	stIdx := acc.offset + fromIdx
+	return acc.sketch.GetCombinedBuffer()[stIdx : stIdx+numItems]
+}
+
 func (acc *HeapDoublesSketchAccessor) PutArray(srcArray []float64, srcIndex, dstIndex, numItems int32) {
 	var tgtIdx int32 = acc.offset + dstIndex
 	copy(acc.sketch.GetCombinedBuffer()[tgtIdx:tgtIdx+numItems], srcArray[srcIndex:srcIndex+numItems])
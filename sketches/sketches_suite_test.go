@@ -3,11 +3,14 @@ package sketches
 import (
 	"testing"
 
+	"github.com/fluxninja/datasketches-go/sketches/util"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 func TestSketches(t *testing.T) {
+	// failed internal consistency checks fail the tests
+	util.SetAssertionMode(util.ASSERT_PANIC)
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Sketches Suite")
 }
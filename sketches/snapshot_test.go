@@ -0,0 +1,70 @@
+package sketches
+
+import (
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot", func() {
+	for _, n := range []int{0, 1, 100, 1000, 100000} {
+		n := n
+
+		It("Is not affected by later updates", func() {
+			sketch := newSketchWithRange(defaultK, 0, n)
+			expected, err := sketch.Compact().Serialize()
+			Expect(err).ToNot(HaveOccurred())
+
+			snapshot := sketch.Snapshot()
+			for i := n; i < 3*n+1000; i++ {
+				Expect(sketch.Update(float64(i))).To(Succeed())
+			}
+			Expect(snapshot.GetN()).To(Equal(int64(n)))
+			actual, err := snapshot.Serialize()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(Equal(expected))
+			expectRanksWithin(sketch, 3*n+1000, 0.02)
+		})
+	}
+
+	It("Is not affected by merging into the sketch", func() {
+		sketch := newSketchWithRange(defaultK, 0, 10000)
+		expected, err := sketch.Compact().Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		snapshot := sketch.Snapshot()
+		Expect(mergeInto(newSketchWithRange(defaultK, 10000, 20000), sketch)).To(Succeed())
+		Expect(downSamplingMergeInto(newSketchWithRange(2*defaultK, 20000, 30000), sketch)).To(Succeed())
+		actual, err := snapshot.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(Equal(expected))
+	})
+
+	It("Can be read while updates continue", func() {
+		sketch := newSketchWithRange(defaultK, 0, 10000)
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer GinkgoRecover()
+			defer wg.Done()
+			for i := 10000; i < 200000; i++ {
+				mu.Lock()
+				Expect(sketch.Update(float64(i))).To(Succeed())
+				mu.Unlock()
+			}
+		}()
+		for i := 0; i < 50; i++ {
+			mu.Lock()
+			snapshot := sketch.Snapshot()
+			mu.Unlock()
+			n := snapshot.GetN()
+			quantile, err := snapshot.GetQuantile(0.5)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(quantile / float64(n)).To(BeNumerically("~", 0.5, 0.02))
+			_, err = snapshot.Serialize()
+			Expect(err).ToNot(HaveOccurred())
+		}
+		wg.Wait()
+	})
+})
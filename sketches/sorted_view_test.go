@@ -0,0 +1,79 @@
+package sketches
+
+import (
+	"sort"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DoublesSketchSortedView", func() {
+	It("Sorts all retained items with cumulative weights", func() {
+		sketch, err := NewDoublesSketch(16)
+		Expect(err).ToNot(HaveOccurred())
+		n := 1000
+		for i := n; i > 0; i-- {
+			Expect(sketch.Update(float64(i))).To(Succeed())
+		}
+		sortedView := NewDoublesSketchSortedView(sketch)
+		Expect(sortedView.GetN()).To(Equal(int64(n)))
+		items := sortedView.GetItems()
+		Expect(sort.Float64sAreSorted(items)).To(BeTrue())
+		cumWeights := sortedView.GetCumulativeWeights()
+		Expect(cumWeights).To(HaveLen(len(items)))
+		Expect(cumWeights[len(cumWeights)-1]).To(Equal(int64(n)))
+		for i := 1; i < len(cumWeights); i++ {
+			Expect(cumWeights[i]).To(BeNumerically(">", cumWeights[i-1]))
+		}
+	})
+
+	It("Is cached until the next update", func() {
+		sketch, err := NewDoublesSketch(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sketch.Update(1)).To(Succeed())
+		sortedView := sketch.GetSortedView()
+		Expect(sketch.GetSortedView()).To(BeIdenticalTo(sortedView))
+
+		Expect(sketch.Update(2)).To(Succeed())
+		Expect(sketch.GetSortedView()).ToNot(BeIdenticalTo(sortedView))
+		Expect(sketch.GetSortedView().GetItems()).To(Equal([]float64{1, 2}))
+	})
+
+	It("Is discarded by the setters", func() {
+		sketch := newSketchWithRange(defaultK, 0, 10)
+		direct, err := NewDirectUpdateDoublesSketch(defaultK, make([]byte, 1024), nil)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < 10; i++ {
+			Expect(direct.Update(float64(i))).To(Succeed())
+		}
+		for _, s := range []DoublesSketch{sketch, sketch.Compact(), direct} {
+			sortedView := s.GetSortedView()
+			Expect(s.PutMaxValue(100)).To(Succeed())
+			Expect(s.GetSortedView()).ToNot(BeIdenticalTo(sortedView))
+			sortedView = s.GetSortedView()
+			combinedBuffer := append([]float64{}, s.GetCombinedBuffer()...)
+			combinedBuffer[0] = 100
+			Expect(s.PutCombinedBuffer(combinedBuffer)).To(Succeed())
+			Expect(s.GetSortedView()).ToNot(BeIdenticalTo(sortedView))
+			Expect(s.GetSortedView().GetItems()).To(ContainElement(100.0))
+		}
+	})
+
+	It("Answers quantile queries with both search criteria", func() {
+		sketch, err := NewDoublesSketch(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 1; i <= 10; i++ {
+			Expect(sketch.Update(float64(i))).To(Succeed())
+		}
+		sortedView := sketch.GetSortedView()
+		quantile, err := sortedView.GetQuantile(0.5, INCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quantile).To(Equal(5.0))
+		quantile, err = sortedView.GetQuantile(0.5, EXCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quantile).To(Equal(6.0))
+		quantile, err = sortedView.GetQuantile(1, EXCLUSIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quantile).To(Equal(10.0))
+	})
+})
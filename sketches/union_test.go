@@ -0,0 +1,116 @@
+package sketches
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func newSketchWithRange(k int, from, to int) *HeapDoublesSketch {
+	sketch, err := NewDoublesSketch(k)
+	Expect(err).ToNot(HaveOccurred())
+	for i := from; i < to; i++ {
+		Expect(sketch.Update(float64(i))).To(Succeed())
+	}
+	return sketch
+}
+
+func expectRanksWithin(sketch DoublesSketch, n int, eps float64) {
+	Expect(sketch.GetN()).To(Equal(int64(n)))
+	Expect(sketch.GetMinValue()).To(Equal(0.0))
+	Expect(sketch.GetMaxValue()).To(Equal(float64(n - 1)))
+	for _, rank := range []float64{0.01, 0.25, 0.5, 0.75, 0.99} {
+		quantile, err := sketch.GetQuantile(rank)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quantile / float64(n)).To(BeNumerically("~", rank, eps))
+	}
+}
+
+var _ = Describe("DoublesUnion", func() {
+	It("Returns an empty result when nothing was merged", func() {
+		union, err := NewDoublesUnion(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(union.IsEmpty()).To(BeTrue())
+		result := union.GetResult()
+		Expect(result.IsEmpty()).To(BeTrue())
+		Expect(result.GetK()).To(Equal(int32(defaultK)))
+	})
+
+	It("Rejects an invalid max k", func() {
+		_, err := NewDoublesUnion(100)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Merges sketches and values with the same k", func() {
+		union, err := NewDoublesUnion(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(union.UpdateSketch(newSketchWithRange(defaultK, 0, 10000))).To(Succeed())
+		Expect(union.UpdateSketch(newSketchWithRange(defaultK, 10000, 20000).Compact())).To(Succeed())
+		for i := 20000; i < 20100; i++ {
+			Expect(union.UpdateValue(float64(i))).To(Succeed())
+		}
+		expectRanksWithin(union.GetResult(), 20100, 0.02)
+	})
+
+	It("Downsamples sketches with a larger k", func() {
+		union, err := NewDoublesUnion(64)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(union.UpdateSketch(newSketchWithRange(256, 0, 50000))).To(Succeed())
+		Expect(union.UpdateSketch(newSketchWithRange(1024, 50000, 100000))).To(Succeed())
+		Expect(union.GetEffectiveK()).To(Equal(int32(64)))
+		expectRanksWithin(union.GetResult(), 100000, 0.04)
+	})
+
+	It("Adopts a smaller k of a merged sketch", func() {
+		union, err := NewDoublesUnion(1024)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(union.UpdateSketch(newSketchWithRange(1024, 0, 50000))).To(Succeed())
+		Expect(union.UpdateSketch(newSketchWithRange(64, 50000, 100000))).To(Succeed())
+		Expect(union.GetEffectiveK()).To(Equal(int32(64)))
+		expectRanksWithin(union.GetResult(), 100000, 0.04)
+	})
+
+	It("Keeps its accuracy across a merge tree", func() {
+		leaves := make([]*HeapDoublesSketch, 0, 16)
+		for i := 0; i < 16; i++ {
+			leaves = append(leaves, newSketchWithRange(defaultK, i*5000, (i+1)*5000))
+		}
+		for len(leaves) > 1 {
+			next := make([]*HeapDoublesSketch, 0, len(leaves)/2)
+			for i := 0; i < len(leaves); i += 2 {
+				union, err := NewDoublesUnion(defaultK)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(union.UpdateSketch(leaves[i])).To(Succeed())
+				Expect(union.UpdateSketch(leaves[i+1])).To(Succeed())
+				next = append(next, union.GetResultAndReset())
+			}
+			leaves = next
+		}
+		expectRanksWithin(leaves[0], 80000, 0.02)
+	})
+
+	It("Does not modify the merged sketches", func() {
+		sketch := newSketchWithRange(defaultK, 0, 1000)
+		expected, err := sketch.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		union, err := NewDoublesUnion(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(union.UpdateSketch(sketch)).To(Succeed())
+		Expect(union.UpdateSketch(newSketchWithRange(defaultK, 0, 1000))).To(Succeed())
+		actual, err := sketch.Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(Equal(expected))
+	})
+
+	It("Resets", func() {
+		union, err := NewDoublesUnion(defaultK)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(union.UpdateSketch(newSketchWithRange(defaultK, 0, 1000))).To(Succeed())
+		result := union.GetResultAndReset()
+		Expect(result.GetN()).To(Equal(int64(1000)))
+		Expect(union.IsEmpty()).To(BeTrue())
+
+		Expect(union.UpdateValue(1)).To(Succeed())
+		union.Reset()
+		Expect(union.IsEmpty()).To(BeTrue())
+	})
+})
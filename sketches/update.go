@@ -1,15 +1,16 @@
 package sketches
 
 import (
-	"math"
 	"math/rand"
 
 	"github.com/fluxninja/datasketches-go/sketches/util"
 )
 
+// Update updates the sketch with the given item. By default NaNs are ignored;
+// see DoublesSketchBuilder.SetNaNPolicy and SetInfinityPolicy.
 func (s *HeapDoublesSketch) Update(dataItem float64) error {
-	if math.IsNaN(dataItem) {
-		return nil
+	if keep, err := s.items.check(dataItem); !keep {
+		return err
 	}
 	if s.n == 0 {
 		s.PutMaxValue(dataItem)
@@ -35,34 +36,93 @@ func (s *HeapDoublesSketch) Update(dataItem float64) error {
 	s.combinedBuffer[currentBBCount] = dataItem
 
 	if newBBCount == (s.k << 1) {
-		spaceNeeded := computeRequiredItemCapacity(s.k, newN)
+		s.propagateFullBaseBuffer(newN)
+	} else {
+		s.baseBufferCount = newBBCount
+	}
+	s.n = newN
+	s.resetSortedView()
+	return nil
+}
 
-		if spaceNeeded > combinedBufferCap {
-			s.growCombinedBuffer(combinedBufferCap, spaceNeeded)
+// UpdateBatch updates the sketch with all the given items. The result is
+// identical to calling Update for each item in order, but the base buffer is
+// filled directly and sorted and propagated once per 2k items. If any item is
+// rejected, none of them are added.
+func (s *HeapDoublesSketch) UpdateBatch(dataItems []float64) error {
+	if err := s.items.checkAll(dataItems); err != nil {
+		return err
+	}
+	var twoK int32 = s.k << 1
+	var bbCount int32 = s.baseBufferCount
+	var n int64 = s.n
+	minValue := s.minValue
+	maxValue := s.maxValue
+
+	for _, dataItem := range dataItems {
+		if keep, _ := s.items.check(dataItem); !keep {
+			continue
+		}
+		if n == 0 {
+			minValue = dataItem
+			maxValue = dataItem
+		} else if dataItem > maxValue {
+			maxValue = dataItem
+		} else if dataItem < minValue {
+			minValue = dataItem
 		}
 
-		bbAccessor := NewDoublesSketchAccessor(s, true)
-		bbAccessor.Sort()
+		if bbCount == int32(len(s.combinedBuffer)) {
+			s.growBaseBuffer()
+		}
+		s.combinedBuffer[bbCount] = dataItem
+		bbCount++
+		n++
 
-		var newBitPattern int64 = inPlacePropagateCarry(
-			0,
-			nil,
-			bbAccessor,
-			true,
-			s.k,
-			NewDoublesSketchAccessor(s, true),
-			s.bitPattern)
+		if bbCount == twoK {
+			s.propagateFullBaseBuffer(n)
+			bbCount = 0
+		}
+	}
 
-		util.Assert(newBitPattern == util.ComputeBitPattern(s.k, newN), "newBitPattern == util.ComputeBitPattern(s.k, newN)")
-		util.Assert(newBitPattern == s.bitPattern+1, "newBitPattern == s.bitPattern + 1")
+	s.baseBufferCount = bbCount
+	s.n = n
+	s.minValue = minValue
+	s.maxValue = maxValue
+	s.resetSortedView()
+	return nil
+}
 
-		s.bitPattern = newBitPattern
-		s.baseBufferCount = 0
-	} else {
-		s.baseBufferCount = newBBCount
+// propagateFullBaseBuffer sorts the full base buffer and carries it into the
+// levels, given the n that includes the base buffer.
+func (s *HeapDoublesSketch) propagateFullBaseBuffer(newN int64) {
+	var combinedBufferCap int32 = int32(len(s.combinedBuffer))
+	spaceNeeded := computeRequiredItemCapacity(s.k, newN)
+	if spaceNeeded > combinedBufferCap {
+		s.growCombinedBuffer(combinedBufferCap, spaceNeeded)
 	}
-	s.n = newN
-	return nil
+	s.unshareLevels()
+
+	bbAccessor, tgtAccessor, levelAccessor := s.getUpdateAccessors()
+	bbAccessor.SetLevel(BB_LVL_IDX)
+	bbAccessor.Sort()
+
+	var newBitPattern int64 = inPlacePropagateCarry(
+		0,
+		nil,
+		bbAccessor,
+		true,
+		s.k,
+		tgtAccessor,
+		levelAccessor,
+		s.bitPattern,
+		s.getRandom())
+
+	util.Assert(newBitPattern == util.ComputeBitPattern(s.k, newN), "newBitPattern == util.ComputeBitPattern(s.k, newN)")
+	util.Assert(newBitPattern == s.bitPattern+1, "newBitPattern == s.bitPattern + 1")
+
+	s.bitPattern = newBitPattern
+	s.baseBufferCount = 0
 }
 
 func (s *HeapDoublesSketch) growBaseBuffer() {
@@ -78,45 +138,57 @@ func (s *HeapDoublesSketch) growCombinedBuffer(currentSpace int32, spaceNeeded i
 	var combinedBuffer []float64 = s.combinedBuffer
 	s.combinedBuffer = make([]float64, spaceNeeded)
 	copy(s.combinedBuffer, combinedBuffer)
+	s.levelsShared = false
 }
 
-// Note: optSrcKBuf and size2KBuf use DoubleBufferAccessor in the original
+// inPlacePropagateCarry carries a new level into tgtSketchBuf starting at
+// startingLevel. The update version zips size2KBuf into the new level, while
+// the merge version copies optSrcKBuf into it; size2KBuf is scratch space for
+// the carries in both cases. currLevelBuf is an optional second accessor of
+// the target sketch that is reused for reading the levels being carried.
 func inPlacePropagateCarry(
 	startingLevel int32,
-	optSrcKBuf DoublesSketchAccessor,
-	size2KBuf DoublesSketchAccessor,
+	optSrcKBuf DoublesBufferAccessor,
+	size2KBuf DoublesBufferAccessor,
 	doUpdateVersion bool,
 	k int32,
 	tgtSketchBuf DoublesSketchAccessor,
+	currLevelBuf DoublesSketchAccessor,
 	bitPattern int64,
+	rnd *rand.Rand,
 ) int64 {
 	endingLevel := util.LowestZeroBitStartingAt(bitPattern, startingLevel)
 	tgtSketchBuf.SetLevel(endingLevel)
 	if doUpdateVersion {
-		zipSize2KBuffer(size2KBuf, tgtSketchBuf)
+		zipSize2KBuffer(size2KBuf, tgtSketchBuf, rnd)
 	} else {
-		// TODO: FLUX-1797 merge not implemented yet
-		zipSize2KBuffer(size2KBuf, tgtSketchBuf)
+		util.Assert(optSrcKBuf != nil, "optSrcKBuf != nil")
+		copyItems(optSrcKBuf, 0, tgtSketchBuf, 0, k)
 	}
 
 	for lvl := startingLevel; lvl < endingLevel; lvl++ {
 		util.Assert((bitPattern&(1<<lvl)) > 0, "(bitPattern & (1 << lvl)) > 0")
-		currLevelBuf := tgtSketchBuf.CopyAndSetLevel(lvl)
+		if currLevelBuf == nil {
+			currLevelBuf = tgtSketchBuf.CopyAndSetLevel(lvl)
+		} else {
+			currLevelBuf.SetLevel(lvl)
+		}
 		mergeTwoSizeKBuffers(
 			currLevelBuf,
 			tgtSketchBuf,
 			size2KBuf)
-		zipSize2KBuffer(size2KBuf, tgtSketchBuf)
+		zipSize2KBuffer(size2KBuf, tgtSketchBuf, rnd)
 	}
 
 	return bitPattern + (1 << startingLevel)
 }
 
 func zipSize2KBuffer(
-	bufIn DoublesSketchAccessor,
-	bufOut DoublesSketchAccessor,
+	bufIn DoublesBufferAccessor,
+	bufOut DoublesBufferAccessor,
+	rnd *rand.Rand,
 ) {
-	randomOffset := rand.Intn(2)
+	randomOffset := rnd.Intn(2)
 	limOut := bufOut.NumItems()
 	var idxIn int32 = int32(randomOffset)
 	for idxOut := int32(0); idxOut < limOut; idxOut++ {
@@ -125,7 +197,7 @@ func zipSize2KBuffer(
 	}
 }
 
-func mergeTwoSizeKBuffers(src1, src2, dst DoublesSketchAccessor) {
+func mergeTwoSizeKBuffers(src1, src2, dst DoublesBufferAccessor) {
 	util.Assert(src1.NumItems() == src2.NumItems(), "src1.NumItems() == src2.NumItems()")
 	var k int32 = src1.NumItems()
 	var i1 int32 = 0
@@ -144,11 +216,9 @@ func mergeTwoSizeKBuffers(src1, src2, dst DoublesSketchAccessor) {
 	}
 
 	if i1 < k {
-		var numItems int32 = k - i1
-		dst.PutArray(src1.GetArray(i1, numItems), 0, iDst, numItems)
+		copyItems(src1, i1, dst, iDst, k-i1)
 	} else {
-		var numItems int32 = k - i2
-		dst.PutArray(src2.GetArray(i2, numItems), 0, iDst, numItems)
+		copyItems(src2, i2, dst, iDst, k-i2)
 	}
 }
 
@@ -156,3 +226,12 @@ func computeRequiredItemCapacity(k int32, newN int64) int32 {
 	var levelsNeeded int32 = util.ComputeNumLevelsNeeded(k, newN)
 	return (2 + levelsNeeded) * k
 }
+
+func computeCombinedBufferItemCapacity(k int32, n int64) int32 {
+	var totLevels int32 = util.ComputeNumLevelsNeeded(k, n)
+	if totLevels == 0 {
+		var bbItems int32 = util.ComputeBaseBufferItems(k, n)
+		return util.Intmax(2*MIN_K, util.CeilingPowerOf2(bbItems))
+	}
+	return (2 + totLevels) * k
+}
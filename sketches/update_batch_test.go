@@ -0,0 +1,69 @@
+package sketches
+
+import (
+	"math"
+	"math/rand"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UpdateBatch", func() {
+	newSeededSketch := func(k int) *HeapDoublesSketch {
+		sketch, err := NewDoublesSketchBuilder().SetK(k).SetRandomSeed(11).Build()
+		Expect(err).ToNot(HaveOccurred())
+		return sketch
+	}
+
+	for _, n := range []int{0, 1, 7, 256, 1000, 100000} {
+		n := n
+
+		It("Matches sequential updates", func() {
+			items := make([]float64, n)
+			dataRand := rand.New(rand.NewSource(int64(n)))
+			for i := range items {
+				items[i] = dataRand.NormFloat64()
+				if i%97 == 5 {
+					items[i] = math.NaN()
+				}
+			}
+
+			expected := newSeededSketch(16)
+			for _, item := range items {
+				Expect(expected.Update(item)).To(Succeed())
+			}
+
+			for _, batchSize := range []int{1, 3, 32, 10000} {
+				actual := newSeededSketch(16)
+				for start := 0; start < n; start += batchSize {
+					end := start + batchSize
+					if end > n {
+						end = n
+					}
+					Expect(actual.UpdateBatch(items[start:end])).To(Succeed())
+				}
+				Expect(actual.GetN()).To(Equal(expected.GetN()))
+				Expect(actual.GetBaseBufferCount()).To(Equal(expected.GetBaseBufferCount()))
+				Expect(actual.GetBitPattern()).To(Equal(expected.GetBitPattern()))
+				Expect(len(actual.GetCombinedBuffer())).To(Equal(len(expected.GetCombinedBuffer())))
+
+				expectedBytes, err := expected.Serialize()
+				Expect(err).ToNot(HaveOccurred())
+				actualBytes, err := actual.Serialize()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(actualBytes).To(Equal(expectedBytes))
+			}
+		})
+	}
+
+	It("Invalidates the sorted view", func() {
+		sketch := newSketchWithRange(defaultK, 0, 10)
+		quantile, err := sketch.GetQuantile(1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quantile).To(Equal(9.0))
+		Expect(sketch.UpdateBatch([]float64{100})).To(Succeed())
+		quantile, err = sketch.GetQuantile(1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quantile).To(Equal(100.0))
+	})
+})
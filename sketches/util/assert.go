@@ -0,0 +1,60 @@
+package util
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// AssertionMode selects what Assert does when an internal consistency check
+// fails.
+type AssertionMode int32
+
+const (
+	// ASSERT_OFF ignores failed checks.
+	ASSERT_OFF AssertionMode = iota
+	// ASSERT_LOG reports failed checks through the assertion logger.
+	ASSERT_LOG
+	// ASSERT_PANIC panics on failed checks.
+	ASSERT_PANIC
+)
+
+var (
+	assertionMode   = int32(ASSERT_LOG)
+	assertionLogger atomic.Value
+)
+
+// SetAssertionMode sets the behavior of failed internal consistency checks
+// for the whole package. The default is ASSERT_LOG.
+func SetAssertionMode(mode AssertionMode) {
+	atomic.StoreInt32(&assertionMode, int32(mode))
+}
+
+// GetAssertionMode returns the current behavior of failed internal
+// consistency checks.
+func GetAssertionMode() AssertionMode {
+	return AssertionMode(atomic.LoadInt32(&assertionMode))
+}
+
+// SetAssertionLogger sets the logger used in ASSERT_LOG mode. A nil logger
+// restores the default, which writes through the standard log package.
+func SetAssertionLogger(logger *log.Logger) {
+	assertionLogger.Store(&logger)
+}
+
+func Assert(condition bool, reason string) {
+	if condition {
+		return
+	}
+	switch GetAssertionMode() {
+	case ASSERT_LOG:
+		msg := fmt.Sprintf("Internal consistency check failed: %v", reason)
+		if logger, ok := assertionLogger.Load().(**log.Logger); ok && *logger != nil {
+			(*logger).Output(2, msg)
+		} else {
+			log.Output(2, msg)
+		}
+	case ASSERT_PANIC:
+		panic(fmt.Sprintf("internal consistency check failed: %v", reason))
+	}
+}
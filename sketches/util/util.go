@@ -1,13 +1,12 @@
 package util
 
 import (
-	"bytes"
 	"encoding/binary"
+	"fmt"
 	"math"
 	"math/bits"
+	"math/rand"
 	"unsafe"
-
-	"github.com/rs/zerolog/log"
 )
 
 func LowestZeroBitStartingAt(bits int64, startingBit int32) int32 {
@@ -27,13 +26,62 @@ func BinaryPutFloat64(b []byte, byteOrder binary.ByteOrder, f float64) {
 	byteOrder.PutUint64(b, n)
 }
 
+func BinaryGetFloat64(b []byte, byteOrder binary.ByteOrder) float64 {
+	return math.Float64frombits(byteOrder.Uint64(b))
+}
+
+// BinaryGetFloat64Slice decodes len(floats) values from inBuffer into floats.
+func BinaryGetFloat64Slice(floats []float64, inBuffer []byte, byteOrder binary.ByteOrder) {
+	for i := range floats {
+		floats[i] = BinaryGetFloat64(inBuffer[i<<3:], byteOrder)
+	}
+}
+
+// BinaryPutFloat64Slice encodes floats into the start of outBuffer.
 func BinaryPutFloat64Slice(outBuffer []byte, byteOrder binary.ByteOrder, floats []float64) error {
-	buf := &bytes.Buffer{}
-	err := binary.Write(buf, byteOrder, floats)
-	if err != nil {
-		return err
+	if len(outBuffer) < len(floats)<<3 {
+		return fmt.Errorf("buffer too small: %v < %v", len(outBuffer), len(floats)<<3)
+	}
+	switch byteOrder {
+	case binary.LittleEndian:
+		for i, f := range floats {
+			binary.LittleEndian.PutUint64(outBuffer[i<<3:], math.Float64bits(f))
+		}
+	case binary.BigEndian:
+		for i, f := range floats {
+			binary.BigEndian.PutUint64(outBuffer[i<<3:], math.Float64bits(f))
+		}
+	default:
+		for i, f := range floats {
+			BinaryPutFloat64(outBuffer[i<<3:], byteOrder, f)
+		}
+	}
+	return nil
+}
+
+func BinaryPutFloat32(b []byte, byteOrder binary.ByteOrder, f float32) {
+	byteOrder.PutUint32(b, math.Float32bits(f))
+}
+
+func BinaryGetFloat32(b []byte, byteOrder binary.ByteOrder) float32 {
+	return math.Float32frombits(byteOrder.Uint32(b))
+}
+
+// BinaryGetFloat32Slice decodes len(floats) values from inBuffer into floats.
+func BinaryGetFloat32Slice(floats []float32, inBuffer []byte, byteOrder binary.ByteOrder) {
+	for i := range floats {
+		floats[i] = BinaryGetFloat32(inBuffer[i<<2:], byteOrder)
+	}
+}
+
+// BinaryPutFloat32Slice encodes floats into the start of outBuffer.
+func BinaryPutFloat32Slice(outBuffer []byte, byteOrder binary.ByteOrder, floats []float32) error {
+	if len(outBuffer) < len(floats)<<2 {
+		return fmt.Errorf("buffer too small: %v < %v", len(outBuffer), len(floats)<<2)
+	}
+	for i, f := range floats {
+		BinaryPutFloat32(outBuffer[i<<2:], byteOrder, f)
 	}
-	copy(outBuffer, buf.Bytes())
 	return nil
 }
 
@@ -100,12 +148,6 @@ func IsPowerOf2(x int32) bool {
 	return (x & (x - 1)) == 0
 }
 
-func Assert(condition bool, reason string) {
-	if !condition {
-		log.Error().Msgf("Internal consistency check failed: %v", reason)
-	}
-}
-
 func DetermineNativeByteOrder() binary.ByteOrder {
 	buf := [2]byte{}
 	*(*uint16)(unsafe.Pointer(&buf[0])) = uint16(0xABCD)
@@ -119,3 +161,30 @@ func DetermineNativeByteOrder() binary.ByteOrder {
 		panic("Could not determine native endianness.")
 	}
 }
+
+// splitMix64Source is a small rand.Source64 with 8 bytes of state, so that
+// every sketch can afford its own generator.
+type splitMix64Source struct {
+	state uint64
+}
+
+// NewSplitMix64Source returns a SplitMix64 generator seeded with seed.
+func NewSplitMix64Source(seed int64) rand.Source64 {
+	return &splitMix64Source{state: uint64(seed)}
+}
+
+func (s *splitMix64Source) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+func (s *splitMix64Source) Uint64() uint64 {
+	s.state += 0x9E3779B97F4A7C15
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
+
+func (s *splitMix64Source) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
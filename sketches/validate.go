@@ -0,0 +1,68 @@
+package sketches
+
+import (
+	"fmt"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+)
+
+// Validate checks the internal invariants of the sketch: the bit pattern and
+// base buffer count against n, the combined buffer capacity, the min and max
+// values and the sortedness of the levels. It returns an error wrapping
+// ErrCorruptSketch for the first invariant that does not hold.
+func (s *DoublesSketchImpl) Validate() error {
+	k := s.GetK()
+	n := s.GetN()
+	if !validK(k) {
+		return newCorruptSketchError("invalid k: %v", k)
+	}
+	if n < 0 {
+		return newCorruptSketchError("n must be >= 0: %v", n)
+	}
+	if s.IsEmpty() != (n == 0) {
+		return newCorruptSketchError("empty must match n == 0 (n %v)", n)
+	}
+	if bitPattern := util.ComputeBitPattern(k, n); s.GetBitPattern() != bitPattern {
+		return newCorruptSketchError("bit pattern %b does not match n %v, expected %b", s.GetBitPattern(), n, bitPattern)
+	}
+	if bbCount := util.ComputeBaseBufferItems(k, n); s.GetBaseBufferCount() != bbCount {
+		return newCorruptSketchError("base buffer count %v does not match n %v, expected %v", s.GetBaseBufferCount(), n, bbCount)
+	}
+
+	var requiredCapacity int32
+	if s.IsCompact() {
+		requiredCapacity = util.ComputeRetainedItems(k, n)
+	} else if s.GetBitPattern() == 0 {
+		requiredCapacity = s.GetBaseBufferCount()
+	} else {
+		requiredCapacity = computeRequiredItemCapacity(k, n)
+	}
+	if capacity := s.combinedBufferItemCapacity(); capacity < requiredCapacity {
+		return newCorruptSketchError("combined buffer capacity %v is less than the required %v", capacity, requiredCapacity)
+	}
+
+	if n == 0 {
+		return nil
+	}
+	// compact sketches always keep their base buffer ordered
+	if err := checkDoublesItems(s.DoublesSketch, s.IsCompact()); err != nil {
+		return fmt.Errorf("invalid items: %w", err)
+	}
+	return nil
+}
+
+// combinedBufferItemCapacity returns the number of items the combined buffer
+// can hold, without copying it out of memory.
+func (s *DoublesSketchImpl) combinedBufferItemCapacity() int32 {
+	switch sketch := s.DoublesSketch.(type) {
+	case *DirectUpdateDoublesSketch:
+		return sketch.getCombinedBufferItemCapacity()
+	case *DirectCompactDoublesSketch:
+		if len(sketch.mem) < COMBINED_BUFFER {
+			return 0
+		}
+		return int32((len(sketch.mem) - COMBINED_BUFFER) >> 3)
+	default:
+		return int32(len(s.GetCombinedBuffer()))
+	}
+}
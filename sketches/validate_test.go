@@ -0,0 +1,91 @@
+package sketches
+
+import (
+	"bytes"
+	"errors"
+	"log"
+
+	"github.com/fluxninja/datasketches-go/sketches/util"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Validate", func() {
+	for _, n := range []int{0, 1, 100, 1000, 100000} {
+		n := n
+
+		It("Accepts every kind of sketch", func() {
+			sketch := newSketchWithRange(defaultK, 0, n)
+			Expect(sketch.Validate()).To(Succeed())
+			Expect(sketch.Compact().Validate()).To(Succeed())
+
+			direct, err := NewDirectUpdateDoublesSketch(defaultK, make([]byte, 8), nil)
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < n; i++ {
+				Expect(direct.Update(float64(i))).To(Succeed())
+			}
+			Expect(direct.Validate()).To(Succeed())
+
+			compactBytes, err := sketch.SerializeCustom(true)
+			Expect(err).ToNot(HaveOccurred())
+			wrapped, err := WrapDoublesSketch(compactBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(wrapped.Validate()).To(Succeed())
+		})
+	}
+
+	It("Detects broken invariants", func() {
+		expectInvalid := func(mutate func(sketch *HeapDoublesSketch)) {
+			sketch := newSketchWithRange(defaultK, 0, 1000)
+			mutate(sketch)
+			Expect(errors.Is(sketch.Validate(), ErrCorruptSketch)).To(BeTrue())
+		}
+
+		expectInvalid(func(sketch *HeapDoublesSketch) {
+			Expect(sketch.PutBitPattern(sketch.GetBitPattern() + 1)).To(Succeed())
+		})
+		expectInvalid(func(sketch *HeapDoublesSketch) {
+			Expect(sketch.PutN(sketch.GetN() + 1)).To(Succeed())
+		})
+		expectInvalid(func(sketch *HeapDoublesSketch) {
+			Expect(sketch.PutCombinedBuffer(sketch.GetCombinedBuffer()[:2*defaultK])).To(Succeed())
+		})
+		expectInvalid(func(sketch *HeapDoublesSketch) {
+			Expect(sketch.PutMinValue(10)).To(Succeed())
+		})
+		expectInvalid(func(sketch *HeapDoublesSketch) {
+			Expect(sketch.PutMaxValue(-1)).To(Succeed())
+		})
+		expectInvalid(func(sketch *HeapDoublesSketch) {
+			// swaps the first two items of level 0
+			buf := sketch.GetCombinedBuffer()
+			buf[2*defaultK], buf[2*defaultK+1] = buf[2*defaultK+1], buf[2*defaultK]
+		})
+	})
+})
+
+var _ = Describe("Assert", func() {
+	AfterEach(func() {
+		util.SetAssertionMode(util.ASSERT_PANIC)
+		util.SetAssertionLogger(nil)
+	})
+
+	It("Follows the assertion mode", func() {
+		var out bytes.Buffer
+		util.SetAssertionLogger(log.New(&out, "", 0))
+
+		util.SetAssertionMode(util.ASSERT_OFF)
+		Expect(func() { util.Assert(false, "off") }).ToNot(Panic())
+		Expect(out.String()).To(BeEmpty())
+
+		util.SetAssertionMode(util.ASSERT_LOG)
+		Expect(func() { util.Assert(true, "holds") }).ToNot(Panic())
+		Expect(func() { util.Assert(false, "logged") }).ToNot(Panic())
+		Expect(out.String()).To(Equal("Internal consistency check failed: logged\n"))
+
+		util.SetAssertionMode(util.ASSERT_PANIC)
+		Expect(func() { util.Assert(true, "holds") }).ToNot(Panic())
+		Expect(func() { util.Assert(false, "panics") }).To(Panic())
+		Expect(util.GetAssertionMode()).To(Equal(util.ASSERT_PANIC))
+	})
+})